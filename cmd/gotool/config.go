@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/EricJSanchez/gotool/environment"
+	_ "github.com/EricJSanchez/gotool/service"
+	"github.com/EricJSanchez/gotool/sys"
+)
+
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		return errors.New("config: missing sub command")
+	}
+	switch args[0] {
+	case "lint":
+		fs := flag.NewFlagSet("config lint", flag.ExitOnError)
+		path := fs.String("path", "configs", "config root directory")
+		envs := fs.String("env", "", "comma separated environments to check, default all")
+		schema := fs.String("schema", "", "schema file exported by sys.ExportCfgSchema")
+		remote := fs.Bool("remote", false, "also check remote config data ids")
+		remoteEnv := fs.String("remote-env", string(environment.Development), "environment used to load remote config")
+		_ = fs.Parse(args[1:])
+		return lintConfig(*path, *envs, *schema, *remote, *remoteEnv)
+	}
+	return fmt.Errorf("config: unknown sub command %q", args[0])
+}
+
+func lintConfig(path, envs, schema string, remote bool, remoteEnv string) error {
+	if fi, err := os.Stat(path); err != nil || !fi.IsDir() {
+		return fmt.Errorf("config lint: %s is not a directory", path)
+	}
+	sys.InitConfig(path)
+	defer sys.StopCfgWatch()
+	if schema != "" {
+		f, err := os.Open(schema)
+		if err != nil {
+			return err
+		}
+		err = sys.ImportCfgSchema(f)
+		_ = f.Close()
+		if err != nil {
+			return fmt.Errorf("read schema %s: %w", schema, err)
+		}
+	}
+	opts := sys.CfgLintOptions{Remote: remote}
+	if envs != "" {
+		opts.Envs = strings.Split(envs, ",")
+	}
+	if remote {
+		if err := sys.InitEnv(environment.Env(remoteEnv)); err != nil {
+			return err
+		}
+		if err := sys.InitRemoteConfig(); err != nil {
+			return err
+		}
+		defer sys.CloseRemoteConfig()
+	}
+	issues, err := sys.LintCfg(opts)
+	if err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("config lint: %d issue(s)", len(issues))
+	}
+	fmt.Println("config lint: ok")
+	return nil
+}
@@ -0,0 +1,62 @@
+// gotool 命令行工具
+//
+//	gotool secret genkey
+//	gotool secret encrypt [-key-file path] [-key-env name] [-arg <value>]
+//	gotool secret decrypt [-key-file path] [-key-env name] [-arg <ENC(...)>]
+//	                      value is prompted on a terminal or read from stdin unless -arg is given
+//	gotool secret rotate  -old-key-file path -new-key-file path <file>...
+//	gotool config lint    [-path configs] [-env development,production] [-schema schema.json]
+//	                      [-remote] [-remote-env development]
+//	gotool migrate up     [-path configs] [-env development] [-db name] [-dir migrations]
+//	                      [-steps n] [-dry-run] [-yes] [-allow-non-atomic] [-lock-timeout 1m]
+//	gotool migrate down   [-path configs] [-env development] [-db name] [-dir migrations]
+//	                      [-steps 1] [-dry-run] [-yes] [-allow-non-atomic]
+//	gotool migrate status [-path configs] [-env development] [-db name] [-dir migrations]
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "secret":
+		err = runSecret(os.Args[2:])
+	case "config":
+		err = runConfig(os.Args[2:])
+	case "migrate":
+		err = runMigrate(os.Args[2:])
+	case "help", "-h", "--help":
+		usage()
+		return
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gotool:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage:
+  gotool secret genkey
+  gotool secret encrypt [-key-file path] [-key-env name] [-arg <value>]
+  gotool secret decrypt [-key-file path] [-key-env name] [-arg <ENC(...)>]
+                        value is prompted on a terminal or read from stdin unless -arg is given
+  gotool secret rotate  -old-key-file path -new-key-file path <file>...
+  gotool config lint    [-path configs] [-env development,production] [-schema schema.json]
+                        [-remote] [-remote-env development]
+  gotool migrate up     [-path configs] [-env development] [-db name] [-dir migrations]
+                        [-steps n] [-dry-run] [-yes] [-allow-non-atomic] [-lock-timeout 1m]
+  gotool migrate down   [-path configs] [-env development] [-db name] [-dir migrations]
+                        [-steps 1] [-dry-run] [-yes] [-allow-non-atomic]
+  gotool migrate status [-path configs] [-env development] [-db name] [-dir migrations]`)
+}
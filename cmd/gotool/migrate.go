@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/EricJSanchez/gotool/environment"
+	"github.com/EricJSanchez/gotool/sys"
+)
+
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("migrate: missing sub command")
+	}
+	cmd := args[0]
+	if cmd != "up" && cmd != "down" && cmd != "status" {
+		return fmt.Errorf("migrate: unknown sub command %q", cmd)
+	}
+	fs := flag.NewFlagSet("migrate "+cmd, flag.ExitOnError)
+	path := fs.String("path", "configs", "config root directory")
+	env := fs.String("env", string(environment.Development), "environment used to load datasource config")
+	db := fs.String("db", "", "datasource name, default app.toml default_db")
+	dir := fs.String("dir", "migrations", "migrations root directory, containing one directory per datasource")
+	steps := fs.Int("steps", 0, "number of migrations to run, default all for up and 1 for down")
+	dryRun := fs.Bool("dry-run", false, "print the migrations and SQL without running them")
+	yes := fs.Bool("yes", false, "allow destructive migrations in production")
+	nonAtomic := fs.Bool("allow-non-atomic", false, "allow multi-statement DDL migrations on mysql, which cannot be rolled back")
+	lockTimeout := fs.Duration("lock-timeout", 0, "time to wait for another instance to finish migrating")
+	_ = fs.Parse(args[1:])
+
+	if err := sys.InitEnv(environment.Env(*env)); err != nil {
+		return err
+	}
+	sys.InitConfig(*path)
+	defer sys.StopCfgWatch()
+	if !environment.Is(environment.Development) {
+		if err := sys.InitRemoteConfig(); err != nil {
+			return err
+		}
+		defer sys.CloseRemoteConfig()
+	}
+	name := *db
+	if name == "" {
+		if app := sys.Cfg("app"); app != nil {
+			name = app.GetString("default_db")
+		}
+	}
+	if name == "" {
+		return errors.New("migrate: -db is required when default_db is not set")
+	}
+	ctx := context.Background()
+	defer sys.CloseAll(ctx)
+	if cmd == "status" {
+		states, err := sys.MigrationStatus(ctx, name, *dir)
+		if err != nil {
+			return err
+		}
+		for _, s := range states {
+			applied := "pending"
+			if s.Applied {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			mark := ""
+			if s.Destructive {
+				mark = " [destructive]"
+			}
+			fmt.Printf("%d_%s\t%s%s\n", s.Version, s.Name, applied, mark)
+		}
+		return nil
+	}
+	return sys.Migrate(ctx, name, sys.MigrateOptions{
+		Dir:              *dir,
+		Down:             cmd == "down",
+		Steps:            *steps,
+		DryRun:           *dryRun,
+		AllowDestructive: *yes,
+		AllowNonAtomic:   *nonAtomic,
+		LockTimeout:      *lockTimeout,
+		Out:              os.Stdout,
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/EricJSanchez/gotool/sys"
+	"golang.org/x/term"
+)
+
+func runSecret(args []string) error {
+	if len(args) == 0 {
+		return errors.New("secret: missing sub command")
+	}
+	switch args[0] {
+	case "genkey":
+		key, err := sys.GenerateCfgKey()
+		if err != nil {
+			return err
+		}
+		fmt.Println(key)
+		return nil
+	case "encrypt", "decrypt":
+		fs := flag.NewFlagSet("secret "+args[0], flag.ExitOnError)
+		keyFile := fs.String("key-file", "", "key file path")
+		keyEnv := fs.String("key-env", sys.CfgKeyEnv, "environment variable holding the key")
+		fromArg := fs.Bool("arg", false, "take the value from the command line (visible in shell history and ps)")
+		_ = fs.Parse(args[1:])
+		key, err := secretKey(*keyFile, *keyEnv)
+		if err != nil {
+			return err
+		}
+		value, err := secretValue(fs, args[0], *fromArg)
+		if err != nil {
+			return err
+		}
+		var out string
+		if args[0] == "encrypt" {
+			out, err = sys.EncryptCfgValueWithKey(key, value)
+		} else {
+			out, err = sys.DecryptCfgValueWithKey(key, value)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println(out)
+		return nil
+	case "rotate":
+		fs := flag.NewFlagSet("secret rotate", flag.ExitOnError)
+		oldKeyFile := fs.String("old-key-file", "", "current key file path")
+		oldKeyEnv := fs.String("old-key-env", sys.CfgKeyEnv, "environment variable holding the current key")
+		newKeyFile := fs.String("new-key-file", "", "new key file path")
+		newKeyEnv := fs.String("new-key-env", "", "environment variable holding the new key")
+		_ = fs.Parse(args[1:])
+		oldKey, err := secretKey(*oldKeyFile, *oldKeyEnv)
+		if err != nil {
+			return fmt.Errorf("old key: %w", err)
+		}
+		newKey, err := secretKey(*newKeyFile, *newKeyEnv)
+		if err != nil {
+			return fmt.Errorf("new key: %w", err)
+		}
+		for _, file := range fs.Args() {
+			if err = rotateFile(file, oldKey, newKey); err != nil {
+				return err
+			}
+			fmt.Println("rotated", file)
+		}
+		return nil
+	}
+	return fmt.Errorf("secret: unknown sub command %q", args[0])
+}
+
+// 密钥文件优先，其次为环境变量
+func secretKey(file, env string) ([]byte, error) {
+	if file != "" {
+		return sys.FileKeyProvider(file).Key()
+	}
+	if env != "" {
+		return sys.EnvKeyProvider(env).Key()
+	}
+	return nil, sys.ErrNoCfgKey
+}
+
+// 明文不经命令行参数传入，避免留在 shell 历史与进程列表中：终端下提示输入且不回显，否则读取标准输入；
+// 仅在显式指定 -arg 时使用命令行参数
+func secretValue(fs *flag.FlagSet, cmd string, fromArg bool) (string, error) {
+	if fromArg {
+		if fs.NArg() != 1 {
+			return "", fmt.Errorf("secret %s: expected exactly one value", cmd)
+		}
+		return fs.Arg(0), nil
+	}
+	if fs.NArg() != 0 {
+		return "", fmt.Errorf("secret %s: value is read from stdin, pass -arg to take it from the command line", cmd)
+	}
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "value: ")
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	b, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	// echo、文件末尾的换行不属于值
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func rotateFile(file string, oldKey, newKey []byte) error {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	out, err := sys.RotateCfgSecrets(content, oldKey, newKey)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return os.WriteFile(file, out, fi.Mode())
+}
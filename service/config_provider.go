@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/EricJSanchez/gotool/sys"
+	"github.com/spf13/viper"
+)
+
+// ErrConfigNotFound 远程配置中心中不存在该配置
+var ErrConfigNotFound = errors.New("remote config not found")
+
+func init() {
+	sys.RegisterConfigProvider("nacos", func(cfg *viper.Viper) (sys.ConfigProvider, error) {
+		if Factory == nil {
+			Register()
+		}
+		if err := Factory.Nacos.initClients(); err != nil {
+			return nil, err
+		}
+		return Factory.Nacos, nil
+	})
+	sys.RegisterConfigProvider("etcd", func(cfg *viper.Viper) (sys.ConfigProvider, error) {
+		return NewEtcdProvider(cfg)
+	})
+	sys.RegisterConfigProvider("consul", func(cfg *viper.Viper) (sys.ConfigProvider, error) {
+		return NewConsulProvider(cfg)
+	})
+	sys.RegisterConfigProvider("http", func(cfg *viper.Viper) (sys.ConfigProvider, error) {
+		return NewHttpProvider(cfg)
+	})
+	sys.RegisterConfigProvider("file", func(cfg *viper.Viper) (sys.ConfigProvider, error) {
+		return NewFileProvider(cfg)
+	})
+}
+
+// 读取毫秒为单位的配置项，缺省时使用 def
+func cfgMillis(cfg *viper.Viper, key string, def time.Duration) time.Duration {
+	if ms := cfg.GetInt64(key); ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return def
+}
+
+func newHttpClient(cfg *viper.Viper) *http.Client {
+	return &http.Client{Timeout: cfgMillis(cfg, "timeout", 5*time.Second)}
+}
+
+// 按固定间隔拉取配置，与 last 不同时回调，直到 ctx 结束
+func pollWatch(ctx context.Context, interval time.Duration, item sys.ConfigItem, last string, fetch func(sys.ConfigItem) (string, error), onChange func(string)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			data, err := fetch(item)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					fmt.Println("watch remote config err:", item, err)
+				}
+				continue
+			}
+			if data != last {
+				last = data
+				onChange(data)
+			}
+		}
+	}
+}
+
+// 监听连接断开后的重试间隔，从 1 秒开始翻倍，最长 30 秒
+func nextBackoff(d time.Duration) time.Duration {
+	if d <= 0 {
+		return time.Second
+	}
+	if d *= 2; d > 30*time.Second {
+		d = 30 * time.Second
+	}
+	return d
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EricJSanchez/gotool/sys"
+	"github.com/spf13/viper"
+)
+
+// ConsulProvider 读取 Consul KV 中的配置，键为 <prefix>/<group>/<dataId>
+//
+//	[remote.consul]
+//	addr       = "http://127.0.0.1:8500"
+//	token      = ""
+//	datacenter = ""
+//	prefix     = "config"
+//	timeout    = 5000
+type ConsulProvider struct {
+	addr       string
+	token      string
+	datacenter string
+	prefix     string
+	client     *http.Client
+	stream     *http.Client
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+func NewConsulProvider(cfg *viper.Viper) (*ConsulProvider, error) {
+	addr := cfg.GetString("addr")
+	if addr == "" {
+		addr = "http://127.0.0.1:8500"
+	}
+	prefix := cfg.GetString("prefix")
+	if prefix == "" {
+		prefix = "config"
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ConsulProvider{
+		addr:       strings.TrimRight(addr, "/"),
+		token:      cfg.GetString("token"),
+		datacenter: cfg.GetString("datacenter"),
+		prefix:     strings.Trim(prefix, "/"),
+		client:     newHttpClient(cfg),
+		// 阻塞查询最长等待 5 分钟
+		stream: &http.Client{Timeout: 6 * time.Minute},
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+func (p *ConsulProvider) key(item sys.ConfigItem) string {
+	return p.prefix + "/" + item.Group + "/" + item.DataId
+}
+
+// index 大于 0 时发起阻塞查询，返回内容及 X-Consul-Index
+func (p *ConsulProvider) get(client *http.Client, item sys.ConfigItem, index string) (string, string, error) {
+	q := url.Values{}
+	q.Set("raw", "")
+	if p.datacenter != "" {
+		q.Set("dc", p.datacenter)
+	}
+	if index != "" {
+		q.Set("index", index)
+		q.Set("wait", "5m")
+	}
+	req, err := http.NewRequestWithContext(p.ctx, http.MethodGet, p.addr+"/v1/kv/"+p.key(item)+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", "", err
+	}
+	if p.token != "" {
+		req.Header.Set("X-Consul-Token", p.token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	newIndex := resp.Header.Get("X-Consul-Index")
+	if resp.StatusCode == http.StatusNotFound {
+		return "", newIndex, fmt.Errorf("%w: consul key %s", ErrConfigNotFound, p.key(item))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", newIndex, fmt.Errorf("consul kv %s: %s", p.key(item), resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	return string(data), newIndex, err
+}
+
+// Fetch 实现 sys.ConfigProvider
+func (p *ConsulProvider) Fetch(item sys.ConfigItem) (string, error) {
+	data, _, err := p.get(p.client, item, "")
+	return data, err
+}
+
+// Watch 实现 sys.ConfigProvider，使用阻塞查询监听变更
+func (p *ConsulProvider) Watch(item sys.ConfigItem, onChange func(data string)) error {
+	last, index, err := p.get(p.client, item, "")
+	if err != nil && !errors.Is(err, ErrConfigNotFound) {
+		return err
+	}
+	go func() {
+		var backoff time.Duration
+		for p.ctx.Err() == nil {
+			data, newIndex, err := p.get(p.stream, item, index)
+			if err != nil && !errors.Is(err, ErrConfigNotFound) {
+				if p.ctx.Err() != nil {
+					return
+				}
+				fmt.Println("consul watch err:", item, err)
+				backoff = nextBackoff(backoff)
+				if !sleepCtx(p.ctx, backoff) {
+					return
+				}
+				continue
+			}
+			backoff = 0
+			// index 回退时需要重置，见 Consul 阻塞查询文档
+			oldIdx, _ := strconv.ParseUint(index, 10, 64)
+			newIdx, _ := strconv.ParseUint(newIndex, 10, 64)
+			if newIdx < oldIdx {
+				newIdx = 0
+			}
+			if newIdx == 0 && !sleepCtx(p.ctx, time.Second) {
+				return
+			}
+			index = strconv.FormatUint(newIdx, 10)
+			if err == nil && data != last {
+				last = data
+				onChange(data)
+			}
+		}
+	}()
+	return nil
+}
+
+// Close 实现 sys.ConfigProvider
+func (p *ConsulProvider) Close() error {
+	p.cancel()
+	return nil
+}
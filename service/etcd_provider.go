@@ -0,0 +1,290 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EricJSanchez/gotool/sys"
+	"github.com/spf13/viper"
+)
+
+// EtcdProvider 通过 etcd v3 的 HTTP/JSON 网关读取配置，键为 <prefix>/<group>/<dataId>
+//
+//	[remote.etcd]
+//	endpoints = ["http://127.0.0.1:2379"]
+//	prefix    = "/config"
+//	username  = ""
+//	password  = ""
+//	timeout   = 5000
+type EtcdProvider struct {
+	endpoints []string
+	prefix    string
+	username  string
+	password  string
+	client    *http.Client
+	stream    *http.Client
+
+	token  string
+	revs   map[string]etcdRev // 键最近一次读取、监听到的版本，重连后从此处继续
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewEtcdProvider(cfg *viper.Viper) (*EtcdProvider, error) {
+	endpoints := cfg.GetStringSlice("endpoints")
+	if len(endpoints) == 0 {
+		return nil, errors.New("etcd provider: remote.etcd.endpoints is required")
+	}
+	for i := range endpoints {
+		endpoints[i] = strings.TrimRight(endpoints[i], "/")
+	}
+	prefix := cfg.GetString("prefix")
+	if prefix == "" {
+		prefix = "/config"
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &EtcdProvider{
+		endpoints: endpoints,
+		prefix:    strings.TrimRight(prefix, "/"),
+		username:  cfg.GetString("username"),
+		password:  cfg.GetString("password"),
+		client:    newHttpClient(cfg),
+		stream:    &http.Client{},
+		revs:      make(map[string]etcdRev),
+		ctx:       ctx,
+		cancel:    cancel,
+	}, nil
+}
+
+func (p *EtcdProvider) key(item sys.ConfigItem) string {
+	return p.prefix + "/" + item.Group + "/" + item.DataId
+}
+
+// 依次尝试每个节点，返回第一个成功的响应
+func (p *EtcdProvider) post(client *http.Client, path string, body interface{}) (resp *http.Response, err error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	for _, endpoint := range p.endpoints {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(p.ctx, http.MethodPost, endpoint+path, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if path != "/v3/auth/authenticate" {
+			var token string
+			if token, err = p.authToken(); err != nil {
+				return nil, err
+			}
+			if token != "" {
+				req.Header.Set("Authorization", token)
+			}
+		}
+		if resp, err = client.Do(req); err != nil {
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			err = fmt.Errorf("etcd %s: %s", path, resp.Status)
+			if resp.StatusCode == http.StatusUnauthorized && path != "/v3/auth/authenticate" {
+				p.mu.Lock()
+				p.token = ""
+				p.mu.Unlock()
+			}
+			continue
+		}
+		return resp, nil
+	}
+	return nil, err
+}
+
+func (p *EtcdProvider) authToken() (string, error) {
+	if p.username == "" {
+		return "", nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" {
+		return p.token, nil
+	}
+	resp, err := p.post(p.client, "/v3/auth/authenticate", map[string]string{
+		"name":     p.username,
+		"password": p.password,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var ret struct {
+		Token string `json:"token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return "", err
+	}
+	p.token = ret.Token
+	return p.token, nil
+}
+
+// 网关将 int64 编码为字符串
+type etcdKv struct {
+	Value       string `json:"value"`
+	ModRevision int64  `json:"mod_revision,string"`
+}
+
+type etcdHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+type etcdRev struct {
+	rev  int64
+	data string
+}
+
+func (p *EtcdProvider) lastRev(key string) etcdRev {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.revs[key]
+}
+
+func (p *EtcdProvider) setRev(key string, r etcdRev) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.revs[key] = r
+}
+
+// Fetch 实现 sys.ConfigProvider
+func (p *EtcdProvider) Fetch(item sys.ConfigItem) (string, error) {
+	data, _, err := p.fetch(item)
+	return data, err
+}
+
+// 返回内容与读取时的集群版本，之后的变更从该版本之后监听
+func (p *EtcdProvider) fetch(item sys.ConfigItem) (string, int64, error) {
+	resp, err := p.post(p.client, "/v3/kv/range", map[string]string{
+		"key": base64.StdEncoding.EncodeToString([]byte(p.key(item))),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	var ret struct {
+		Header etcdHeader `json:"header"`
+		Kvs    []etcdKv   `json:"kvs"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return "", 0, err
+	}
+	if len(ret.Kvs) == 0 {
+		return "", 0, fmt.Errorf("%w: etcd key %s", ErrConfigNotFound, p.key(item))
+	}
+	b, err := base64.StdEncoding.DecodeString(ret.Kvs[0].Value)
+	if err != nil {
+		return "", 0, err
+	}
+	data := string(b)
+	p.setRev(p.key(item), etcdRev{rev: ret.Header.Revision, data: data})
+	return data, ret.Header.Revision, nil
+}
+
+// Watch 实现 sys.ConfigProvider，使用 /v3/watch 长连接，断开后从最近的版本继续监听，
+// 期间的变更不会丢失；该版本已被压缩时重新拉取，内容不同则回调
+func (p *EtcdProvider) Watch(item sys.ConfigItem, onChange func(data string)) error {
+	go func() {
+		var backoff time.Duration
+		for p.ctx.Err() == nil {
+			err := p.watchOnce(item, onChange)
+			if errors.Is(err, errEtcdCompacted) {
+				err = p.refetch(item, onChange)
+			}
+			if err != nil && p.ctx.Err() == nil {
+				fmt.Println("etcd watch err:", item, err)
+			}
+			backoff = nextBackoff(backoff)
+			if !sleepCtx(p.ctx, backoff) {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+var errEtcdCompacted = errors.New("etcd watch revision compacted")
+
+func (p *EtcdProvider) refetch(item sys.ConfigItem, onChange func(data string)) error {
+	last := p.lastRev(p.key(item))
+	data, _, err := p.fetch(item)
+	if err != nil {
+		return err
+	}
+	if data != last.data {
+		onChange(data)
+	}
+	return nil
+}
+
+func (p *EtcdProvider) watchOnce(item sys.ConfigItem, onChange func(data string)) error {
+	key := p.key(item)
+	create := map[string]interface{}{
+		"key": base64.StdEncoding.EncodeToString([]byte(key)),
+	}
+	if last := p.lastRev(key); last.rev > 0 {
+		create["start_revision"] = strconv.FormatInt(last.rev+1, 10)
+	}
+	resp, err := p.post(p.stream, "/v3/watch", map[string]interface{}{
+		"create_request": create,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Result struct {
+				CompactRevision int64 `json:"compact_revision,string"`
+				Events          []struct {
+					Type string `json:"type"`
+					Kv   etcdKv `json:"kv"`
+				} `json:"events"`
+			} `json:"result"`
+		}
+		if err = dec.Decode(&msg); err != nil {
+			return err
+		}
+		if msg.Result.CompactRevision > 0 {
+			return errEtcdCompacted
+		}
+		for _, ev := range msg.Result.Events {
+			last := p.lastRev(key)
+			// 网关省略默认值，PUT 事件没有 type 字段
+			if ev.Type != "" && ev.Type != "PUT" {
+				p.setRev(key, etcdRev{rev: ev.Kv.ModRevision, data: last.data})
+				continue
+			}
+			data, err := base64.StdEncoding.DecodeString(ev.Kv.Value)
+			if err != nil {
+				return err
+			}
+			p.setRev(key, etcdRev{rev: ev.Kv.ModRevision, data: string(data)})
+			onChange(string(data))
+		}
+	}
+}
+
+// Close 实现 sys.ConfigProvider
+func (p *EtcdProvider) Close() error {
+	p.cancel()
+	return nil
+}
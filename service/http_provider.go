@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EricJSanchez/gotool/sys"
+	"github.com/spf13/viper"
+)
+
+// HttpProvider 通过 HTTP GET 读取配置，定时拉取检测变更
+//
+//	[remote.http]
+//	url      = "http://config.internal/{group}/{dataId}"
+//	headers  = { Authorization = "Bearer xxx" }
+//	interval = 30000
+//	timeout  = 5000
+type HttpProvider struct {
+	url      string
+	headers  map[string]string
+	interval time.Duration
+	client   *http.Client
+
+	etags  map[string]string
+	bodies map[string]string
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewHttpProvider(cfg *viper.Viper) (*HttpProvider, error) {
+	u := cfg.GetString("url")
+	if u == "" {
+		return nil, errors.New("http provider: remote.http.url is required")
+	}
+	if !strings.Contains(u, "{dataId}") {
+		u = strings.TrimRight(u, "/") + "/{group}/{dataId}"
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &HttpProvider{
+		url:      u,
+		headers:  cfg.GetStringMapString("headers"),
+		interval: cfgMillis(cfg, "interval", 30*time.Second),
+		client:   newHttpClient(cfg),
+		etags:    make(map[string]string),
+		bodies:   make(map[string]string),
+		ctx:      ctx,
+		cancel:   cancel,
+	}, nil
+}
+
+// Fetch 实现 sys.ConfigProvider，服务端返回 304 时使用上次的内容
+func (p *HttpProvider) Fetch(item sys.ConfigItem) (string, error) {
+	u := strings.NewReplacer("{dataId}", item.DataId, "{group}", item.Group).Replace(p.url)
+	req, err := http.NewRequestWithContext(p.ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range p.headers {
+		req.Header.Set(k, v)
+	}
+	p.mu.Lock()
+	etag, body := p.etags[item.String()], p.bodies[item.String()]
+	p.mu.Unlock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return body, nil
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", fmt.Errorf("%w: %s", ErrConfigNotFound, u)
+	default:
+		return "", fmt.Errorf("http provider %s: %s", u, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	p.etags[item.String()] = resp.Header.Get("ETag")
+	p.bodies[item.String()] = string(data)
+	p.mu.Unlock()
+	return string(data), nil
+}
+
+// Watch 实现 sys.ConfigProvider
+func (p *HttpProvider) Watch(item sys.ConfigItem, onChange func(data string)) error {
+	last, _ := p.Fetch(item)
+	go pollWatch(p.ctx, p.interval, item, last, p.Fetch, onChange)
+	return nil
+}
+
+// Close 实现 sys.ConfigProvider
+func (p *HttpProvider) Close() error {
+	p.cancel()
+	return nil
+}
+
+// FileProvider 从本地目录读取配置，文件为 <dir>/<group>/<dataId>，不存在时读取 <dir>/<dataId>，
+// 适用于挂载 ConfigMap 等场景
+//
+//	[remote.file]
+//	dir      = "/etc/gotool/config"
+//	interval = 5000
+type FileProvider struct {
+	dir      string
+	interval time.Duration
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+func NewFileProvider(cfg *viper.Viper) (*FileProvider, error) {
+	dir := cfg.GetString("dir")
+	if dir == "" {
+		return nil, errors.New("file provider: remote.file.dir is required")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &FileProvider{
+		dir:      dir,
+		interval: cfgMillis(cfg, "interval", 5*time.Second),
+		ctx:      ctx,
+		cancel:   cancel,
+	}, nil
+}
+
+// Fetch 实现 sys.ConfigProvider
+func (p *FileProvider) Fetch(item sys.ConfigItem) (string, error) {
+	for _, path := range []string{
+		filepath.Join(p.dir, item.Group, item.DataId),
+		filepath.Join(p.dir, item.DataId),
+	} {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return string(data), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%w: %s in %s", ErrConfigNotFound, item, p.dir)
+}
+
+// Watch 实现 sys.ConfigProvider
+func (p *FileProvider) Watch(item sys.ConfigItem, onChange func(data string)) error {
+	last, _ := p.Fetch(item)
+	go pollWatch(p.ctx, p.interval, item, last, p.Fetch, onChange)
+	return nil
+}
+
+// Close 实现 sys.ConfigProvider
+func (p *FileProvider) Close() error {
+	p.cancel()
+	return nil
+}
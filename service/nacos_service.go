@@ -2,6 +2,7 @@ package service
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/EricJSanchez/gotool/sys"
@@ -14,21 +15,55 @@ import (
 	"github.com/spf13/viper"
 	"log"
 	"net"
+	"net/http"
+	"net/url"
 	"strconv"
-	"strings"
 	"sync"
+	"time"
 )
 
-var onceNacos sync.Once
+var (
+	onceNacos       sync.Once
+	onceNacosClient sync.Once
+	nacosMu         sync.Mutex
+)
 
 type Nacos struct {
 	NamingClient naming_client.INamingClient
 	ConfigClient map[string]config_client.IConfigClient
+
+	configClient config_client.IConfigClient
+	clientErr    error
+	watched      []vo.ConfigParam
 }
 
-// InitClient 初始化
+// InitClient 初始化，按 app.toml 的 remote.provider 选择配置中心，缺省为 nacos；
+// 使用其他配置中心时不创建 Nacos 客户端
 func (n *Nacos) InitClient() error {
 	onceNacos.Do(func() {
+		var p sys.ConfigProvider = n
+		if name := sys.Cfg("app").GetString("remote.provider"); name != "" && name != "nacos" {
+			var err error
+			if p, err = sys.NewConfigProvider(name); err != nil {
+				panic("init remote config error:" + cast.ToString(err))
+			}
+		} else if err := n.initClients(); err != nil {
+			panic("init nacos error:" + cast.ToString(err))
+			//sys.Log().WithError(err).Error("init nacos error")
+			//return
+		}
+		// 下面开始初始化配置文件监听，根据data_id和group
+		if err := sys.LoadRemoteConfig(p, sys.RemoteConfigItems()); err != nil {
+			fmt.Println("NewInitConfig error:" + cast.ToString(err))
+			panic(err)
+		}
+	})
+	return nil
+}
+
+// 创建服务发现与动态配置客户端
+func (n *Nacos) initClients() error {
+	onceNacosClient.Do(func() {
 		clientConfig := *constant.NewClientConfig(
 			constant.WithNamespaceId(sys.Cfg("app").GetString("nacos.namespace_id")),
 			constant.WithTimeoutMs(uint64(sys.Cfg("app").GetInt("nacos.timeout"))),
@@ -46,68 +81,135 @@ func (n *Nacos) InitClient() error {
 				Scheme:      sys.Cfg("app").GetString("nacos.scheme"),
 			},
 		}
-		var err error
-		if n.NamingClient, err = clients.NewNamingClient(
-			vo.NacosClientParam{
-				ClientConfig:  &clientConfig,
-				ServerConfigs: serverConfigs,
-			},
-		); err != nil {
-			panic("init nacos error:" + cast.ToString(err))
-			//sys.Log().WithError(err).Error("init nacos error")
-			//return
+		param := vo.NacosClientParam{
+			ClientConfig:  &clientConfig,
+			ServerConfigs: serverConfigs,
 		}
-
-		// 下面开始初始化配置文件监听，根据data_id和group
-		ns := sys.Cfg("app").GetStringSlice("nacos.group_data_ids")
-		sys.NacosConfig = make(map[string]string, len(ns))
-		n.ConfigClient = make(map[string]config_client.IConfigClient, len(ns))
-		for _, nv := range ns {
-			tmpConf := strings.Split(nv, ":")
-			if len(tmpConf) != 2 {
-				fmt.Println("配置有误：" + nv)
-				continue
-			}
-			// 创建动态配置客户端
-			if n.ConfigClient[tmpConf[0]], err = clients.NewConfigClient(
-				vo.NacosClientParam{
-					ClientConfig:  &clientConfig,
-					ServerConfigs: serverConfigs,
-				},
-			); err != nil {
-				fmt.Println("init nacos error:" + cast.ToString(err))
-				return
-			}
-			n.NewInitConfig(tmpConf[0], tmpConf[1])
+		if n.NamingClient, n.clientErr = clients.NewNamingClient(param); n.clientErr != nil {
+			return
 		}
+		// 创建动态配置客户端
+		if n.configClient, n.clientErr = clients.NewConfigClient(param); n.clientErr != nil {
+			return
+		}
+		n.ConfigClient = make(map[string]config_client.IConfigClient)
 	})
-	return nil
+	return n.clientErr
 }
 
-// NewInitConfig 初始化配置文件监听
+// NewInitConfig 初始化配置文件监听，使用 InitClient 选择的配置中心
 func (n *Nacos) NewInitConfig(dataId, group string) {
-	var err error
-	if sys.NacosConfig[dataId], err = n.ConfigClient[dataId].GetConfig(vo.ConfigParam{
-		DataId: dataId,
-		Group:  group,
-	}); err != nil {
+	item := sys.ConfigItem{DataId: dataId, Group: group}
+	p := sys.RemoteConfigProvider()
+	if p == nil {
+		p = n
+	}
+	if err := sys.LoadRemoteConfig(p, []sys.ConfigItem{item}); err != nil {
 		fmt.Println("NewInitConfig error:" + cast.ToString(err))
 		panic(err)
 	}
-	//helper.Pr(dataId, sys.NacosConfig)
-	err = n.ConfigClient[dataId].ListenConfig(vo.ConfigParam{
-		DataId: dataId,
-		Group:  group,
+}
+
+// Fetch 实现 sys.ConfigProvider，读取配置内容
+func (n *Nacos) Fetch(item sys.ConfigItem) (string, error) {
+	if n.configClient == nil {
+		return "", errors.New("nacos config client not initialized")
+	}
+	nacosMu.Lock()
+	n.ConfigClient[item.DataId] = n.configClient
+	nacosMu.Unlock()
+	return n.configClient.GetConfig(vo.ConfigParam{
+		DataId: item.DataId,
+		Group:  item.Group,
+	})
+}
+
+// Watch 实现 sys.ConfigProvider，监听配置变更
+func (n *Nacos) Watch(item sys.ConfigItem, onChange func(data string)) error {
+	if n.configClient == nil {
+		return errors.New("nacos config client not initialized")
+	}
+	param := vo.ConfigParam{
+		DataId: item.DataId,
+		Group:  item.Group,
 		OnChange: func(namespace, group, dataId, data string) {
 			//nacos变更,更新本地
-			fmt.Println(dataId+" nacos changed:", data)
-			sys.ResetCfgKey(dataId)
-			sys.NacosConfig[dataId] = data
+			onChange(data)
 		},
-	})
+	}
+	if err := n.configClient.ListenConfig(param); err != nil {
+		return err
+	}
+	nacosMu.Lock()
+	n.watched = append(n.watched, param)
+	nacosMu.Unlock()
+	return nil
+}
+
+// Close 实现 sys.ConfigProvider，取消所有配置监听，服务发现客户端不受影响
+func (n *Nacos) Close() error {
+	nacosMu.Lock()
+	watched := n.watched
+	n.watched = nil
+	nacosMu.Unlock()
+	var err error
+	for _, param := range watched {
+		if e := n.configClient.CancelListenConfig(param); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Format 实现 sys.ConfigFormatter，通过 Nacos 开放接口读取配置的类型（yaml、json、properties 等），
+// SDK 不返回该信息
+func (n *Nacos) Format(item sys.ConfigItem) (string, error) {
+	app := sys.Cfg("app")
+	scheme := app.GetString("nacos.scheme")
+	if scheme == "" {
+		scheme = "http"
+	}
+	base := fmt.Sprintf("%s://%s:%d/nacos", scheme, app.GetString("nacos.addr"), app.GetInt("nacos.port"))
+	client := &http.Client{Timeout: cfgMillis(app, "nacos.timeout", 5*time.Second)}
+	query := url.Values{
+		"show":   {"all"},
+		"dataId": {item.DataId},
+		"group":  {item.Group},
+		"tenant": {app.GetString("nacos.namespace_id")},
+	}
+	if username := app.GetString("nacos.username"); username != "" {
+		resp, err := client.PostForm(base+"/v1/auth/login", url.Values{
+			"username": {username},
+			"password": {app.GetString("nacos.password")},
+		})
+		if err != nil {
+			return "", err
+		}
+		var login struct {
+			AccessToken string `json:"accessToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&login)
+		_ = resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("nacos login: %w", err)
+		}
+		query.Set("accessToken", login.AccessToken)
+	}
+	resp, err := client.Get(base + "/v1/cs/configs?" + query.Encode())
 	if err != nil {
-		fmt.Println(err)
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("nacos config detail: %s", resp.Status)
+	}
+	var detail struct {
+		Type string `json:"type"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&detail); err != nil {
+		return "", fmt.Errorf("nacos config detail: %w", err)
 	}
+	return detail.Type, nil
 }
 
 func GetLocalIp() (string, error) {
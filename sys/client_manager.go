@@ -0,0 +1,311 @@
+package sys
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ClientOptions ClientManager 创建、检查、关闭客户端的方式
+type ClientOptions[T any] struct {
+	// Factory 根据数据源配置创建客户端，必填，可通过 DatasourceName(ctx) 获取数据源名称
+	Factory func(ctx context.Context, config map[string]interface{}) (T, error)
+	// HealthCheck 检查客户端是否可用，可选
+	HealthCheck func(ctx context.Context, client T) error
+	// Close 关闭客户端并释放连接，可选
+	Close func(client T) error
+	// GracePeriod 配置变更后旧客户端延迟关闭的时长，留给进行中的请求完成，缺省为 DefaultGracePeriod
+	GracePeriod time.Duration
+}
+
+// DefaultGracePeriod 被替换的客户端默认延迟关闭的时长
+var DefaultGracePeriod = 30 * time.Second
+
+// ClientManager 按数据源名称与配置摘要缓存客户端，配置变化后会创建新的客户端，
+// 同名的旧客户端在 GracePeriod 之后关闭
+type ClientManager[T any] struct {
+	kind    string
+	opts    ClientOptions[T]
+	rw      sync.RWMutex
+	clients map[string]*clientEntry[T]
+	retired map[*clientEntry[T]]*time.Timer // 等待关闭的旧客户端
+}
+
+type clientEntry[T any] struct {
+	name   string
+	client T
+}
+
+// NewClientManager 创建客户端管理器，kind 为数据源类型，用于错误信息
+func NewClientManager[T any](kind string, opts ClientOptions[T]) *ClientManager[T] {
+	return &ClientManager[T]{
+		kind:    kind,
+		opts:    opts,
+		clients: make(map[string]*clientEntry[T]),
+		retired: make(map[*clientEntry[T]]*time.Timer),
+	}
+}
+
+// Kind 返回数据源类型
+func (m *ClientManager[T]) Kind() string {
+	return m.kind
+}
+
+// Get 获取 name 对应的客户端，不存在时使用 config 创建，创建失败的客户端不会被缓存
+func (m *ClientManager[T]) Get(ctx context.Context, name string, config map[string]interface{}) (T, error) {
+	key := clientKey(name, config)
+	// 1、获取连接实例
+	m.rw.RLock()
+	if e, exists := m.clients[key]; exists {
+		m.rw.RUnlock()
+		return e.client, nil
+	}
+	m.rw.RUnlock()
+
+	// 获取读写锁
+	m.rw.Lock()
+	defer m.rw.Unlock()
+
+	if e, exists := m.clients[key]; exists {
+		return e.client, nil
+	}
+	// 2、添加连接实例
+	client, err := m.opts.Factory(context.WithValue(ctx, datasourceNameCtxKey{}, name), config)
+	if err != nil {
+		var zero T
+		return zero, datasourceError(m.kind, name, err)
+	}
+	// 3、同名数据源的配置已变化，旧客户端延迟关闭
+	for k, e := range m.clients {
+		if e.name == name {
+			delete(m.clients, k)
+			m.retire(e)
+		}
+	}
+	m.clients[key] = &clientEntry[T]{name: name, client: client}
+	return client, nil
+}
+
+type datasourceNameCtxKey struct{}
+
+// DatasourceName 返回 ClientOptions.Factory 中正在创建的数据源名称
+func DatasourceName(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	name, _ := ctx.Value(datasourceNameCtxKey{}).(string)
+	return name
+}
+
+// 在 GracePeriod 之后关闭旧客户端，需持有写锁
+func (m *ClientManager[T]) retire(e *clientEntry[T]) {
+	if m.opts.Close == nil {
+		return
+	}
+	grace := m.opts.GracePeriod
+	if grace <= 0 {
+		grace = DefaultGracePeriod
+	}
+	m.retired[e] = time.AfterFunc(grace, func() {
+		m.rw.Lock()
+		_, ok := m.retired[e]
+		delete(m.retired, e)
+		m.rw.Unlock()
+		if ok {
+			m.closeEntry(e)
+		}
+	})
+}
+
+func (m *ClientManager[T]) closeEntry(e *clientEntry[T]) error {
+	if err := m.opts.Close(e.client); err != nil {
+		fmt.Println("close", m.kind, e.name, "err:", err)
+		return err
+	}
+	return nil
+}
+
+// HealthCheck 检查所有已创建的客户端，返回数据源名称到检查结果的映射，未设置 HealthCheck 时结果均为 nil
+func (m *ClientManager[T]) HealthCheck(ctx context.Context) map[string]error {
+	m.rw.RLock()
+	entries := make([]*clientEntry[T], 0, len(m.clients))
+	for _, e := range m.clients {
+		entries = append(entries, e)
+	}
+	m.rw.RUnlock()
+	ret := make(map[string]error, len(entries))
+	for _, e := range entries {
+		var err error
+		if m.opts.HealthCheck != nil {
+			err = m.opts.HealthCheck(ctx, e.client)
+		}
+		if err != nil {
+			err = &DatasourceError{Kind: m.kind, Name: e.name, Err: ErrConnectFailed, Cause: err}
+		}
+		ret[e.name] = err
+	}
+	return ret
+}
+
+// Names 返回已创建客户端的数据源名称
+func (m *ClientManager[T]) Names() []string {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+	set := make(map[string]bool, len(m.clients))
+	for _, e := range m.clients {
+		set[e.name] = true
+	}
+	return sortedKeys(set)
+}
+
+// Clear 清空客户端实例，之后获取时重新创建，已清空的客户端在 GracePeriod 之后关闭
+func (m *ClientManager[T]) Clear() {
+	m.rw.Lock()
+	defer m.rw.Unlock()
+	for k, e := range m.clients {
+		delete(m.clients, k)
+		m.retire(e)
+	}
+}
+
+// Close 立即关闭所有客户端，包括等待关闭的旧客户端，ctx 结束时不再等待尚未关闭完成的客户端
+func (m *ClientManager[T]) Close(ctx context.Context) error {
+	m.rw.Lock()
+	entries := make([]*clientEntry[T], 0, len(m.clients)+len(m.retired))
+	for k, e := range m.clients {
+		delete(m.clients, k)
+		entries = append(entries, e)
+	}
+	for e, t := range m.retired {
+		t.Stop()
+		delete(m.retired, e)
+		entries = append(entries, e)
+	}
+	m.rw.Unlock()
+	if m.opts.Close == nil || len(entries) == 0 {
+		return nil
+	}
+	errs := make(chan error, len(entries))
+	for _, e := range entries {
+		go func(e *clientEntry[T]) {
+			errs <- m.closeEntry(e)
+		}(e)
+	}
+	var firstErr error
+	for range entries {
+		select {
+		case err := <-errs:
+			if err != nil && firstErr == nil {
+				firstErr = &DatasourceError{Kind: m.kind, Err: ErrCloseFailed, Cause: err}
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return firstErr
+}
+
+// 数据源名称加配置摘要，配置变化后得到新的键
+func clientKey(name string, config map[string]interface{}) string {
+	connectUniq, _ := json.Marshal(config)
+	return name + Md5(string(connectUniq))
+}
+
+// datasourceManager 注册表中的数据源，屏蔽客户端类型
+type datasourceManager interface {
+	Kind() string
+	HealthCheck(ctx context.Context) map[string]error
+	Names() []string
+	Clear()
+	Close(ctx context.Context) error
+}
+
+var (
+	datasources   = make(map[string]datasourceManager)
+	datasourcesRw sync.RWMutex
+)
+
+func addDatasource(m datasourceManager) {
+	datasourcesRw.Lock()
+	datasources[m.Kind()] = m
+	datasourcesRw.Unlock()
+}
+
+// Datasources 返回已注册的数据源类型
+func Datasources() []string {
+	datasourcesRw.RLock()
+	defer datasourcesRw.RUnlock()
+	kinds := make([]string, 0, len(datasources))
+	for kind := range datasources {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// DatasourceHealth 检查所有数据源已创建的客户端，返回 数据源类型 -> 数据源名称 -> 检查结果
+func DatasourceHealth(ctx context.Context) map[string]map[string]error {
+	datasourcesRw.RLock()
+	list := make([]datasourceManager, 0, len(datasources))
+	for _, m := range datasources {
+		list = append(list, m)
+	}
+	datasourcesRw.RUnlock()
+	ret := make(map[string]map[string]error, len(list))
+	for _, m := range list {
+		ret[m.Kind()] = m.HealthCheck(ctx)
+	}
+	return ret
+}
+
+// CloseAll 关闭所有数据源的客户端，用于服务退出，ctx 结束时返回 ctx.Err()
+func CloseAll(ctx context.Context) error {
+	datasourcesRw.RLock()
+	list := make([]datasourceManager, 0, len(datasources))
+	for _, m := range datasources {
+		list = append(list, m)
+	}
+	datasourcesRw.RUnlock()
+	var firstErr error
+	for _, m := range list {
+		if err := m.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Datasource 通过 RegisterDatasource 注册的数据源，配置的读取方式与 sys.Gorm 相同
+type Datasource[T any] struct {
+	Kind    string // 数据源类型，如 kafka
+	AppKey  string // app.toml 中默认数据源名称的配置项，如 default_kafka
+	Manager *ClientManager[T]
+}
+
+// RegisterDatasource 注册新的数据源类型，如 Kafka、MongoDB、ClickHouse。
+// 数据源配置与数据库相同，开发环境读取本地 db.toml，其余环境读取 Nacos 的 database.toml，
+// 同名类型重复注册时后者生效
+//
+//	var kafka = sys.RegisterDatasource("kafka", "default_kafka", sys.ClientOptions[*kafka.Writer]{
+//		Factory: newKafkaWriter,
+//		Close:   func(w *kafka.Writer) error { return w.Close() },
+//	})
+//	w, err := kafka.Get(ctx, "kafka-order")
+func RegisterDatasource[T any](kind, appKey string, opts ClientOptions[T]) *Datasource[T] {
+	d := &Datasource[T]{Kind: kind, AppKey: appKey, Manager: NewClientManager(kind, opts)}
+	addDatasource(d.Manager)
+	return d
+}
+
+// Get 获取数据源客户端，names 为空时使用 app.toml 中 AppKey 对应的默认数据源
+func (d *Datasource[T]) Get(ctx context.Context, names ...string) (T, error) {
+	name, config, err := datasourceConfig(d.Kind, d.AppKey, names)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return d.Manager.Get(ctx, name, config)
+}
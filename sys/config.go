@@ -9,10 +9,22 @@ import (
 )
 import "github.com/spf13/viper"
 
+// 公共配置目录，依次查找，命中第一个即停止
+var commonConfigDirs = []string{"common", "base"}
+
 type configuration struct {
-	paths  []string
-	vipers map[string]*viper.Viper
-	sync.Mutex
+	paths   []string
+	vipers  map[string]*viper.Viper
+	layers  map[string][]*cfgLayer
+	watcher *cfgWatcher
+	sync.RWMutex
+}
+
+// cfgLayer 参与合并的一层配置
+type cfgLayer struct {
+	Kind     string // default、file、nacos、env、flag
+	Source   string // 来源，文件为路径
+	Settings map[string]interface{}
 }
 
 var configLocal *configuration
@@ -21,16 +33,25 @@ func InitConfig(configPath ...string) {
 	if len(configPath) == 0 {
 		configPath = []string{"../../configs", "configs", "../configs"}
 	}
+	if configLocal != nil {
+		StopCfgWatch()
+	}
 	configLocal = &configuration{
 		paths:  configPath,
 		vipers: make(map[string]*viper.Viper),
+		layers: make(map[string][]*cfgLayer),
 	}
 }
 
 func (c *configuration) getConfigFile(file string, env environment.Env) string {
+	return c.findFile(string(env), file+".toml")
+}
+
+// 在所有配置根目录中查找 dir/name，返回第一个存在的文件
+func (c *configuration) findFile(dir, name string) string {
 	configFile := ""
 	for _, path := range c.paths {
-		tmpConfigFile := fmt.Sprintf("%s/%s/%s.toml", path, env, file)
+		tmpConfigFile := fmt.Sprintf("%s/%s/%s", path, dir, name)
 		if _, err := os.Stat(tmpConfigFile); err == nil {
 			configFile = tmpConfigFile
 			break
@@ -39,37 +60,119 @@ func (c *configuration) getConfigFile(file string, env environment.Env) string {
 	return configFile
 }
 
+// 按优先级从低到高返回 file 对应的所有配置文件
+func (c *configuration) layerFiles(file string, env environment.Env) (files []string) {
+	for _, dir := range commonConfigDirs {
+		if f := c.findFile(dir, file+".toml"); f != "" {
+			files = append(files, f)
+			break
+		}
+	}
+	if f := c.getConfigFile(file, env); f != "" {
+		files = append(files, f)
+	}
+	if f := c.findFile(string(env), file+".local.toml"); f != "" {
+		files = append(files, f)
+	}
+	return
+}
+
+// 读取 file 的各层配置
+func (c *configuration) loadLayers(file string) ([]*cfgLayer, error) {
+	files := c.layerFiles(file, Env())
+	if len(files) == 0 {
+		return nil, fmt.Errorf("config file %s.toml not found in %v", file, c.paths)
+	}
+	return readLayers(files)
+}
+
+// 依次读取配置文件，每个文件为一层
+func readLayers(files []string) ([]*cfgLayer, error) {
+	layers := make([]*cfgLayer, 0, len(files))
+	for _, f := range files {
+		vp := viper.New()
+		vp.SetConfigFile(f)
+		if err := vp.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("read %s: %w", f, err)
+		}
+		layers = append(layers, &cfgLayer{Kind: "file", Source: f, Settings: vp.AllSettings()})
+	}
+	return layers, nil
+}
+
+// Cfg 读取本地配置，同名文件按以下顺序逐层深度合并，后者覆盖前者：
+//
+//  0. sys.SetCfgDefault 设置的默认值
+//  1. configs/common/<file>.toml（或 configs/base/<file>.toml）公共配置
+//  2. configs/<env>/<file>.toml 环境配置
+//  3. configs/<env>/<file>.local.toml 本机覆盖，不提交到 git
+//  4. 环境变量 GOTOOL_<FILE>__<KEY>__<SUBKEY>，如 GOTOOL_APP__NACOS__ADDR
+//  5. 命令行 --set <file>.<key>=<value> 或 sys.SetCfg，如 --set app.nacos.addr=127.0.0.1
+//
+// 嵌套的表按键逐级合并，数组及其他值整体替换。
+// 形如 ENC(...) 的值在合并后使用 SetCfgKeyProvider 设置的密钥透明解密。
+// 可通过 CfgExplain 查看某个配置项的来源。
+// 读取过的文件会被监听，修改后自动重新加载，可通过 OnCfgChange 订阅变更。
 func Cfg(file string) *viper.Viper {
-	if cfg, ok := configLocal.vipers[file]; ok {
+	// 未调用 InitConfig，如直接使用 sqlite 数据源的单元测试
+	if configLocal == nil {
+		return nil
+	}
+	configLocal.RLock()
+	cfg, ok := configLocal.vipers[file]
+	configLocal.RUnlock()
+	if ok {
 		return cfg
 	}
 	configLocal.Lock()
 	defer configLocal.Unlock()
-	// 读取基础配置
-	baseConfig := viper.New()
-	baseConfigFile := configLocal.getConfigFile(file, Env())
-	baseConfig.SetConfigFile(baseConfigFile)
-	err := baseConfig.ReadInConfig()
+	if cfg, ok := configLocal.vipers[file]; ok {
+		return cfg
+	}
+	layers, err := configLocal.loadLayers(file)
 	if err != nil {
 		fmt.Println("Cfg err:", err)
 		return nil
 	}
-	// 将基础配置全部以默认配置写入
-	envConfig := viper.New()
-	for k, v := range baseConfig.AllSettings() {
-		envConfig.SetDefault(k, v)
-	}
-	envConfigFile := configLocal.getConfigFile(file, Env())
-	if envConfigFile != "" {
-		envConfig.SetConfigFile(envConfigFile)
-		err = envConfig.ReadInConfig()
-		if err != nil {
-			fmt.Println("Cfg err 2:", err)
-			return nil
+	configLocal.layers[file], configLocal.vipers[file] = buildViper(file, layers)
+	configLocal.watch()
+	return configLocal.vipers[file]
+}
+
+// 将各层配置连同默认值、环境变量、命令行覆盖深度合并为一个 viper 实例，返回完整的层列表
+func buildViper(file string, layers []*cfgLayer) ([]*cfgLayer, *viper.Viper) {
+	if l := defaultLayer(file); l != nil {
+		layers = append([]*cfgLayer{l}, layers...)
+	}
+	merged := make(map[string]interface{})
+	for _, l := range layers {
+		mergeSettings(merged, l.Settings)
+	}
+	overrides := overrideLayers(file, merged)
+	for _, l := range overrides {
+		mergeSettings(merged, l.Settings)
+	}
+	decryptSettings(file, merged)
+	vp := viper.New()
+	_ = vp.MergeConfigMap(merged)
+	return append(layers, overrides...), vp
+}
+
+// 将 src 深度合并到 dst，两边均为表时递归合并，否则 src 覆盖 dst
+func mergeSettings(dst, src map[string]interface{}) {
+	for k, sv := range src {
+		if sm, ok := sv.(map[string]interface{}); ok {
+			if dm, ok := dst[k].(map[string]interface{}); ok {
+				mergeSettings(dm, sm)
+				continue
+			}
+			cp := make(map[string]interface{}, len(sm))
+			mergeSettings(cp, sm)
+			dst[k] = cp
+			continue
 		}
+		dst[k] = sv
 	}
-	configLocal.vipers[file] = envConfig
-	return envConfig
 }
 
 func ResetCfgKey(file string) {
@@ -78,6 +181,7 @@ func ResetCfgKey(file string) {
 	if _, ok := configLocal.vipers[file]; ok {
 		delete(configLocal.vipers, file)
 	}
+	delete(configLocal.layers, file)
 }
 
 func GetRunFuncName() string {
@@ -0,0 +1,391 @@
+package sys
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// CfgFieldError 单个配置项的校验错误
+type CfgFieldError struct {
+	Key   string      // 配置项完整路径，如 nacos.addr
+	Rule  string      // 未通过的规则，如 required、min、url
+	Value interface{} // 实际读取到的值
+	Msg   string
+}
+
+func (e CfgFieldError) Error() string {
+	return e.Key + ": " + e.Msg
+}
+
+// CfgError 汇总一个配置文件中所有不合法的配置项
+type CfgError struct {
+	File   string
+	Fields []CfgFieldError
+}
+
+func (e *CfgError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Error())
+	}
+	return fmt.Sprintf("config %s: %d invalid key(s): %s", e.File, len(e.Fields), strings.Join(msgs, "; "))
+}
+
+// CfgAs 将本地配置文件（或其中的 keys 子树）绑定到结构体 T，并按 validate 标签校验
+//
+// 支持的标签：
+//
+//	mapstructure:"name"  配置项名称，缺省为字段名（大小写不敏感）
+//	default:"value"      配置项缺失时使用的默认值
+//	validate:"rules"     逗号分隔的校验规则：required、min=N、max=N、oneof=a b c、
+//	                     url、hostname、host、hostport、ip
+//
+// T 的结构会通过 RegisterCfgSchema 登记，供 LintCfg 检查使用。
+func CfgAs[T any](file string, keys ...string) (T, error) {
+	RegisterCfgSchema[T](file, keys...)
+	return ViperAs[T](Cfg(file), file, keys...)
+}
+
+// NacosAs 与 CfgAs 相同，数据来源为 sys.Nacos 返回的远程配置
+func NacosAs[T any](file string, keys ...string) (T, error) {
+	RegisterCfgSchema[T](file, keys...)
+	return ViperAs[T](Nacos(file), file, keys...)
+}
+
+// ViperAs 将任意 viper 实例绑定到结构体 T，name 仅用于错误信息
+func ViperAs[T any](vp *viper.Viper, name string, keys ...string) (ret T, err error) {
+	if vp == nil {
+		return ret, fmt.Errorf("config %s: not found", name)
+	}
+	prefix := strings.Join(keys, ".")
+	var input interface{}
+	if prefix == "" {
+		input = vp.AllSettings()
+	} else {
+		input = vp.Get(prefix)
+	}
+	cfgErr := &CfgError{File: name}
+	if input != nil {
+		decoder, _ := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			Result:           &ret,
+			WeaklyTypedInput: true,
+			DecodeHook: mapstructure.ComposeDecodeHookFunc(
+				mapstructure.StringToTimeDurationHookFunc(),
+				mapstructure.StringToSliceHookFunc(","),
+			),
+		})
+		if err = decoder.Decode(input); err != nil {
+			cfgErr.Fields = append(cfgErr.Fields, decodeFieldErrors(prefix, err)...)
+		}
+	}
+	rv := reflect.ValueOf(&ret).Elem()
+	if rv.Kind() == reflect.Struct {
+		b := binder{vp: vp, err: cfgErr}
+		b.walk(rv, prefix)
+	}
+	if len(cfgErr.Fields) > 0 {
+		return ret, cfgErr
+	}
+	return ret, nil
+}
+
+// mapstructure 的错误形如 "'port' expected type 'int', got ..." 或 "cannot parse 'Port' as int: ..."，
+// 拆分为逐项错误，取第一个引号内的字段名作为 key
+func decodeFieldErrors(prefix string, err error) (fields []CfgFieldError) {
+	msgs := []string{err.Error()}
+	if me, ok := err.(*mapstructure.Error); ok {
+		msgs = me.Errors
+	}
+	for _, msg := range msgs {
+		key := prefix
+		if start := strings.Index(msg, "'"); start >= 0 {
+			if end := strings.Index(msg[start+1:], "'"); end >= 0 {
+				key = joinKey(prefix, strings.ToLower(msg[start+1:start+1+end]))
+				if start == 0 {
+					msg = strings.TrimSpace(msg[end+2:])
+				}
+			}
+		}
+		fields = append(fields, CfgFieldError{Key: key, Rule: "type", Msg: msg})
+	}
+	return
+}
+
+type binder struct {
+	vp  *viper.Viper
+	err *CfgError
+}
+
+func (b *binder) fail(key, rule string, value interface{}, format string, args ...interface{}) {
+	b.err.Fields = append(b.err.Fields, CfgFieldError{
+		Key:   key,
+		Rule:  rule,
+		Value: value,
+		Msg:   fmt.Sprintf(format, args...),
+	})
+}
+
+func (b *binder) failed(key string) bool {
+	for _, f := range b.err.Fields {
+		if f.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// 递归处理结构体字段：填充默认值并执行校验
+func (b *binder) walk(rv reflect.Value, prefix string) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name, squash := fieldKey(sf)
+		if name == "-" {
+			continue
+		}
+		key := joinKey(prefix, name)
+		if squash {
+			key = prefix
+		}
+		fv := rv.Field(i)
+		set := key != "" && b.vp.IsSet(key)
+
+		if def, ok := sf.Tag.Lookup("default"); ok && !set && fv.IsZero() {
+			if err := setFromString(fv, def); err != nil {
+				b.fail(key, "default", def, "invalid default: %v", err)
+			}
+			set = true
+		}
+		// 类型错误时字段为零值，不再重复报校验错误
+		if rules := sf.Tag.Get("validate"); rules != "" && !b.failed(key) {
+			b.validate(key, fv, set, rules)
+		}
+
+		switch fv.Kind() {
+		case reflect.Struct:
+			if fv.Type() != reflect.TypeOf(time.Time{}) {
+				b.walk(fv, key)
+			}
+		case reflect.Ptr:
+			if !fv.IsNil() && fv.Elem().Kind() == reflect.Struct {
+				b.walk(fv.Elem(), key)
+			}
+		case reflect.Slice, reflect.Array:
+			for j := 0; j < fv.Len(); j++ {
+				if ev := reflect.Indirect(fv.Index(j)); ev.Kind() == reflect.Struct {
+					b.walkElem(ev, fmt.Sprintf("%s[%d]", key, j))
+				}
+			}
+		}
+	}
+}
+
+// 切片元素没有对应的 viper 路径，仅做校验
+func (b *binder) walkElem(rv reflect.Value, prefix string) {
+	sub := &binder{vp: viper.New(), err: b.err}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name, _ := fieldKey(sf)
+		if name == "-" {
+			continue
+		}
+		fv := rv.Field(i)
+		if rules := sf.Tag.Get("validate"); rules != "" {
+			sub.validate(joinKey(prefix, name), fv, !fv.IsZero(), rules)
+		}
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+			sub.walkElem(fv, joinKey(prefix, name))
+		}
+	}
+}
+
+var hostnameRegexp = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?)(\.[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?)*\.?$`)
+
+// 未配置且为零值的可选项只校验 required，与 url、hostname 等规则跳过空值一致
+func (b *binder) validate(key string, fv reflect.Value, set bool, rules string) {
+	val := fv.Interface()
+	absent := !set && fv.IsZero()
+	for _, rule := range strings.Split(rules, ",") {
+		rule = strings.TrimSpace(rule)
+		name, arg := rule, ""
+		if idx := strings.Index(rule, "="); idx >= 0 {
+			name, arg = rule[:idx], rule[idx+1:]
+		}
+		switch name {
+		case "":
+		case "required":
+			if absent {
+				b.fail(key, name, val, "is required")
+				return
+			}
+		case "min", "max":
+			if absent {
+				continue
+			}
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				b.fail(key, name, val, "invalid rule %q", rule)
+				continue
+			}
+			n, isLen := measure(fv)
+			if (name == "min" && n < limit) || (name == "max" && n > limit) {
+				what := "value"
+				if isLen {
+					what = "length"
+				}
+				b.fail(key, name, val, "%s %v out of range (%s %s)", what, n, name, arg)
+			}
+		case "oneof":
+			if absent {
+				continue
+			}
+			s := cast.ToString(val)
+			if !inStrings(s, strings.Fields(arg)) {
+				b.fail(key, name, val, "%q is not one of [%s]", s, arg)
+			}
+		case "url":
+			s := cast.ToString(val)
+			if u, err := url.Parse(s); s != "" && (err != nil || u.Scheme == "" || u.Host == "") {
+				b.fail(key, name, val, "%q is not a valid url", s)
+			}
+		case "hostname":
+			if s := cast.ToString(val); s != "" && !hostnameRegexp.MatchString(s) {
+				b.fail(key, name, val, "%q is not a valid hostname", s)
+			}
+		case "host":
+			if s := cast.ToString(val); s != "" && net.ParseIP(s) == nil && !hostnameRegexp.MatchString(s) {
+				b.fail(key, name, val, "%q is not a valid host", s)
+			}
+		case "hostport":
+			s := cast.ToString(val)
+			if s == "" {
+				continue
+			}
+			host, port, err := net.SplitHostPort(s)
+			if p, perr := strconv.Atoi(port); err != nil || perr != nil || p <= 0 || p > 65535 ||
+				(net.ParseIP(host) == nil && !hostnameRegexp.MatchString(host)) {
+				b.fail(key, name, val, "%q is not a valid host:port", s)
+			}
+		case "ip":
+			if s := cast.ToString(val); s != "" && net.ParseIP(s) == nil {
+				b.fail(key, name, val, "%q is not a valid ip", s)
+			}
+		default:
+			b.fail(key, name, val, "unknown rule %q", rule)
+		}
+	}
+}
+
+// 数值返回其值，字符串、切片、map 返回其长度
+func measure(fv reflect.Value) (float64, bool) {
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), false
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return float64(fv.Len()), true
+	}
+	return 0, false
+}
+
+func setFromString(fv reflect.Value, s string) error {
+	if fv.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err == nil {
+			fv.SetInt(int64(d))
+		}
+		return err
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(v)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", fv.Type())
+		}
+		// 支持 type Tags []string 及 []MyString 等命名类型
+		parts := strings.Split(s, ",")
+		list := reflect.MakeSlice(fv.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			list.Index(i).SetString(part)
+		}
+		fv.Set(list)
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
+
+// 返回字段对应的配置项名称，以及是否为 squash 嵌入字段
+func fieldKey(sf reflect.StructField) (string, bool) {
+	tag := sf.Tag.Get("mapstructure")
+	name := strings.Split(tag, ",")[0]
+	squash := strings.Contains(tag, ",squash")
+	if name == "" {
+		name = strings.ToLower(sf.Name)
+	}
+	return name, squash
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	if key == "" {
+		return prefix
+	}
+	return prefix + "." + key
+}
+
+func inStrings(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+package sys
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// CfgSecretKeys 键名中包含这些片段的配置项在输出时会被隐藏
+var CfgSecretKeys = []string{"password", "passwd", "secret", "token", "access_key", "private_key", "credential"}
+
+var (
+	cfgDefaults   = make(map[string]map[string]interface{})
+	cfgDefaultsRw sync.RWMutex
+)
+
+// SetCfgDefault 为配置项设置默认值，优先级最低，任何一层配置了该键都会覆盖它
+func SetCfgDefault(file, key string, value interface{}) {
+	cfgDefaultsRw.Lock()
+	if cfgDefaults[file] == nil {
+		cfgDefaults[file] = make(map[string]interface{})
+	}
+	setSettingPath(cfgDefaults[file], strings.Split(strings.ToLower(key), "."), value)
+	cfgDefaultsRw.Unlock()
+	if configLocal != nil {
+		ResetCfgKey(file)
+	}
+}
+
+// 默认值层，没有默认值时返回 nil
+func defaultLayer(file string) *cfgLayer {
+	cfgDefaultsRw.RLock()
+	defer cfgDefaultsRw.RUnlock()
+	if len(cfgDefaults[file]) == 0 {
+		return nil
+	}
+	settings := make(map[string]interface{})
+	mergeSettings(settings, cfgDefaults[file])
+	return &cfgLayer{Kind: "default", Source: "sys.SetCfgDefault", Settings: settings}
+}
+
+// CfgSource 参与解析某个配置项的一层
+type CfgSource struct {
+	Kind   string      // default、file、nacos、env、flag
+	Source string      // 文件路径、Nacos dataId/group、环境变量名或命令行参数
+	Found  bool        // 该层是否设置了这个键
+	Value  interface{} // 该层设置的值
+}
+
+// CfgExplanation 配置项的来源说明
+type CfgExplanation struct {
+	File    string
+	Key     string
+	Value   interface{} // 合并后的最终值
+	Sources []CfgSource // 按优先级从低到高排列
+	Winner  *CfgSource  // 最终生效的一层，没有任何一层设置时为 nil
+}
+
+func (e *CfgExplanation) String() string {
+	var b strings.Builder
+	value := formatCfgValue(e.Key, e.Value)
+	if e.Winner != nil && hasEncryptedCfgValue(e.Winner.Value) {
+		value = `"******"`
+	}
+	fmt.Fprintf(&b, "%s %s = %s\n", e.File, e.Key, value)
+	for i := len(e.Sources) - 1; i >= 0; i-- {
+		s := e.Sources[i]
+		mark := "  "
+		if e.Winner != nil && &e.Sources[i] == e.Winner {
+			mark = "=>"
+		}
+		value := "(not set)"
+		if s.Found {
+			value = formatCfgValue(e.Key, s.Value)
+		}
+		fmt.Fprintf(&b, "%s %-7s %s: %s\n", mark, s.Kind, s.Source, value)
+	}
+	return b.String()
+}
+
+// 读取 file 并返回其各层配置，file 可以是本地文件名或 Nacos dataId
+func cfgLayers(file string) ([]*cfgLayer, error) {
+	nacosConfigRw.RLock()
+	_, remote := NacosConfig[file]
+	nacosConfigRw.RUnlock()
+	var ok bool
+	if remote {
+		ok = Nacos(file) != nil
+	} else {
+		ok = Cfg(file) != nil
+	}
+	if !ok {
+		return nil, fmt.Errorf("config %s: not found", file)
+	}
+	configLocal.RLock()
+	defer configLocal.RUnlock()
+	return configLocal.layers[file], nil
+}
+
+// CfgExplain 说明配置项 key 的值来自哪里：依次列出参与合并的每一层及其取值，并指出最终生效的一层
+func CfgExplain(file, key string) (*CfgExplanation, error) {
+	layers, err := cfgLayers(file)
+	if err != nil {
+		return nil, err
+	}
+	key = strings.ToLower(key)
+	path := strings.Split(key, ".")
+	e := &CfgExplanation{File: file, Key: key}
+	envConsulted := false
+	for _, l := range layers {
+		value := lookupSetting(l.Settings, path)
+		if (l.Kind == "env" || l.Kind == "flag") && value == nil {
+			// 覆盖层每层只含一个键，与 key 无关的不列出
+			continue
+		}
+		if l.Kind == "env" {
+			envConsulted = true
+		}
+		e.Sources = append(e.Sources, CfgSource{Kind: l.Kind, Source: l.Source, Found: value != nil, Value: value})
+	}
+	if !envConsulted {
+		// 没有设置环境变量时也列出会被读取的变量名，便于排查
+		e.Sources = append(e.Sources, CfgSource{Kind: "env", Source: cfgEnvVar(file, path)})
+		sort.SliceStable(e.Sources, func(i, j int) bool {
+			return cfgKindOrder(e.Sources[i].Kind) < cfgKindOrder(e.Sources[j].Kind)
+		})
+	}
+	for i := range e.Sources {
+		if e.Sources[i].Found {
+			e.Winner = &e.Sources[i]
+		}
+	}
+	if vp := cfgViper(file); vp != nil {
+		e.Value = vp.Get(key)
+	}
+	return e, nil
+}
+
+// CfgDump 按键名排序输出合并后的完整配置，每项标注生效的来源，敏感配置项被隐藏
+func CfgDump(file string, w io.Writer) error {
+	layers, err := cfgLayers(file)
+	if err != nil {
+		return err
+	}
+	vp := cfgViper(file)
+	if vp == nil {
+		return fmt.Errorf("config %s: not found", file)
+	}
+	keys := vp.AllKeys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		path := strings.Split(key, ".")
+		source := "unknown"
+		value := formatCfgValue(key, vp.Get(key))
+		for i := len(layers) - 1; i >= 0; i-- {
+			if raw := lookupSetting(layers[i].Settings, path); raw != nil {
+				source = layers[i].Kind + " " + layers[i].Source
+				if hasEncryptedCfgValue(raw) {
+					value = `"******"`
+				}
+				break
+			}
+		}
+		if _, err = fmt.Fprintf(w, "%s = %s  # %s\n", key, value, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 返回已加载的配置，cfgLayers 之后调用
+func cfgViper(file string) *viper.Viper {
+	configLocal.RLock()
+	defer configLocal.RUnlock()
+	return configLocal.vipers[file]
+}
+
+// 配置项对应的环境变量名
+func cfgEnvVar(file string, path []string) string {
+	parts := make([]string, 0, len(path)+1)
+	parts = append(parts, strings.ToUpper(cfgEnvPrefix)+envName(file))
+	for _, p := range path {
+		parts = append(parts, envName(p))
+	}
+	return strings.Join(parts, "__")
+}
+
+func cfgKindOrder(kind string) int {
+	switch kind {
+	case "default":
+		return 0
+	case "file", "nacos":
+		return 1
+	case "env":
+		return 2
+	case "flag":
+		return 3
+	}
+	return 1
+}
+
+// 判断配置项是否为敏感信息
+func isSecretCfgKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range CfgSecretKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// 判断来源层中的值是否包含加密内容，解密后的明文不应被输出
+func hasEncryptedCfgValue(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return IsEncryptedCfgValue(v)
+	case []interface{}:
+		for _, item := range v {
+			if hasEncryptedCfgValue(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 隐藏敏感配置项的值，表会逐项处理
+func redactCfgValue(key string, value interface{}) interface{} {
+	if m, ok := value.(map[string]interface{}); ok {
+		ret := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			ret[k] = redactCfgValue(k, v)
+		}
+		return ret
+	}
+	if value != nil && isSecretCfgKey(key) {
+		return "******"
+	}
+	return value
+}
+
+func formatCfgValue(key string, value interface{}) string {
+	if value == nil {
+		return "<nil>"
+	}
+	value = redactCfgValue(key, value)
+	if s, ok := value.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,388 @@
+package sys
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/EricJSanchez/gotool/environment"
+)
+
+// CfgLintIssue LintCfg 发现的一个问题
+type CfgLintIssue struct {
+	Env    string // 所在环境或公共配置目录，跨环境的问题为空
+	File   string // sys.Cfg 的文件名或 sys.Nacos 的 dataId
+	Source string // 配置文件路径或 Nacos dataId/group，跨环境的问题为空
+	Key    string
+	Rule   string // parse、unknown、type、required
+	Msg    string
+}
+
+func (i CfgLintIssue) String() string {
+	env := i.Env
+	if env == "" {
+		env = "*"
+	}
+	where := i.File
+	if i.Source != "" {
+		where = i.Source
+	}
+	if i.Key == "" {
+		return fmt.Sprintf("[%s] %s: %s: %s", env, where, i.Rule, i.Msg)
+	}
+	return fmt.Sprintf("[%s] %s %s: %s: %s", env, where, i.Key, i.Rule, i.Msg)
+}
+
+// CfgLintOptions LintCfg 的检查范围
+type CfgLintOptions struct {
+	Envs   []string // 需要检查的环境，为空时为配置目录下除公共目录外的所有目录
+	Remote bool     // 是否同时检查已加载的远程配置（属于当前环境）
+}
+
+// LintCfg 读取各环境目录及公共目录下的全部配置文件（不含 .local.toml），
+// 按 RegisterCfgSchema 登记的结构检查未知配置项、类型不符、缺少必填项，
+// 并检查同一配置项在不同环境中的类型是否一致
+func LintCfg(opts CfgLintOptions) ([]CfgLintIssue, error) {
+	if configLocal == nil {
+		return nil, fmt.Errorf("config not initialized")
+	}
+	envs := opts.Envs
+	if len(envs) == 0 {
+		envs = configLocal.envDirs()
+	}
+	if len(envs) == 0 {
+		return nil, fmt.Errorf("no environment found in %v", configLocal.paths)
+	}
+	l := &cfgLinter{schemas: make(map[string]CfgSchema), checked: make(map[string]bool), kinds: make(map[string]map[string]map[string]string)}
+	for _, s := range CfgSchemas() {
+		l.schemas[s.File] = s
+	}
+	files := configLocal.lintFiles(envs)
+	for _, env := range envs {
+		for _, file := range files {
+			l.lintFile(env, file)
+		}
+	}
+	if opts.Remote {
+		l.lintRemote()
+	}
+	l.crossEnv(files)
+	return l.issues, nil
+}
+
+type cfgLinter struct {
+	schemas map[string]CfgSchema
+	checked map[string]bool                         // 已检查过的来源，公共配置只检查一次
+	kinds   map[string]map[string]map[string]string // file -> env -> key -> 值的类型
+	issues  []CfgLintIssue
+}
+
+func (l *cfgLinter) add(issue CfgLintIssue) {
+	l.issues = append(l.issues, issue)
+}
+
+func (l *cfgLinter) lintFile(env, file string) {
+	var files []string
+	for _, f := range configLocal.layerFiles(file, environment.Env(env)) {
+		if !strings.HasSuffix(f, ".local.toml") {
+			files = append(files, f)
+		}
+	}
+	schema, hasSchema := l.schemas[file]
+	if len(files) == 0 {
+		if hasSchema && schema.hasRequired() {
+			l.add(CfgLintIssue{Env: env, File: file, Rule: "required", Msg: "config file " + file + ".toml not found"})
+		}
+		return
+	}
+	merged := make(map[string]interface{})
+	if dl := defaultLayer(file); dl != nil {
+		mergeSettings(merged, dl.Settings)
+	}
+	for _, f := range files {
+		layers, err := readLayers([]string{f})
+		if err != nil {
+			if !l.checked[f] {
+				l.checked[f] = true
+				l.add(CfgLintIssue{Env: lintEnv(f), File: file, Source: f, Rule: "parse", Msg: err.Error()})
+			}
+			return
+		}
+		if !l.checked[f] {
+			l.checked[f] = true
+			if hasSchema {
+				l.lintSettings(lintEnv(f), file, f, schema, layers[0].Settings)
+			}
+		}
+		mergeSettings(merged, layers[0].Settings)
+	}
+	if hasSchema {
+		l.lintRequired(env, file, schema, merged)
+	}
+	if l.kinds[file] == nil {
+		l.kinds[file] = make(map[string]map[string]string)
+	}
+	l.kinds[file][env] = make(map[string]string)
+	for key, v := range flattenSettings("", merged) {
+		l.kinds[file][env][key] = cfgValueKind(v)
+	}
+}
+
+// 检查已加载的远程配置
+func (l *cfgLinter) lintRemote() {
+	nacosConfigRw.RLock()
+	ids := make([]string, 0, len(NacosConfig))
+	for id := range NacosConfig {
+		ids = append(ids, id)
+	}
+	nacosConfigRw.RUnlock()
+	sort.Strings(ids)
+	env := string(Env())
+	for _, id := range ids {
+		layers, err := cfgLayers(id)
+		if err != nil {
+			l.add(CfgLintIssue{Env: env, File: id, Rule: "parse", Msg: err.Error()})
+			continue
+		}
+		schema, ok := l.schemas[id]
+		if !ok {
+			continue
+		}
+		merged := make(map[string]interface{})
+		for _, layer := range layers {
+			if layer.Kind == "nacos" {
+				l.lintSettings(env, id, layer.Source, schema, layer.Settings)
+			}
+			if layer.Kind == "default" || layer.Kind == "nacos" {
+				mergeSettings(merged, layer.Settings)
+			}
+		}
+		l.lintRequired(env, id, schema, merged)
+	}
+}
+
+// 检查一层配置中的未知配置项与类型
+func (l *cfgLinter) lintSettings(env, file, source string, schema CfgSchema, settings map[string]interface{}) {
+	flat := flattenSettings("", settings)
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !schema.covers(key) {
+			continue
+		}
+		field, known := schema.lookup(key)
+		if !known {
+			l.add(CfgLintIssue{Env: env, File: file, Source: source, Key: key, Rule: "unknown", Msg: "unknown key"})
+			continue
+		}
+		if field.Key != key {
+			continue
+		}
+		if msg := checkCfgType(key, field.Type, flat[key]); msg != "" {
+			l.add(CfgLintIssue{Env: env, File: file, Source: source, Key: key, Rule: "type", Msg: msg})
+		}
+	}
+}
+
+func (l *cfgLinter) lintRequired(env, file string, schema CfgSchema, merged map[string]interface{}) {
+	for _, f := range schema.Fields {
+		if f.Required && lookupSetting(merged, strings.Split(f.Key, ".")) == nil {
+			l.add(CfgLintIssue{Env: env, File: file, Key: f.Key, Rule: "required", Msg: "is required"})
+		}
+	}
+}
+
+// 同一配置项在不同环境中的类型不一致，如 development 为 int 而 production 为 string
+func (l *cfgLinter) crossEnv(files []string) {
+	for _, file := range files {
+		byEnv := l.kinds[file]
+		if len(byEnv) < 2 {
+			continue
+		}
+		envs := make([]string, 0, len(byEnv))
+		keySet := make(map[string]bool)
+		for env, kinds := range byEnv {
+			envs = append(envs, env)
+			for key := range kinds {
+				keySet[key] = true
+			}
+		}
+		sort.Strings(envs)
+		keys := make([]string, 0, len(keySet))
+		for key := range keySet {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			var desc []string
+			distinct := make(map[string]bool)
+			for _, env := range envs {
+				if kind, ok := byEnv[env][key]; ok {
+					desc = append(desc, kind+" in "+env)
+					distinct[kind] = true
+				}
+			}
+			if len(distinct) > 1 {
+				l.add(CfgLintIssue{File: file, Key: key, Rule: "type", Msg: "inconsistent across environments: " + strings.Join(desc, ", ")})
+			}
+		}
+	}
+}
+
+// 配置目录下的环境目录
+func (c *configuration) envDirs() []string {
+	set := make(map[string]bool)
+	for _, path := range c.paths {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() && !inStrings(e.Name(), commonConfigDirs) && !strings.HasPrefix(e.Name(), ".") {
+				set[e.Name()] = true
+			}
+		}
+	}
+	return sortedKeys(set)
+}
+
+// 各环境目录及公共目录下的配置文件名（不含扩展名）
+func (c *configuration) lintFiles(envs []string) []string {
+	set := make(map[string]bool)
+	dirs := append(append([]string(nil), envs...), commonConfigDirs...)
+	for _, path := range c.paths {
+		for _, dir := range dirs {
+			matches, _ := filepath.Glob(filepath.Join(path, dir, "*.toml"))
+			for _, m := range matches {
+				name := filepath.Base(m)
+				if !strings.HasSuffix(name, ".local.toml") {
+					set[strings.TrimSuffix(name, ".toml")] = true
+				}
+			}
+		}
+	}
+	return sortedKeys(set)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 配置文件所在目录名，即环境名或公共目录名
+func lintEnv(file string) string {
+	return filepath.Base(filepath.Dir(file))
+}
+
+func (s CfgSchema) hasRequired() bool {
+	for _, f := range s.Fields {
+		if f.Required {
+			return true
+		}
+	}
+	return false
+}
+
+// key 是否在结构体绑定的范围内，范围外的配置项不做检查
+func (s CfgSchema) covers(key string) bool {
+	for _, p := range s.Prefixes {
+		if p == "" || key == p || strings.HasPrefix(key, p+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// 查找 key 对应的字段，key 位于 map、any 类型字段之下时返回该字段
+func (s CfgSchema) lookup(key string) (CfgSchemaField, bool) {
+	for _, f := range s.Fields {
+		if f.Key == key {
+			return f, true
+		}
+		if (f.Type == "map" || f.Type == "any") && strings.HasPrefix(key, f.Key+".") {
+			return f, true
+		}
+	}
+	return CfgSchemaField{}, false
+}
+
+// 将嵌套的表展开为 a.b.c 形式的叶子配置项，数组与空表作为叶子
+func flattenSettings(prefix string, m map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{})
+	for k, v := range m {
+		key := joinKey(prefix, strings.ToLower(k))
+		if sub, ok := v.(map[string]interface{}); ok && len(sub) > 0 {
+			for sk, sv := range flattenSettings(key, sub) {
+				ret[sk] = sv
+			}
+			continue
+		}
+		ret[key] = v
+	}
+	return ret
+}
+
+func cfgValueKind(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "int"
+	case float32, float64:
+		return "float"
+	case time.Time:
+		return "time"
+	case []interface{}, []string, []map[string]interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "map"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// 检查配置文件中的原始值是否符合字段类型，符合时返回空字符串
+func checkCfgType(key, typ string, v interface{}) string {
+	kind := cfgValueKind(v)
+	ok := kind == typ
+	switch typ {
+	case "any":
+		ok = true
+	case "int":
+		if f, isFloat := v.(float64); isFloat && f == float64(int64(f)) {
+			// JSON 中的数字均为 float64
+			ok = true
+		}
+	case "float":
+		ok = kind == "int" || kind == "float"
+	case "duration":
+		if s, isStr := v.(string); isStr {
+			if _, err := time.ParseDuration(s); err != nil {
+				return fmt.Sprintf("%q is not a valid duration", s)
+			}
+			ok = true
+		} else {
+			ok = kind == "int"
+		}
+	case "time":
+		ok = kind == "time" || kind == "string"
+	case "list":
+		// 逗号分隔的字符串可绑定到切片
+		ok = kind == "list" || kind == "string"
+	}
+	if ok {
+		return ""
+	}
+	return fmt.Sprintf("expected %s, got %s %s", typ, kind, formatCfgValue(key, v))
+}
@@ -0,0 +1,244 @@
+package sys
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 环境变量覆盖的前缀，GOTOOL_APP__NACOS__ADDR 对应 app 文件的 nacos.addr
+var cfgEnvPrefix = "GOTOOL_"
+
+// cfgOverride 一条命令行覆盖，如 --set app.nacos.addr=127.0.0.1
+type cfgOverride struct {
+	File string
+	Key  string
+	Raw  string
+}
+
+var (
+	cfgOverrides   []cfgOverride
+	cfgOverridesRw sync.RWMutex
+)
+
+// SetCfgEnvPrefix 设置环境变量覆盖的前缀，默认为 GOTOOL_，需在首次读取配置前调用
+func SetCfgEnvPrefix(prefix string) {
+	cfgEnvPrefix = prefix
+}
+
+// SetCfg 以命令行覆盖的优先级设置配置项，path 形如 app.nacos.addr，
+// 文件名含有 "." 时使用 database.toml:db-scrm.password 的形式
+func SetCfg(path, value string) error {
+	o, err := parseCfgOverride(path + "=" + value)
+	if err != nil {
+		return err
+	}
+	cfgOverridesRw.Lock()
+	cfgOverrides = append(cfgOverrides, o)
+	cfgOverridesRw.Unlock()
+	if configLocal != nil {
+		ResetCfgKey(o.File)
+	}
+	return nil
+}
+
+// ParseCfgArgs 从命令行参数中提取 --set file.key=value（或 -set），
+// 返回剩余参数，可继续交给 flag.Parse 等处理
+func ParseCfgArgs(args []string) (rest []string, err error) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := strings.TrimLeft(arg, "-")
+		if name == arg || (name != "set" && !strings.HasPrefix(name, "set=")) {
+			rest = append(rest, arg)
+			continue
+		}
+		var value string
+		if strings.HasPrefix(name, "set=") {
+			value = name[len("set="):]
+		} else if i+1 < len(args) {
+			i++
+			value = args[i]
+		} else {
+			return rest, fmt.Errorf("flag --set: missing value")
+		}
+		idx := strings.Index(value, "=")
+		if idx < 0 {
+			return rest, fmt.Errorf("flag --set %q: expected file.key=value", value)
+		}
+		if err = SetCfg(value[:idx], value[idx+1:]); err != nil {
+			return rest, err
+		}
+	}
+	return rest, nil
+}
+
+// cfgSetFlag 实现 flag.Value，支持重复的 --set
+type cfgSetFlag struct{}
+
+func (cfgSetFlag) String() string { return "" }
+
+func (cfgSetFlag) Set(value string) error {
+	idx := strings.Index(value, "=")
+	if idx < 0 {
+		return fmt.Errorf("expected file.key=value")
+	}
+	return SetCfg(value[:idx], value[idx+1:])
+}
+
+// CfgFlag 在给定的 FlagSet 上注册可重复的 --set file.key=value 参数
+func CfgFlag(fs *flag.FlagSet) {
+	fs.Var(cfgSetFlag{}, "set", "override a config key, e.g. --set app.nacos.addr=127.0.0.1 (repeatable)")
+}
+
+func parseCfgOverride(s string) (o cfgOverride, err error) {
+	idx := strings.Index(s, "=")
+	if idx < 0 {
+		return o, fmt.Errorf("config override %q: expected file.key=value", s)
+	}
+	path, raw := s[:idx], s[idx+1:]
+	sep := strings.Index(path, ":")
+	if sep < 0 {
+		sep = strings.Index(path, ".")
+	}
+	if sep <= 0 || sep == len(path)-1 {
+		return o, fmt.Errorf("config override %q: expected file.key=value", s)
+	}
+	return cfgOverride{File: path[:sep], Key: strings.ToLower(path[sep+1:]), Raw: raw}, nil
+}
+
+// 在文件层之后追加环境变量层和命令行层，base 为文件层合并后的结果，用于还原键名和值类型
+func overrideLayers(file string, base map[string]interface{}) (layers []*cfgLayer) {
+	envPrefix := strings.ToUpper(cfgEnvPrefix) + envName(file) + "__"
+	environ := os.Environ()
+	sort.Strings(environ)
+	for _, kv := range environ {
+		idx := strings.Index(kv, "=")
+		if idx < 0 || !strings.HasPrefix(strings.ToUpper(kv[:idx]), envPrefix) {
+			continue
+		}
+		name, raw := kv[:idx], kv[idx+1:]
+		path := resolveCfgPath(base, strings.Split(name[len(envPrefix):], "__"))
+		if len(path) == 0 {
+			continue
+		}
+		layers = append(layers, &cfgLayer{Kind: "env", Source: name, Settings: singleSetting(path, typedOverride(lookupSetting(base, path), raw))})
+	}
+
+	cfgOverridesRw.RLock()
+	defer cfgOverridesRw.RUnlock()
+	for _, o := range cfgOverrides {
+		if o.File != file {
+			continue
+		}
+		path := resolveCfgPath(base, strings.Split(o.Key, "."))
+		layers = append(layers, &cfgLayer{Kind: "flag", Source: "--set " + file + "." + o.Key, Settings: singleSetting(path, typedOverride(lookupSetting(base, path), o.Raw))})
+	}
+	return
+}
+
+// 文件名转为环境变量片段，database.toml => DATABASE_TOML
+func envName(s string) string {
+	return strings.ToUpper(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, s))
+}
+
+// 将环境变量中的各段还原为已有的键名：大小写不敏感，且 "-" 与 "_" 等价
+func resolveCfgPath(base map[string]interface{}, segments []string) []string {
+	path := make([]string, 0, len(segments))
+	cur := base
+	for _, seg := range segments {
+		if seg == "" {
+			return nil
+		}
+		key := strings.ToLower(seg)
+		for k := range cur {
+			if envName(k) == envName(seg) {
+				key = k
+				break
+			}
+		}
+		path = append(path, key)
+		next, _ := cur[key].(map[string]interface{})
+		cur = next
+	}
+	return path
+}
+
+func lookupSetting(m map[string]interface{}, path []string) interface{} {
+	var cur interface{} = m
+	for _, k := range path {
+		cm, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = cm[k]
+	}
+	return cur
+}
+
+func setSettingPath(m map[string]interface{}, path []string, value interface{}) {
+	for _, k := range path[:len(path)-1] {
+		next, ok := m[k].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			m[k] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = value
+}
+
+func singleSetting(path []string, value interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	setSettingPath(m, path, value)
+	return m
+}
+
+// 按已有值的类型转换覆盖值，没有已有值时依次尝试 bool、整数、浮点数
+func typedOverride(old interface{}, raw string) interface{} {
+	switch old.(type) {
+	case string:
+		return raw
+	case bool:
+		if v, err := strconv.ParseBool(raw); err == nil {
+			return v
+		}
+	case int, int32, int64:
+		if v, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return v
+		}
+	case float32, float64:
+		if v, err := strconv.ParseFloat(raw, 64); err == nil {
+			return v
+		}
+	case []interface{}, []string:
+		raw = strings.TrimSuffix(strings.TrimPrefix(raw, "["), "]")
+		parts := strings.Split(raw, ",")
+		list := make([]interface{}, 0, len(parts))
+		for _, p := range parts {
+			if p = strings.Trim(strings.TrimSpace(p), `"'`); p != "" {
+				list = append(list, p)
+			}
+		}
+		return list
+	case nil:
+		if v, err := strconv.ParseBool(raw); err == nil {
+			return v
+		}
+		if v, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return v
+		}
+		if v, err := strconv.ParseFloat(raw, 64); err == nil {
+			return v
+		}
+	}
+	return raw
+}
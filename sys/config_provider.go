@@ -0,0 +1,208 @@
+package sys
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// ConfigItem 一份远程配置，dataId 同时作为 sys.Nacos(file) 的 file
+type ConfigItem struct {
+	DataId string
+	Group  string
+	Format string // toml、yaml、json、properties 等，为空时自动判断
+}
+
+func (i ConfigItem) String() string {
+	return i.DataId + ":" + i.Group
+}
+
+// ConfigProvider 远程配置中心，Nacos、etcd、Consul 等均以此接入
+type ConfigProvider interface {
+	// Fetch 拉取配置内容
+	Fetch(item ConfigItem) (string, error)
+	// Watch 监听配置变更，内容变化时回调 onChange
+	Watch(item ConfigItem, onChange func(data string)) error
+	// Close 停止监听并释放连接
+	Close() error
+}
+
+// ConfigFormatter 可选接口，配置中心能够提供配置格式（如 Nacos 的配置类型）时实现
+type ConfigFormatter interface {
+	Format(item ConfigItem) (string, error)
+}
+
+// ConfigProviderFactory 根据 app.toml 中 [remote.<name>] 的配置创建 ConfigProvider，
+// 没有该配置段时 cfg 为空的 viper 实例
+type ConfigProviderFactory func(cfg *viper.Viper) (ConfigProvider, error)
+
+var (
+	configProviderFactories = make(map[string]ConfigProviderFactory)
+	remoteProvider          ConfigProvider
+	remoteProviderMu        sync.Mutex
+)
+
+// RegisterConfigProvider 注册远程配置中心的实现，name 对应 app.toml 中的 remote.provider
+func RegisterConfigProvider(name string, factory ConfigProviderFactory) {
+	remoteProviderMu.Lock()
+	defer remoteProviderMu.Unlock()
+	configProviderFactories[name] = factory
+}
+
+// ConfigProviders 返回已注册的远程配置中心名称
+func ConfigProviders() []string {
+	remoteProviderMu.Lock()
+	defer remoteProviderMu.Unlock()
+	names := make([]string, 0, len(configProviderFactories))
+	for name := range configProviderFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewConfigProvider 按名称创建远程配置中心，name 为空时读取 app.toml 的 remote.provider，缺省为 nacos
+func NewConfigProvider(name string) (ConfigProvider, error) {
+	app := Cfg("app")
+	if name == "" && app != nil {
+		name = app.GetString("remote.provider")
+	}
+	if name == "" {
+		name = "nacos"
+	}
+	remoteProviderMu.Lock()
+	factory, ok := configProviderFactories[name]
+	remoteProviderMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("config provider %q not registered", name)
+	}
+	cfg := viper.New()
+	if app != nil {
+		if sub := app.Sub("remote." + name); sub != nil {
+			cfg = sub
+		}
+	}
+	return factory(cfg)
+}
+
+// RemoteConfigItems 读取 app.toml 中需要接入的远程配置，格式为 dataId:group 或 dataId:group:format，
+// 优先使用 remote.group_data_ids，兼容 nacos.group_data_ids
+func RemoteConfigItems() (items []ConfigItem) {
+	app := Cfg("app")
+	if app == nil {
+		return nil
+	}
+	list := app.GetStringSlice("remote.group_data_ids")
+	if len(list) == 0 {
+		list = app.GetStringSlice("nacos.group_data_ids")
+	}
+	for _, v := range list {
+		tmpConf := strings.Split(v, ":")
+		if len(tmpConf) != 2 && len(tmpConf) != 3 {
+			fmt.Println("配置有误：" + v)
+			continue
+		}
+		item := ConfigItem{DataId: tmpConf[0], Group: tmpConf[1]}
+		if len(tmpConf) == 3 {
+			if item.Format = normalizeCfgFormat(tmpConf[2]); item.Format == "" {
+				fmt.Println("配置格式不支持：" + v)
+				continue
+			}
+		}
+		items = append(items, item)
+	}
+	return
+}
+
+// 默认的远程配置 dataId
+func defaultDataId() string {
+	app := Cfg("app")
+	if app == nil {
+		return ""
+	}
+	if id := app.GetString("remote.defaultDataId"); id != "" {
+		return id
+	}
+	return app.GetString("nacos.defaultDataId")
+}
+
+// LoadRemoteConfig 使用 p 拉取 items 并监听变更，之后可通过 sys.Nacos(dataId) 读取。
+// 每次获取成功都会保存本地快照，配置中心不可用时改用快照启动，并通过 CfgStale 标记为过期配置
+func LoadRemoteConfig(p ConfigProvider, items []ConfigItem) error {
+	remoteProviderMu.Lock()
+	remoteProvider = p
+	remoteProviderMu.Unlock()
+	for _, item := range items {
+		data, err := p.Fetch(item)
+		if err == nil {
+			item.Format = remoteFormat(p, item)
+			remoteFetched(item, data)
+		} else if item, data, err = remoteFallback(item, err); err != nil {
+			return fmt.Errorf("fetch remote config %s: %w", item, err)
+		}
+		setNacosFormat(item.DataId, item.Format)
+		SetNacosConfig(item.DataId, item.Group, data)
+		item := item
+		if err = p.Watch(item, func(data string) {
+			fmt.Println(item.DataId + " remote config changed")
+			remoteFetched(item, data)
+			SetNacosConfig(item.DataId, item.Group, data)
+		}); err != nil {
+			fmt.Println("watch remote config err:", item, err)
+		}
+	}
+	refreshGormLogLevels()
+	return nil
+}
+
+// 确定配置格式：显式配置优先，其次为配置中心提供的类型，最后按 dataId 的扩展名判断
+func remoteFormat(p ConfigProvider, item ConfigItem) string {
+	if item.Format != "" {
+		return item.Format
+	}
+	if f, ok := p.(ConfigFormatter); ok {
+		format, err := f.Format(item)
+		if err != nil {
+			fmt.Println("get remote config format err:", item, err)
+		} else if format = normalizeCfgFormat(format); format != "" {
+			return format
+		}
+	}
+	return formatByExt(item.DataId)
+}
+
+// InitRemoteConfig 按 app.toml 的 remote.provider 创建远程配置中心并加载所有配置
+func InitRemoteConfig() error {
+	p, err := NewConfigProvider("")
+	if err != nil {
+		return err
+	}
+	return LoadRemoteConfig(p, RemoteConfigItems())
+}
+
+// RemoteConfigProvider 返回当前的远程配置中心，尚未加载远程配置时返回 nil
+func RemoteConfigProvider() ConfigProvider {
+	remoteProviderMu.Lock()
+	defer remoteProviderMu.Unlock()
+	return remoteProvider
+}
+
+// CloseRemoteConfig 关闭当前的远程配置中心
+func CloseRemoteConfig() error {
+	remoteProviderMu.Lock()
+	p := remoteProvider
+	remoteProvider = nil
+	remoteProviderMu.Unlock()
+	if p == nil {
+		return nil
+	}
+	return p.Close()
+}
+
+// Remote 与 Nacos 相同，读取任意远程配置中心加载的配置
+func Remote(files ...string) *viper.Viper {
+	return Nacos(files...)
+}
@@ -0,0 +1,183 @@
+package sys
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CfgSchema 配置文件的结构描述，由 CfgAs、NacosAs 绑定的结构体生成，供 LintCfg 检查使用
+type CfgSchema struct {
+	File     string           `json:"file"`     // sys.Cfg 的文件名或 sys.Nacos 的 dataId
+	Prefixes []string         `json:"prefixes"` // 结构体绑定的子树，空字符串表示整个文件
+	Fields   []CfgSchemaField `json:"fields"`
+}
+
+// CfgSchemaField 一个配置项的描述
+type CfgSchemaField struct {
+	Key      string `json:"key"`  // 完整路径，如 nacos.addr
+	Type     string `json:"type"` // string、int、float、bool、duration、time、list、map、any
+	Required bool   `json:"required,omitempty"`
+	Default  string `json:"default,omitempty"`
+}
+
+var (
+	cfgSchemas     = make(map[string]*CfgSchema)
+	cfgSchemaTypes = make(map[string]bool)
+	cfgSchemasRw   sync.RWMutex
+)
+
+// RegisterCfgSchema 根据结构体 T 登记 file（或其中 keys 子树）的结构，CfgAs 与 NacosAs 会自动调用
+func RegisterCfgSchema[T any](file string, keys ...string) {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	prefix := strings.ToLower(strings.Join(keys, "."))
+	id := file + "|" + prefix + "|" + rt.PkgPath() + "." + rt.String()
+	cfgSchemasRw.RLock()
+	done := cfgSchemaTypes[id]
+	cfgSchemasRw.RUnlock()
+	if done {
+		return
+	}
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	var fields []CfgSchemaField
+	if rt.Kind() == reflect.Struct {
+		schemaFields(rt, prefix, &fields)
+	} else if prefix != "" {
+		fields = append(fields, CfgSchemaField{Key: prefix, Type: schemaType(rt)})
+	}
+	cfgSchemasRw.Lock()
+	cfgSchemaTypes[id] = true
+	addCfgSchema(&CfgSchema{File: file, Prefixes: []string{prefix}, Fields: fields})
+	cfgSchemasRw.Unlock()
+}
+
+// 合并到已登记的结构中，需持有 cfgSchemasRw 的写锁
+func addCfgSchema(s *CfgSchema) {
+	cur, ok := cfgSchemas[s.File]
+	if !ok {
+		cur = &CfgSchema{File: s.File}
+		cfgSchemas[s.File] = cur
+	}
+	for _, p := range s.Prefixes {
+		if !inStrings(p, cur.Prefixes) {
+			cur.Prefixes = append(cur.Prefixes, p)
+		}
+	}
+	for _, f := range s.Fields {
+		merged := false
+		for i := range cur.Fields {
+			if cur.Fields[i].Key == f.Key {
+				// 同一配置项被多个结构体绑定时，任一要求必填即为必填
+				cur.Fields[i].Required = cur.Fields[i].Required || f.Required
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			cur.Fields = append(cur.Fields, f)
+		}
+	}
+	sort.Strings(cur.Prefixes)
+	sort.Slice(cur.Fields, func(i, j int) bool { return cur.Fields[i].Key < cur.Fields[j].Key })
+}
+
+// CfgSchemas 返回所有已登记的配置结构，按文件名排序
+func CfgSchemas() []CfgSchema {
+	cfgSchemasRw.RLock()
+	defer cfgSchemasRw.RUnlock()
+	ret := make([]CfgSchema, 0, len(cfgSchemas))
+	for _, s := range cfgSchemas {
+		cp := *s
+		cp.Prefixes = append([]string(nil), s.Prefixes...)
+		cp.Fields = append([]CfgSchemaField(nil), s.Fields...)
+		ret = append(ret, cp)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].File < ret[j].File })
+	return ret
+}
+
+// ExportCfgSchema 以 JSON 输出所有已登记的配置结构，可交给 gotool config lint -schema 使用
+func ExportCfgSchema(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(CfgSchemas())
+}
+
+// ImportCfgSchema 读取 ExportCfgSchema 输出的 JSON 并登记其中的配置结构
+func ImportCfgSchema(r io.Reader) error {
+	var schemas []*CfgSchema
+	if err := json.NewDecoder(r).Decode(&schemas); err != nil {
+		return err
+	}
+	cfgSchemasRw.Lock()
+	defer cfgSchemasRw.Unlock()
+	for _, s := range schemas {
+		addCfgSchema(s)
+	}
+	return nil
+}
+
+// 递归收集结构体字段对应的配置项，与 CfgAs 的绑定规则一致
+func schemaFields(rt reflect.Type, prefix string, fields *[]CfgSchemaField) {
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name, squash := fieldKey(sf)
+		if name == "-" {
+			continue
+		}
+		key := joinKey(prefix, strings.ToLower(name))
+		if squash {
+			key = prefix
+		}
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && ft != reflect.TypeOf(time.Time{}) {
+			schemaFields(ft, key, fields)
+			continue
+		}
+		def, hasDef := sf.Tag.Lookup("default")
+		required := false
+		for _, rule := range strings.Split(sf.Tag.Get("validate"), ",") {
+			if strings.TrimSpace(rule) == "required" {
+				required = !hasDef
+			}
+		}
+		*fields = append(*fields, CfgSchemaField{Key: key, Type: schemaType(ft), Required: required, Default: def})
+	}
+}
+
+func schemaType(rt reflect.Type) string {
+	switch rt {
+	case reflect.TypeOf(time.Duration(0)):
+		return "duration"
+	case reflect.TypeOf(time.Time{}):
+		return "time"
+	}
+	switch rt.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map, reflect.Struct:
+		return "map"
+	}
+	return "any"
+}
@@ -0,0 +1,263 @@
+package sys
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// CfgKeyEnv 默认读取密钥的环境变量
+	CfgKeyEnv = "GOTOOL_CONFIG_KEY"
+	// CfgKeyFileEnv 默认读取密钥文件路径的环境变量
+	CfgKeyFileEnv = "GOTOOL_CONFIG_KEY_FILE"
+)
+
+// ErrNoCfgKey 没有可用的配置解密密钥
+var ErrNoCfgKey = errors.New("config: no secret key configured")
+
+// 加密值的格式：ENC(base64(nonce + ciphertext))
+var encValueRegexp = regexp.MustCompile(`ENC\(([A-Za-z0-9+/=]+)\)`)
+
+// SecretKeyProvider 提供配置加解密使用的密钥
+type SecretKeyProvider interface {
+	Key() ([]byte, error)
+}
+
+// SecretKeyFunc 将函数适配为 SecretKeyProvider
+type SecretKeyFunc func() ([]byte, error)
+
+func (f SecretKeyFunc) Key() ([]byte, error) { return f() }
+
+// EnvKeyProvider 从环境变量读取密钥
+func EnvKeyProvider(name string) SecretKeyProvider {
+	return SecretKeyFunc(func() ([]byte, error) {
+		v := strings.TrimSpace(os.Getenv(name))
+		if v == "" {
+			return nil, ErrNoCfgKey
+		}
+		return []byte(v), nil
+	})
+}
+
+// FileKeyProvider 从本地密钥文件读取密钥，文件首尾的空白会被忽略
+func FileKeyProvider(path string) SecretKeyProvider {
+	return SecretKeyFunc(func() ([]byte, error) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config: read key file: %w", err)
+		}
+		b = []byte(strings.TrimSpace(string(b)))
+		if len(b) == 0 {
+			return nil, ErrNoCfgKey
+		}
+		return b, nil
+	})
+}
+
+// ChainKeyProvider 依次尝试多个密钥来源，返回第一个可用的密钥
+func ChainKeyProvider(providers ...SecretKeyProvider) SecretKeyProvider {
+	return SecretKeyFunc(func() ([]byte, error) {
+		err := ErrNoCfgKey
+		for _, p := range providers {
+			var key []byte
+			if key, err = p.Key(); err == nil {
+				return key, nil
+			}
+		}
+		return nil, err
+	})
+}
+
+// 默认依次读取环境变量 GOTOOL_CONFIG_KEY 和 GOTOOL_CONFIG_KEY_FILE 指向的密钥文件
+var (
+	cfgKeyProvider SecretKeyProvider = SecretKeyFunc(func() ([]byte, error) {
+		if path := os.Getenv(CfgKeyFileEnv); path != "" {
+			return ChainKeyProvider(EnvKeyProvider(CfgKeyEnv), FileKeyProvider(path)).Key()
+		}
+		return EnvKeyProvider(CfgKeyEnv).Key()
+	})
+	cfgKeyProviderRw sync.RWMutex
+)
+
+// SetCfgKeyProvider 设置配置解密使用的密钥来源，已加载的配置会在下次读取时重新解密
+func SetCfgKeyProvider(p SecretKeyProvider) {
+	cfgKeyProviderRw.Lock()
+	cfgKeyProvider = p
+	cfgKeyProviderRw.Unlock()
+	if configLocal != nil {
+		configLocal.Lock()
+		for file := range configLocal.vipers {
+			delete(configLocal.vipers, file)
+			delete(configLocal.layers, file)
+		}
+		configLocal.Unlock()
+	}
+}
+
+func currentCfgKey() ([]byte, error) {
+	cfgKeyProviderRw.RLock()
+	p := cfgKeyProvider
+	cfgKeyProviderRw.RUnlock()
+	if p == nil {
+		return nil, ErrNoCfgKey
+	}
+	return p.Key()
+}
+
+// GenerateCfgKey 生成一个随机密钥，可写入密钥文件或环境变量
+func GenerateCfgKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// IsEncryptedCfgValue 判断是否为 ENC(...) 格式的加密值
+func IsEncryptedCfgValue(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.HasPrefix(s, "ENC(") && strings.HasSuffix(s, ")")
+}
+
+// EncryptCfgValue 使用当前密钥加密，返回 ENC(...) 格式的字符串
+func EncryptCfgValue(plain string) (string, error) {
+	key, err := currentCfgKey()
+	if err != nil {
+		return "", err
+	}
+	return EncryptCfgValueWithKey(key, plain)
+}
+
+// DecryptCfgValue 使用当前密钥解密 ENC(...) 格式的字符串，非加密值原样返回
+func DecryptCfgValue(s string) (string, error) {
+	if !IsEncryptedCfgValue(s) {
+		return s, nil
+	}
+	key, err := currentCfgKey()
+	if err != nil {
+		return "", err
+	}
+	return DecryptCfgValueWithKey(key, s)
+}
+
+// EncryptCfgValueWithKey 使用给定密钥加密（AES-256-GCM）
+func EncryptCfgValueWithKey(key []byte, plain string) (string, error) {
+	gcm, err := newCfgCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return "ENC(" + base64.StdEncoding.EncodeToString(sealed) + ")", nil
+}
+
+// DecryptCfgValueWithKey 使用给定密钥解密 ENC(...) 格式的字符串
+func DecryptCfgValueWithKey(key []byte, s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if !IsEncryptedCfgValue(s) {
+		return "", fmt.Errorf("config: %q is not an ENC(...) value", s)
+	}
+	raw, err := base64.StdEncoding.DecodeString(s[len("ENC(") : len(s)-1])
+	if err != nil {
+		return "", fmt.Errorf("config: decode encrypted value: %w", err)
+	}
+	gcm, err := newCfgCipher(key)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return "", errors.New("config: encrypted value too short")
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("config: decrypt value: %w", err)
+	}
+	return string(plain), nil
+}
+
+// RotateCfgSecrets 将内容中所有 ENC(...) 值用 oldKey 解密后以 newKey 重新加密，其余内容保持不变
+func RotateCfgSecrets(content []byte, oldKey, newKey []byte) ([]byte, error) {
+	var rotateErr error
+	out := encValueRegexp.ReplaceAllFunc(content, func(m []byte) []byte {
+		if rotateErr != nil {
+			return m
+		}
+		plain, err := DecryptCfgValueWithKey(oldKey, string(m))
+		if err != nil {
+			rotateErr = err
+			return m
+		}
+		enc, err := EncryptCfgValueWithKey(newKey, plain)
+		if err != nil {
+			rotateErr = err
+			return m
+		}
+		return []byte(enc)
+	})
+	if rotateErr != nil {
+		return nil, rotateErr
+	}
+	return out, nil
+}
+
+// 任意长度的密钥材料经 sha256 派生为 32 字节的 AES-256 密钥
+func newCfgCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, ErrNoCfgKey
+	}
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// 解密合并后配置中的所有 ENC(...) 值，解密失败的保持原样
+func decryptSettings(file string, m map[string]interface{}) {
+	for k, v := range m {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			decryptSettings(file, val)
+		case string:
+			if !IsEncryptedCfgValue(val) {
+				continue
+			}
+			plain, err := DecryptCfgValue(val)
+			if err != nil {
+				fmt.Println("Cfg decrypt err:", file, k, err)
+				continue
+			}
+			m[k] = plain
+		case []interface{}:
+			// 数组与各层配置共用底层存储，复制后再替换，避免明文写回到来源层
+			val = append([]interface{}(nil), val...)
+			m[k] = val
+			for i, item := range val {
+				s, ok := item.(string)
+				if !ok || !IsEncryptedCfgValue(s) {
+					continue
+				}
+				plain, err := DecryptCfgValue(s)
+				if err != nil {
+					fmt.Println("Cfg decrypt err:", file, k, err)
+					continue
+				}
+				val[i] = plain
+			}
+		}
+	}
+}
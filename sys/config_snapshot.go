@@ -0,0 +1,184 @@
+package sys
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RemoteConfigStatus 一份远程配置的加载状态
+type RemoteConfigStatus struct {
+	DataId    string    `json:"data_id"`
+	Group     string    `json:"group"`
+	Stale     bool      `json:"stale"`      // 是否正在使用本地快照
+	FetchedAt time.Time `json:"fetched_at"` // 内容最后一次从配置中心获取的时间
+	Error     string    `json:"error,omitempty"`
+}
+
+// 本地快照文件的内容
+type cfgSnapshot struct {
+	DataId    string    `json:"data_id"`
+	Group     string    `json:"group"`
+	Format    string    `json:"format"`
+	Content   string    `json:"content"`
+	Md5       string    `json:"md5"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+var (
+	cfgSnapshotDir string
+	remoteStatus   = make(map[string]*RemoteConfigStatus)
+	remoteStatusRw sync.RWMutex
+)
+
+func init() {
+	expvar.Publish("gotool_config_stale", expvar.Func(func() interface{} {
+		if CfgStale() {
+			return 1
+		}
+		return 0
+	}))
+	expvar.Publish("gotool_config_remote", expvar.Func(func() interface{} {
+		return CfgHealth()
+	}))
+}
+
+// SetCfgSnapshotDir 设置远程配置快照的保存目录，缺省读取 app.toml 的 remote.snapshot_dir，
+// 未配置时为 <log_path>config_snapshot
+func SetCfgSnapshotDir(dir string) {
+	cfgSnapshotDir = dir
+}
+
+func snapshotDir() string {
+	if cfgSnapshotDir != "" {
+		return cfgSnapshotDir
+	}
+	app := Cfg("app")
+	if app == nil {
+		return ""
+	}
+	if dir := app.GetString("remote.snapshot_dir"); dir != "" {
+		return dir
+	}
+	return app.GetString("log_path") + "config_snapshot"
+}
+
+func snapshotFile(item ConfigItem) string {
+	dir := snapshotDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, item.Group, item.DataId+".json")
+}
+
+// 保存最近一次成功获取的配置内容，先写临时文件再重命名，避免进程中断留下不完整的快照
+func saveSnapshot(item ConfigItem, content string, fetchedAt time.Time) error {
+	file := snapshotFile(item)
+	if file == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(cfgSnapshot{
+		DataId:    item.DataId,
+		Group:     item.Group,
+		Format:    item.Format,
+		Content:   content,
+		Md5:       Md5(content),
+		FetchedAt: fetchedAt,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err = os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// 读取快照并校验内容完整性
+func loadSnapshot(item ConfigItem) (*cfgSnapshot, error) {
+	file := snapshotFile(item)
+	if file == "" {
+		return nil, fmt.Errorf("snapshot dir not configured")
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var snap cfgSnapshot
+	if err = json.Unmarshal(b, &snap); err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", file, err)
+	}
+	if Md5(snap.Content) != snap.Md5 {
+		return nil, fmt.Errorf("snapshot %s: checksum mismatch", file)
+	}
+	return &snap, nil
+}
+
+// 从配置中心获取成功，更新快照并标记为最新
+func remoteFetched(item ConfigItem, content string) {
+	now := time.Now()
+	if err := saveSnapshot(item, content, now); err != nil {
+		fmt.Println("save config snapshot err:", item, err)
+	}
+	remoteStatusRw.Lock()
+	remoteStatus[item.DataId] = &RemoteConfigStatus{DataId: item.DataId, Group: item.Group, FetchedAt: now}
+	remoteStatusRw.Unlock()
+}
+
+// 配置中心不可用时改用快照，返回快照内容，未显式指定格式时使用快照中记录的格式
+func remoteFallback(item ConfigItem, fetchErr error) (ConfigItem, string, error) {
+	snap, err := loadSnapshot(item)
+	if err != nil {
+		return item, "", fmt.Errorf("%v; fallback snapshot: %w", fetchErr, err)
+	}
+	if item.Format == "" {
+		item.Format = snap.Format
+	}
+	if item.Format == "" {
+		item.Format = formatByExt(item.DataId)
+	}
+	fmt.Println("remote config unavailable, using snapshot:", item, snap.FetchedAt.Format(time.RFC3339), fetchErr)
+	remoteStatusRw.Lock()
+	remoteStatus[item.DataId] = &RemoteConfigStatus{
+		DataId:    item.DataId,
+		Group:     item.Group,
+		Stale:     true,
+		FetchedAt: snap.FetchedAt,
+		Error:     fetchErr.Error(),
+	}
+	remoteStatusRw.Unlock()
+	return item, snap.Content, nil
+}
+
+// CfgStale 返回是否有远程配置正在使用本地快照（配置中心不可用时的过期配置）
+func CfgStale() bool {
+	remoteStatusRw.RLock()
+	defer remoteStatusRw.RUnlock()
+	for _, s := range remoteStatus {
+		if s.Stale {
+			return true
+		}
+	}
+	return false
+}
+
+// CfgHealth 返回所有远程配置的加载状态，按 dataId 排序
+func CfgHealth() []RemoteConfigStatus {
+	remoteStatusRw.RLock()
+	defer remoteStatusRw.RUnlock()
+	ret := make([]RemoteConfigStatus, 0, len(remoteStatus))
+	for _, s := range remoteStatus {
+		ret = append(ret, *s)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].DataId < ret[j].DataId })
+	return ret
+}
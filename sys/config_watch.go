@@ -0,0 +1,180 @@
+package sys
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// CfgChangeFunc 配置变更回调，old 为变更前的快照，new 为变更后的快照
+type CfgChangeFunc func(old, new *viper.Viper)
+
+// 文件变更后等待该时长再重新加载，合并编辑器保存时产生的多次事件
+var cfgReloadDelay = 200 * time.Millisecond
+
+var (
+	cfgSubscribers   = make(map[string][]CfgChangeFunc)
+	cfgSubscribersRw sync.RWMutex
+)
+
+// OnCfgChange 订阅配置变更，file 为 sys.Cfg 的文件名或 sys.Nacos 的 dataId，
+// 本地文件被修改或远程配置推送后，回调会收到新旧两份配置
+func OnCfgChange(file string, fn CfgChangeFunc) {
+	if fn == nil {
+		return
+	}
+	cfgSubscribersRw.Lock()
+	cfgSubscribers[file] = append(cfgSubscribers[file], fn)
+	cfgSubscribersRw.Unlock()
+}
+
+func notifyCfgChange(file string, old, new *viper.Viper) {
+	cfgSubscribersRw.RLock()
+	fns := cfgSubscribers[file]
+	cfgSubscribersRw.RUnlock()
+	for _, fn := range fns {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					fmt.Println("OnCfgChange panic:", file, r)
+				}
+			}()
+			fn(old, new)
+		}()
+	}
+}
+
+// cfgWatcher 监听所有配置目录，文件变更时重新加载已读取过的配置
+type cfgWatcher struct {
+	watcher *fsnotify.Watcher
+	dirs    map[string]bool
+	timers  map[string]*time.Timer
+	mu      sync.Mutex
+}
+
+// 为已加载的配置开启监听，需持有 configLocal 的写锁
+func (c *configuration) watch() {
+	if c.watcher == nil {
+		w, err := fsnotify.NewWatcher()
+		if err != nil {
+			fmt.Println("Cfg watch err:", err)
+			return
+		}
+		c.watcher = &cfgWatcher{
+			watcher: w,
+			dirs:    make(map[string]bool),
+			timers:  make(map[string]*time.Timer),
+		}
+		go c.watcher.run(c)
+	}
+	dirs := append([]string{string(Env())}, commonConfigDirs...)
+	for _, path := range c.paths {
+		for _, dir := range dirs {
+			full := filepath.Clean(filepath.Join(path, dir))
+			if c.watcher.dirs[full] {
+				continue
+			}
+			if fi, err := os.Stat(full); err != nil || !fi.IsDir() {
+				continue
+			}
+			if err := c.watcher.watcher.Add(full); err != nil {
+				fmt.Println("Cfg watch err:", err)
+				continue
+			}
+			c.watcher.dirs[full] = true
+		}
+	}
+}
+
+func (w *cfgWatcher) run(c *configuration) {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+				continue
+			}
+			name := filepath.Base(event.Name)
+			if !strings.HasSuffix(name, ".toml") {
+				continue
+			}
+			file := strings.TrimSuffix(strings.TrimSuffix(name, ".toml"), ".local")
+			w.mu.Lock()
+			if t, ok := w.timers[file]; ok {
+				t.Reset(cfgReloadDelay)
+			} else {
+				w.timers[file] = time.AfterFunc(cfgReloadDelay, func() {
+					w.mu.Lock()
+					delete(w.timers, file)
+					w.mu.Unlock()
+					c.reload(file)
+				})
+			}
+			w.mu.Unlock()
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			fmt.Println("Cfg watch err:", err)
+		}
+	}
+}
+
+func (w *cfgWatcher) close() {
+	w.mu.Lock()
+	for file, t := range w.timers {
+		t.Stop()
+		delete(w.timers, file)
+	}
+	w.mu.Unlock()
+	_ = w.watcher.Close()
+}
+
+// 重新加载已读取过的本地配置，读取失败时保留旧配置
+func (c *configuration) reload(file string) {
+	c.Lock()
+	old, ok := c.vipers[file]
+	if !ok || !c.isLocal(file) {
+		c.Unlock()
+		return
+	}
+	layers, err := c.loadLayers(file)
+	if err != nil {
+		c.Unlock()
+		fmt.Println("Cfg reload err:", err)
+		return
+	}
+	var vp *viper.Viper
+	c.layers[file], vp = buildViper(file, layers)
+	c.vipers[file] = vp
+	c.Unlock()
+	notifyCfgChange(file, old, vp)
+}
+
+// 判断已加载的配置是否来自本地文件
+func (c *configuration) isLocal(file string) bool {
+	for _, l := range c.layers[file] {
+		if l.Kind == "file" {
+			return true
+		}
+	}
+	return false
+}
+
+// StopCfgWatch 停止监听本地配置文件
+func StopCfgWatch() {
+	configLocal.Lock()
+	defer configLocal.Unlock()
+	if configLocal.watcher != nil {
+		configLocal.watcher.close()
+		configLocal.watcher = nil
+	}
+}
@@ -0,0 +1,237 @@
+package sys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/EricJSanchez/gotool/environment"
+	"github.com/spf13/cast"
+)
+
+var (
+	// ErrDatasourceNotConfigured 数据源没有配置，或未设置默认数据源
+	ErrDatasourceNotConfigured = errors.New("datasource not configured")
+	// ErrInvalidDatasourceConfig 数据源配置项缺失或类型不正确，DatasourceError.Key 为出错的配置项
+	ErrInvalidDatasourceConfig = errors.New("invalid datasource config")
+	// ErrConnectFailed 连接数据源失败
+	ErrConnectFailed = errors.New("datasource connect failed")
+	// ErrCloseFailed 关闭数据源客户端失败
+	ErrCloseFailed = errors.New("datasource close failed")
+)
+
+// DatasourceError 获取数据源时的错误，可通过 errors.Is 判断 Err 的类型，errors.Unwrap 得到原始错误
+type DatasourceError struct {
+	Kind  string // gorm、redis、elastic
+	Name  string // 数据源名称
+	Key   string // 出错的配置项
+	Err   error  // ErrDatasourceNotConfigured、ErrInvalidDatasourceConfig、ErrConnectFailed 或 ErrCloseFailed
+	Cause error
+}
+
+func (e *DatasourceError) Error() string {
+	msg := e.Kind
+	if e.Name != "" {
+		msg += " " + e.Name
+	}
+	msg += ": " + e.Err.Error()
+	if e.Key != "" {
+		msg += " (" + e.Key + ")"
+	}
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+func (e *DatasourceError) Is(target error) bool {
+	return target == e.Err
+}
+
+func (e *DatasourceError) Unwrap() error {
+	return e.Cause
+}
+
+// 补全错误中的数据源类型与名称
+func datasourceError(kind, name string, err error) error {
+	var de *DatasourceError
+	if errors.As(err, &de) {
+		if de.Kind == "" {
+			de.Kind = kind
+		}
+		if de.Name == "" {
+			de.Name = name
+		}
+		return de
+	}
+	return &DatasourceError{Kind: kind, Name: name, Err: ErrConnectFailed, Cause: err}
+}
+
+// 数据源名称，names 为空时使用 app.toml 中 appKey 对应的默认数据源
+func datasourceName(kind, appKey string, names []string) (string, error) {
+	var name string
+	if len(names) > 0 && names[0] != "" {
+		name = names[0]
+	} else if app := Cfg("app"); app != nil {
+		name = app.GetString(appKey)
+	}
+	if name == "" {
+		return "", &DatasourceError{Kind: kind, Key: appKey, Err: ErrDatasourceNotConfigured}
+	}
+	return name, nil
+}
+
+// 读取数据源配置，开发环境优先读取本地 db.toml，其余环境读取 Nacos 的 database.toml
+func datasourceConfig(kind, appKey string, names []string) (name string, config map[string]interface{}, err error) {
+	if name, err = datasourceName(kind, appKey, names); err != nil {
+		return "", nil, err
+	}
+	if environment.Is(environment.Development) {
+		if db := Cfg("db"); db != nil {
+			config = db.GetStringMap(name)
+		}
+	}
+	if len(config) == 0 {
+		if remote := Nacos("database.toml"); remote != nil {
+			config = remote.GetStringMap(name)
+		}
+	}
+	if len(config) == 0 {
+		return name, nil, &DatasourceError{Kind: kind, Name: name, Err: ErrDatasourceNotConfigured}
+	}
+	return name, config, nil
+}
+
+func invalidDatasourceConfig(key string, cause error) error {
+	return &DatasourceError{Key: key, Err: ErrInvalidDatasourceConfig, Cause: cause}
+}
+
+// 子表中出错的配置项加上 prefix. 前缀
+func prefixConfigError(prefix string, err error) error {
+	var de *DatasourceError
+	if errors.As(err, &de) && de.Key != "" && !strings.HasPrefix(de.Key, prefix+".") {
+		de.Key = prefix + "." + de.Key
+	}
+	return err
+}
+
+// 读取字符串配置项，required 为 true 时不能为空
+func dsString(config map[string]interface{}, key string, required bool) (string, error) {
+	v, ok := config[key]
+	if !ok || v == nil {
+		if required {
+			return "", invalidDatasourceConfig(key, errors.New("is required"))
+		}
+		return "", nil
+	}
+	s, err := cast.ToStringE(v)
+	if err != nil {
+		return "", invalidDatasourceConfig(key, err)
+	}
+	if s == "" && required {
+		return "", invalidDatasourceConfig(key, errors.New("is required"))
+	}
+	return s, nil
+}
+
+// 读取整数配置项，缺失时为 def，兼容 "8848" 形式的字符串
+func dsInt(config map[string]interface{}, key string, def int) (int, error) {
+	v, ok := config[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	n, err := cast.ToIntE(v)
+	if err != nil {
+		return 0, invalidDatasourceConfig(key, fmt.Errorf("expected int, got %T %v", v, v))
+	}
+	return n, nil
+}
+
+// 读取时长配置项，整数按 unit 计，也可写作 "30s" 形式的字符串
+func dsDuration(config map[string]interface{}, key string, unit, def time.Duration) (time.Duration, error) {
+	v, ok := config[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	if s, isStr := v.(string); isStr {
+		if d, err := time.ParseDuration(s); err == nil {
+			return d, nil
+		}
+	}
+	n, err := cast.ToInt64E(v)
+	if err != nil {
+		return 0, invalidDatasourceConfig(key, fmt.Errorf("expected duration, got %T %v", v, v))
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// 读取布尔配置项，缺失时为 def，兼容 "true"、1 等写法
+func dsBool(config map[string]interface{}, key string, def bool) (bool, error) {
+	v, ok := config[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	b, err := cast.ToBoolE(v)
+	if err != nil {
+		return false, invalidDatasourceConfig(key, fmt.Errorf("expected bool, got %T %v", v, v))
+	}
+	return b, nil
+}
+
+// 读取表配置项，用于附加的 DSN 参数等，值统一转为字符串
+func dsParams(config map[string]interface{}, key string) (map[string]string, error) {
+	v, ok := config[key]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	m, err := cast.ToStringMapE(v)
+	if err != nil {
+		return nil, invalidDatasourceConfig(key, fmt.Errorf("expected table, got %T", v))
+	}
+	params := make(map[string]string, len(m))
+	for k, val := range m {
+		s, err := cast.ToStringE(val)
+		if err != nil {
+			return nil, invalidDatasourceConfig(key+"."+k, err)
+		}
+		params[k] = s
+	}
+	return params, nil
+}
+
+// 读取字符串列表配置项，兼容逗号分隔的字符串
+func dsStrings(config map[string]interface{}, key string) ([]string, error) {
+	v, ok := config[key]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	if s, isStr := v.(string); isStr {
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	}
+	list, err := cast.ToStringSliceE(v)
+	if err != nil {
+		return nil, invalidDatasourceConfig(key, fmt.Errorf("expected list, got %T", v))
+	}
+	return list, nil
+}
+
+type lenientConnectCtxKey struct{}
+
+// 兼容 Redis()、Elastic() 等旧接口：首次创建客户端时连接检查失败只打印错误，仍返回并缓存客户端，
+// 之后由驱动自动重连；严格检查只在 RedisE、ElasticE 中进行
+func lenientConnect(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lenientConnectCtxKey{}, true)
+}
+
+func isLenientConnect(ctx context.Context) bool {
+	lenient, _ := ctx.Value(lenientConnectCtxKey{}).(bool)
+	return lenient
+}
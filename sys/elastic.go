@@ -1,35 +1,44 @@
 package sys
 
 import (
-	"encoding/json"
-	"github.com/EricJSanchez/gotool/environment"
+	"context"
+	"fmt"
 	"github.com/olivere/elastic/v7"
 	"reflect"
 )
 
 var esManager = NewEsClientManager()
 
-func Elastic(names ...string) (client *elastic.Client) {
-	var name = Cfg("app").GetString("default_es")
+func init() {
+	addDatasource(esManager.Manager())
+}
 
-	if len(names) > 0 {
-		name = names[0]
-	}
-	var config map[string]interface{}
-	if environment.Is(environment.Development) {
-		config = Cfg("db").GetStringMap(name)
-		if len(config) == 0 {
-			config = Nacos("database.toml").GetStringMap(name)
-		}
-	} else {
-		config = Nacos("database.toml").GetStringMap(name)
+// Elastic 获取 Elasticsearch 客户端，names 为空时使用 app.toml 的 default_es，获取失败时返回 nil；
+// 与以往一致，集群不可用时只打印错误，仍返回客户端
+func Elastic(names ...string) (client *elastic.Client) {
+	client, err := elasticClient(lenientConnect(context.Background()), names)
+	if err != nil {
+		fmt.Println("Elastic err:", err)
+		return nil
 	}
-	connectUniq, _ := json.Marshal(config)
-	name = name + Md5(string(connectUniq))
-	client = esManager.Get(name, config)
 	return
 }
 
+// ElasticE 与 Elastic 相同，获取失败时返回 *DatasourceError，可通过 errors.Is 判断
+// ErrDatasourceNotConfigured、ErrInvalidDatasourceConfig、ErrConnectFailed。
+// 首次创建客户端时以 ctx 检查集群是否可用
+func ElasticE(ctx context.Context, names ...string) (*elastic.Client, error) {
+	return elasticClient(ctx, names)
+}
+
+func elasticClient(ctx context.Context, names []string) (*elastic.Client, error) {
+	name, config, err := datasourceConfig("elastic", "default_es", names)
+	if err != nil {
+		return nil, err
+	}
+	return esManager.GetE(ctx, name, config)
+}
+
 func EsToStruct[T any](result *elastic.SearchResult) (ret []T, err error) {
 	var typ *T
 	//遍历命中的数据，对数据进行类型断言，获取数据
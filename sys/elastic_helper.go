@@ -1,54 +1,85 @@
 package sys
 
 import (
+	"context"
 	"fmt"
 	"github.com/olivere/elastic/v7"
 	"log"
 	"net/http"
 	"os"
 	"strings"
-	"sync"
 	"time"
 )
 
 type EsClientManager struct {
-	rw      *sync.RWMutex
-	clients map[string]*elastic.Client
+	clients *ClientManager[*elastic.Client]
 }
 
 func NewEsClientManager() *EsClientManager {
-	return &EsClientManager{
-		rw:      &sync.RWMutex{},
-		clients: make(map[string]*elastic.Client),
-	}
+	m := &EsClientManager{}
+	m.clients = NewClientManager("elastic", ClientOptions[*elastic.Client]{
+		Factory: m.NewInstanceE,
+		HealthCheck: func(ctx context.Context, client *elastic.Client) error {
+			_, err := client.PerformRequest(ctx, elastic.PerformRequestOptions{Method: http.MethodHead, Path: "/"})
+			return err
+		},
+		Close: func(client *elastic.Client) error {
+			client.Stop()
+			return nil
+		},
+	})
+	return m
+}
+
+// Manager 返回底层的通用客户端管理器
+func (m *EsClientManager) Manager() *ClientManager[*elastic.Client] {
+	return m.clients
 }
 
 // 获取给定名称的 Es 客户端实例（如果客户端不存在则返回 nil）
 func (m *EsClientManager) Get(name string, config map[string]interface{}) *elastic.Client {
-	// 1、获取连接实例
-	m.rw.RLock()
-	if client, exists := m.clients[name]; exists {
-		m.rw.RUnlock()
-		return client
-	}
-	m.rw.RUnlock()
-
-	// 获取读写锁
-	m.rw.Lock()
-	defer m.rw.Unlock()
-
-	if client, exists := m.clients[name]; exists {
-		return client
+	client, err := m.GetE(context.Background(), name, config)
+	if err != nil {
+		fmt.Println("es实例化出错", err)
+		return nil
 	}
-	// 2、添加连接实例
-	client := m.NewInstance(config)
-	m.clients[name] = client
 	return client
 }
 
+// GetE 获取给定名称的 Es 客户端实例，不存在时创建，创建或连接失败的实例不会被缓存
+func (m *EsClientManager) GetE(ctx context.Context, name string, config map[string]interface{}) (*elastic.Client, error) {
+	return m.clients.Get(ctx, name, config)
+}
+
 // 创建连接实例
 func (m *EsClientManager) NewInstance(config map[string]interface{}) (client *elastic.Client) {
-	address := strings.Split(config["addresses"].(string), ",")
+	client, err := m.NewInstanceE(context.Background(), config)
+	if err != nil {
+		fmt.Println("es实例化出错", err)
+		return nil
+	}
+	return
+}
+
+// NewInstanceE 创建连接实例并以 ctx 检查节点是否可用，任一节点可用即可，配置有误时返回 ErrInvalidDatasourceConfig，
+// 连接失败时返回 ErrConnectFailed
+func (m *EsClientManager) NewInstanceE(ctx context.Context, config map[string]interface{}) (*elastic.Client, error) {
+	addresses, err := dsString(config, "addresses", true)
+	if err != nil {
+		return nil, err
+	}
+	username, err := dsString(config, "username", false)
+	if err != nil {
+		return nil, err
+	}
+	password, err := dsString(config, "password", false)
+	if err != nil {
+		return nil, err
+	}
+	address := strings.Split(addresses, ",")
+	for i := range address {
+		address[i] = strings.TrimSpace(address[i])
+	}
 	client, err := elastic.NewClient(
 
 		elastic.SetHealthcheck(false),
@@ -58,8 +89,8 @@ func (m *EsClientManager) NewInstance(config map[string]interface{}) (client *el
 
 		elastic.SetURL(address...),
 		elastic.SetBasicAuth(
-			config["username"].(string),
-			config["password"].(string),
+			username,
+			password,
 		),
 		elastic.SetSniff(false),
 		//elastic.SetHealthcheckInterval(10*time.Second),
@@ -73,16 +104,29 @@ func (m *EsClientManager) NewInstance(config map[string]interface{}) (client *el
 		}),
 	)
 	if err != nil {
-		fmt.Println("es实例化出错", err)
+		return nil, &DatasourceError{Err: ErrConnectFailed, Cause: err}
 	}
-	return
+	if err = pingAny(ctx, client, address); err != nil {
+		if !isLenientConnect(ctx) {
+			client.Stop()
+			return nil, &DatasourceError{Err: ErrConnectFailed, Cause: err}
+		}
+		fmt.Println("es连接失败", err)
+	}
+	return client, nil
+}
+
+// 依次检查各节点，任一节点可用即可，均不可用时返回最后一个错误
+func pingAny(ctx context.Context, client *elastic.Client, address []string) (err error) {
+	for _, addr := range address {
+		if _, _, err = client.Ping(addr).Do(ctx); err == nil {
+			return nil
+		}
+	}
+	return err
 }
 
 // 清空 Es 客户端实例
 func (m *EsClientManager) Clear() {
-	m.rw.Lock()
-	defer m.rw.Unlock()
-	for k := range m.clients {
-		delete(m.clients, k)
-	}
+	m.clients.Clear()
 }
@@ -1,30 +1,46 @@
 package sys
 
 import (
-	"encoding/json"
-	"github.com/EricJSanchez/gotool/environment"
+	"context"
+	"fmt"
+
 	"gorm.io/gorm"
 )
 
 var gormManager = NewGormClientManager()
 
+func init() {
+	addDatasource(gormManager.Manager())
+}
+
+// Gorm 获取数据库连接，names 为空时使用 app.toml 的 default_db，获取失败时返回 nil
 func Gorm(names ...string) (client *gorm.DB) {
-	var name = Cfg("app").GetString("default_db")
+	client, err := gormClient(names)
+	if err != nil {
+		fmt.Println("Gorm err:", err)
+		return nil
+	}
+	return
+}
 
-	if len(names) > 0 {
-		name = names[0]
+// GormE 与 Gorm 相同，获取失败时返回 *DatasourceError，可通过 errors.Is 判断
+// ErrDatasourceNotConfigured、ErrInvalidDatasourceConfig、ErrConnectFailed。
+// 返回的连接已绑定 ctx，ctx 中有 sys.Tx 开启的同一数据源的事务时返回该事务
+func GormE(ctx context.Context, names ...string) (*gorm.DB, error) {
+	if tx, ok := txFromContext(ctx, names); ok {
+		return tx.WithContext(ctx), nil
 	}
-	var config map[string]interface{}
-	if environment.Is(environment.Development) {
-		config = Cfg("db").GetStringMap(name)
-		if len(config) == 0 {
-			config = Nacos("database.toml").GetStringMap(name)
-		}
-	} else {
-		config = Nacos("database.toml").GetStringMap(name)
+	client, err := gormClient(names)
+	if err != nil {
+		return nil, err
 	}
-	connectUniq, _ := json.Marshal(config)
-	name = name + Md5(string(connectUniq))
-	client = gormManager.Get(name, config)
-	return
+	return client.WithContext(ctx), nil
+}
+
+func gormClient(names []string) (*gorm.DB, error) {
+	name, config, err := datasourceConfig("gorm", "default_db", names)
+	if err != nil {
+		return nil, err
+	}
+	return gormManager.GetE(name, config)
 }
@@ -0,0 +1,339 @@
+package sys
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+)
+
+// AuditRecord 一次写操作的审计记录
+type AuditRecord struct {
+	Time     time.Time `json:"time" gorm:"column:created_at"`
+	Database string    `json:"database" gorm:"column:database_name"`
+	Table    string    `json:"table" gorm:"column:table_name"`
+	Op       string    `json:"op" gorm:"column:operation"` // create、update、delete
+	SQL      string    `json:"sql" gorm:"column:sql_text"`
+	Vars     string    `json:"vars" gorm:"column:vars"` // 绑定参数的 JSON 数组
+	Rows     int64     `json:"rows" gorm:"column:rows_affected"`
+	Error    string    `json:"error,omitempty" gorm:"column:error"`
+	Caller   string    `json:"caller" gorm:"column:caller"`
+	User     string    `json:"user,omitempty" gorm:"column:user_id"`
+	Tenant   string    `json:"tenant,omitempty" gorm:"column:tenant_id"`
+}
+
+// AuditSink 审计记录的去处
+type AuditSink interface {
+	Write(ctx context.Context, record AuditRecord) error
+}
+
+// AuditSinkFactory 根据数据源 audit 配置创建 AuditSink
+type AuditSinkFactory func(config map[string]interface{}) (AuditSink, error)
+
+var (
+	auditSinks = map[string]AuditSinkFactory{
+		"log":   newLogAuditSink,
+		"redis": newRedisAuditSink,
+		"table": newTableAuditSink,
+	}
+	auditSinksRw sync.RWMutex
+)
+
+// RegisterAuditSink 注册审计记录的去处，数据源配置 audit.sink = name 时使用，可覆盖内置的 log、redis、table
+func RegisterAuditSink(name string, factory AuditSinkFactory) {
+	auditSinksRw.Lock()
+	auditSinks[name] = factory
+	auditSinksRw.Unlock()
+}
+
+type auditorCtxKey struct{}
+
+type auditor struct {
+	user, tenant string
+}
+
+// WithAuditor 返回携带操作人与租户的 ctx，审计记录从中读取 User，Tenant 取 sys.Tenant(ctx)
+//
+//	db, _ := sys.GormE(sys.WithAuditor(ctx, staffId, corpId))
+func WithAuditor(ctx context.Context, user, tenant string) context.Context {
+	return context.WithValue(ctx, auditorCtxKey{}, auditor{user: user, tenant: tenant})
+}
+
+// Auditor 返回 ctx 中的操作人与租户
+func Auditor(ctx context.Context) (user, tenant string) {
+	if ctx == nil {
+		return
+	}
+	a, _ := ctx.Value(auditorCtxKey{}).(auditor)
+	return a.user, a.tenant
+}
+
+type skipAuditCtxKey struct{}
+
+// 审计插件，按数据源配置记录 create、update、delete：
+//
+//	[db-scrm.audit]
+//	enable  = true
+//	tables  = ["ww_*"]                    # 记录的表，支持 path.Match 通配符，为空时记录所有表
+//	exclude = ["ww_temp_*"]               # 排除的表
+//	ops     = ["create", "update", "delete"]
+//	sink    = "log"                       # log、redis、table 或 RegisterAuditSink 注册的名称
+//	key     = "gotool:audit"              # redis：写入的列表
+//	redis   = "redis-default"             # redis：数据源名称，缺省为 app.toml 的 default_redis
+//	table   = "audit_log"                 # table：写入的表，列见 AuditRecord 的 gorm 标签
+//	db      = "db-audit"                  # table：数据源名称，缺省为当前数据源
+type gormAudit struct {
+	database string
+	tables   []string
+	exclude  []string
+	ops      map[string]bool
+	sink     AuditSink
+}
+
+var auditOps = []string{"create", "update", "delete"}
+
+// 按数据源配置中的 audit 注册审计插件
+func useAudit(client *gorm.DB, config map[string]interface{}) error {
+	raw, ok := config["audit"]
+	if !ok || raw == nil {
+		return nil
+	}
+	audit, err := cast.ToStringMapE(raw)
+	if err != nil {
+		return invalidDatasourceConfig("audit", fmt.Errorf("expected table, got %T", raw))
+	}
+	enable, err := dsBool(audit, "enable", true)
+	if err != nil || !enable {
+		return auditConfigError(err)
+	}
+	a := &gormAudit{ops: make(map[string]bool)}
+	a.database, _ = dsString(config, "database", false)
+	if a.tables, err = dsStrings(audit, "tables"); err != nil {
+		return auditConfigError(err)
+	}
+	if a.exclude, err = dsStrings(audit, "exclude"); err != nil {
+		return auditConfigError(err)
+	}
+	for _, pattern := range append(append([]string(nil), a.tables...), a.exclude...) {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return invalidDatasourceConfig("audit.tables", fmt.Errorf("bad pattern %q", pattern))
+		}
+	}
+	ops, err := dsStrings(audit, "ops")
+	if err != nil {
+		return auditConfigError(err)
+	}
+	if len(ops) == 0 {
+		ops = auditOps
+	}
+	for _, op := range ops {
+		if !inStrings(op, auditOps) {
+			return invalidDatasourceConfig("audit.ops", fmt.Errorf("unsupported op %q", op))
+		}
+		a.ops[op] = true
+	}
+	sinkName, err := dsString(audit, "sink", false)
+	if err != nil {
+		return auditConfigError(err)
+	}
+	if sinkName == "" {
+		sinkName = "log"
+	}
+	auditSinksRw.RLock()
+	factory, ok := auditSinks[sinkName]
+	auditSinksRw.RUnlock()
+	if !ok {
+		return invalidDatasourceConfig("audit.sink", fmt.Errorf("unsupported sink %q", sinkName))
+	}
+	if a.sink, err = factory(audit); err != nil {
+		return auditConfigError(err)
+	}
+	// 写入当前数据源的审计表不再记录，避免循环
+	if ts, isTable := a.sink.(*tableAuditSink); isTable && ts.db == "" {
+		ts.client = client
+		a.exclude = append(a.exclude, ts.table)
+	}
+	return client.Use(a)
+}
+
+// 出错的配置项加上 audit. 前缀
+func auditConfigError(err error) error {
+	return prefixConfigError("audit", err)
+}
+
+func (a *gormAudit) Name() string {
+	return "gotool:audit"
+}
+
+func (a *gormAudit) Initialize(db *gorm.DB) error {
+	if a.ops["create"] {
+		if err := db.Callback().Create().After("gorm:create").Register("gotool:audit", a.record("create")); err != nil {
+			return err
+		}
+	}
+	if a.ops["update"] {
+		if err := db.Callback().Update().After("gorm:update").Register("gotool:audit", a.record("update")); err != nil {
+			return err
+		}
+	}
+	if a.ops["delete"] {
+		if err := db.Callback().Delete().After("gorm:delete").Register("gotool:audit", a.record("delete")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *gormAudit) record(op string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if ctx.Value(skipAuditCtxKey{}) != nil || db.Statement.SQL.Len() == 0 || !a.match(db.Statement.Table) {
+			return
+		}
+		vars, _ := json.Marshal(db.Statement.Vars)
+		rec := AuditRecord{
+			Time:     time.Now(),
+			Database: a.database,
+			Table:    db.Statement.Table,
+			Op:       op,
+			SQL:      db.Statement.SQL.String(),
+			Vars:     string(vars),
+			Rows:     db.RowsAffected,
+			Caller:   gormCaller(),
+		}
+		if db.Error != nil {
+			rec.Error = db.Error.Error()
+		}
+		rec.User, _ = Auditor(ctx)
+		rec.Tenant = Tenant(ctx)
+		if err := a.sink.Write(ctx, rec); err != nil {
+			fmt.Println("audit", rec.Table, op, "err:", err)
+		}
+	}
+}
+
+func (a *gormAudit) match(table string) bool {
+	if table == "" {
+		return false
+	}
+	for _, pattern := range a.exclude {
+		if ok, _ := path.Match(pattern, table); ok {
+			return false
+		}
+	}
+	if len(a.tables) == 0 {
+		return true
+	}
+	for _, pattern := range a.tables {
+		if ok, _ := path.Match(pattern, table); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 写入 sys.Log，未初始化日志时输出到标准输出
+type logAuditSink struct{}
+
+func newLogAuditSink(config map[string]interface{}) (AuditSink, error) {
+	return logAuditSink{}, nil
+}
+
+func (logAuditSink) Write(ctx context.Context, record AuditRecord) error {
+	if Log() == nil {
+		b, _ := json.Marshal(record)
+		fmt.Println("audit", string(b))
+		return nil
+	}
+	Log().WithFields(map[string]interface{}{
+		"audit":    true,
+		"database": record.Database,
+		"table":    record.Table,
+		"op":       record.Op,
+		"sql":      record.SQL,
+		"vars":     record.Vars,
+		"rows":     record.Rows,
+		"error":    record.Error,
+		"caller":   record.Caller,
+		"user":     record.User,
+		"tenant":   record.Tenant,
+	}).Info("gorm audit")
+	return nil
+}
+
+// 以 JSON 写入 Redis 列表
+type redisAuditSink struct {
+	redis string
+	key   string
+}
+
+func newRedisAuditSink(config map[string]interface{}) (AuditSink, error) {
+	s := &redisAuditSink{}
+	var err error
+	if s.redis, err = dsString(config, "redis", false); err != nil {
+		return nil, err
+	}
+	if s.key, err = dsString(config, "key", false); err != nil {
+		return nil, err
+	}
+	if s.key == "" {
+		s.key = "gotool:audit"
+	}
+	return s, nil
+}
+
+func (s *redisAuditSink) Write(ctx context.Context, record AuditRecord) error {
+	var names []string
+	if s.redis != "" {
+		names = append(names, s.redis)
+	}
+	rds, err := RedisE(ctx, names...)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return rds.RPush(ctx, s.key, b).Err()
+}
+
+// 写入数据库表
+type tableAuditSink struct {
+	db     string
+	table  string
+	client *gorm.DB // 写入当前数据源时使用
+}
+
+func newTableAuditSink(config map[string]interface{}) (AuditSink, error) {
+	s := &tableAuditSink{}
+	var err error
+	if s.table, err = dsString(config, "table", true); err != nil {
+		return nil, err
+	}
+	if s.db, err = dsString(config, "db", false); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *tableAuditSink) Write(ctx context.Context, record AuditRecord) error {
+	// 不在业务事务中写入，业务回滚时仍保留审计记录
+	client := s.client
+	if client == nil {
+		var err error
+		if client, err = gormClient([]string{s.db}); err != nil {
+			return err
+		}
+	}
+	ctx = context.WithValue(withoutTx(ctx), skipAuditCtxKey{}, true)
+	return client.WithContext(ctx).Table(s.table).Create(&record).Error
+}
@@ -0,0 +1,526 @@
+package sys
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+)
+
+func init() {
+	// Find 到 map 时值为 interface{}，time.Time 需注册后才能 gob 编码
+	gob.Register(time.Time{})
+}
+
+// 查询缓存插件，按数据源配置开启，查询结果以 gob 编码写入 Redis：
+//
+//	[db-scrm.cache]
+//	enable       = true
+//	redis        = "redis-default"   # 数据源名称，缺省为 app.toml 的 default_redis
+//	prefix       = "gotool:cache"
+//	ttl          = "1m"              # sys.Cache 未指定 ttl 时的过期时间
+//	tables       = ["ww_staff*"]     # 这些表的查询默认缓存，支持 path.Match 通配符；其余查询使用 sys.Cache 时缓存
+//	lock_timeout = "3s"              # 缓存失效时只有一个请求查询数据库，其余请求最多等待的时长
+//	tx_delay     = "5s"              # db.Transaction 等自行管理的事务中写入后再次失效的延迟
+//
+// 缓存键由 SQL、参数及涉及表的版本号组成，经同一数据源的 Create、Update、Delete 写入并提交后版本号加一，
+// 旧缓存不再命中并随过期时间淘汰。只记录主表，Joins 或 Raw 涉及的其他表需在 sys.Cache 中列出，
+// Raw、Exec 写入的表需调用 InvalidateGormCache。事务中、带 FOR UPDATE 等锁定子句的查询不使用缓存
+type gormCache struct {
+	datasource  string
+	redis       string
+	prefix      string
+	ttl         time.Duration
+	tables      []string
+	lockTimeout time.Duration
+	txDelay     time.Duration  // 自行管理的事务中写入后再次失效的延迟
+	query       func(*gorm.DB) // 原 gorm:query
+	flight      cacheFlight
+	stat        *cacheStat
+}
+
+const (
+	cacheKey   = "gotool:cache"
+	noCacheKey = "gotool:no_cache"
+)
+
+// 查询结果无法编码，合并的请求各自查询
+var errNotCacheable = errors.New("query result not cacheable")
+
+type cacheOption struct {
+	ttl    time.Duration
+	tables []string
+}
+
+// Cache 缓存本次查询，ttl 为 0 时使用数据源配置的 ttl，tables 为查询涉及的其他表，这些表写入后缓存失效
+//
+//	db.Scopes(sys.Cache(time.Minute)).Where("corp_id = ?", corpId).Find(&staffs)
+//	staffs.Find(ctx, sys.Cache(0, "ww_department"), sys.Where("dept_id = ?", deptId))
+func Cache(ttl time.Duration, tables ...string) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Set(cacheKey, cacheOption{ttl: ttl, tables: tables})
+	}
+}
+
+// NoCache 本次查询不使用缓存，用于 tables 中配置了默认缓存的表
+func NoCache(db *gorm.DB) *gorm.DB {
+	return db.Set(noCacheKey, true)
+}
+
+// 按数据源配置中的 cache 注册查询缓存插件
+func useCache(client *gorm.DB, name string, config map[string]interface{}) error {
+	raw, ok := config["cache"]
+	if !ok || raw == nil {
+		return nil
+	}
+	cfg, err := cast.ToStringMapE(raw)
+	if err != nil {
+		return invalidDatasourceConfig("cache", fmt.Errorf("expected table, got %T", raw))
+	}
+	enable, err := dsBool(cfg, "enable", true)
+	if err != nil || !enable {
+		return prefixConfigError("cache", err)
+	}
+	c := &gormCache{datasource: name, stat: gormCacheStat(name)}
+	if c.redis, err = dsString(cfg, "redis", false); err != nil {
+		return prefixConfigError("cache", err)
+	}
+	if c.prefix, err = dsString(cfg, "prefix", false); err != nil {
+		return prefixConfigError("cache", err)
+	}
+	if c.prefix == "" {
+		c.prefix = "gotool:cache"
+	}
+	if c.ttl, err = dsDuration(cfg, "ttl", time.Second, time.Minute); err != nil {
+		return prefixConfigError("cache", err)
+	}
+	if c.lockTimeout, err = dsDuration(cfg, "lock_timeout", time.Second, 3*time.Second); err != nil {
+		return prefixConfigError("cache", err)
+	}
+	if c.txDelay, err = dsDuration(cfg, "tx_delay", time.Second, 5*time.Second); err != nil {
+		return prefixConfigError("cache", err)
+	}
+	if c.tables, err = dsStrings(cfg, "tables"); err != nil {
+		return prefixConfigError("cache", err)
+	}
+	for _, pattern := range c.tables {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return invalidDatasourceConfig("cache.tables", fmt.Errorf("bad pattern %q", pattern))
+		}
+	}
+	return client.Use(c)
+}
+
+func (c *gormCache) Name() string {
+	return "gotool:cache"
+}
+
+func (c *gormCache) Initialize(db *gorm.DB) error {
+	if c.query = db.Callback().Query().Get("gorm:query"); c.query == nil {
+		return errors.New("gorm:query callback not found")
+	}
+	if err := db.Callback().Query().Replace("gorm:query", c.queryCallback); err != nil {
+		return err
+	}
+	// gorm 为单条写入开启的事务提交之后再失效，否则提交前的查询可能以新版本号写入旧数据
+	const commit = "gorm:commit_or_rollback_transaction"
+	if err := db.Callback().Create().After(commit).Register("gotool:cache", c.invalidate); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After(commit).Register("gotool:cache", c.invalidate); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After(commit).Register("gotool:cache", c.invalidate)
+}
+
+// 本次查询是否使用缓存及过期时间
+func (c *gormCache) option(db *gorm.DB) (cacheOption, bool) {
+	stmt := db.Statement
+	if db.Error != nil {
+		return cacheOption{}, false
+	}
+	if v, ok := db.Get(noCacheKey); ok && v == true {
+		return cacheOption{}, false
+	}
+	opt, ok := db.Get(cacheKey)
+	o, _ := opt.(cacheOption)
+	if !ok && !c.match(stmt.Table) {
+		return cacheOption{}, false
+	}
+	if _, inTx := stmt.ConnPool.(gorm.TxCommitter); inTx {
+		return cacheOption{}, false
+	}
+	if _, locking := stmt.Clauses["FOR"]; locking {
+		return cacheOption{}, false
+	}
+	if rv := reflect.ValueOf(stmt.Dest); rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return cacheOption{}, false
+	}
+	if o.ttl <= 0 {
+		o.ttl = c.ttl
+	}
+	return o, true
+}
+
+func (c *gormCache) match(table string) bool {
+	for _, pattern := range c.tables {
+		if ok, _ := path.Match(pattern, table); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *gormCache) client(ctx context.Context) (*redis.Client, error) {
+	var names []string
+	if c.redis != "" {
+		names = append(names, c.redis)
+	}
+	return RedisE(ctx, names...)
+}
+
+func (c *gormCache) queryCallback(db *gorm.DB) {
+	opt, ok := c.option(db)
+	if !ok {
+		c.query(db)
+		return
+	}
+	callbacks.BuildQuerySQL(db)
+	if db.Error != nil {
+		return
+	}
+	ctx := db.Statement.Context
+	rds, err := c.client(ctx)
+	if err != nil {
+		c.fail(err)
+		c.query(db)
+		return
+	}
+	tables := opt.tables
+	if db.Statement.Table != "" {
+		tables = append([]string{db.Statement.Table}, tables...)
+	}
+	key, err := c.key(ctx, rds, db, tables)
+	if err != nil {
+		c.fail(err)
+		c.query(db)
+		return
+	}
+	data, err := rds.Get(ctx, key).Bytes()
+	if err == nil {
+		if err = loadCache(db, data); err == nil {
+			atomic.AddInt64(&c.stat.hits, 1)
+			return
+		}
+		c.fail(err)
+	} else if err != redis.Nil {
+		c.fail(err)
+	}
+	atomic.AddInt64(&c.stat.misses, 1)
+
+	data, err, shared := c.flight.do(key, func() ([]byte, error) {
+		return c.fill(ctx, rds, db, key, opt.ttl)
+	})
+	if !shared {
+		// 本请求已执行查询，结果在 db 中
+		return
+	}
+	if err != nil {
+		// 执行查询的请求出错（含其 ctx 取消、超时）或结果不可缓存时自行查询，只返回本请求的错误
+		c.query(db)
+		return
+	}
+	if err = loadCache(db, data); err != nil {
+		c.fail(err)
+		c.query(db)
+	}
+}
+
+// 查询数据库并写入缓存；其他进程正在查询时等待其结果，超过 lock_timeout 后自行查询
+func (c *gormCache) fill(ctx context.Context, rds *redis.Client, db *gorm.DB, key string, ttl time.Duration) ([]byte, error) {
+	lock := key + ":lock"
+	locked, err := rds.SetNX(ctx, lock, 1, c.lockTimeout).Result()
+	if err != nil {
+		c.fail(err)
+	}
+	if err == nil && !locked {
+		if data, ok := c.wait(ctx, rds, key); ok {
+			if err = loadCache(db, data); err == nil {
+				return data, nil
+			}
+			c.fail(err)
+		}
+	}
+	c.query(db)
+	if locked {
+		defer rds.Del(context.Background(), lock)
+	}
+	if db.Error != nil {
+		return nil, db.Error
+	}
+	data, err := dumpCache(db)
+	if err != nil {
+		c.fail(err)
+		return nil, errNotCacheable
+	}
+	// 过期时间加上随机抖动，避免同时写入的缓存同时失效
+	ttl += time.Duration(rand.Int63n(int64(ttl)/10 + 1))
+	if err = rds.Set(ctx, key, data, ttl).Err(); err != nil {
+		c.fail(err)
+	}
+	return data, nil
+}
+
+// 等待其他进程写入缓存
+func (c *gormCache) wait(ctx context.Context, rds *redis.Client, key string) ([]byte, bool) {
+	deadline := time.Now().Add(c.lockTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-time.After(20 * time.Millisecond):
+		}
+		data, err := rds.Get(ctx, key).Bytes()
+		if err == nil {
+			return data, true
+		}
+		if err != redis.Nil {
+			c.fail(err)
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+func (c *gormCache) fail(err error) {
+	atomic.AddInt64(&c.stat.errors, 1)
+	fmt.Println("gorm cache", c.datasource, "err:", err)
+}
+
+func (c *gormCache) versionKey(table string) string {
+	return c.prefix + ":" + c.datasource + ":ver:" + table
+}
+
+// 缓存键：SQL 去除多余空白后与参数、结果类型、各表版本号一起取摘要
+func (c *gormCache) key(ctx context.Context, rds *redis.Client, db *gorm.DB, tables []string) (string, error) {
+	vars, err := json.Marshal(db.Statement.Vars)
+	if err != nil {
+		return "", err
+	}
+	var versions []interface{}
+	if len(tables) > 0 {
+		tables = uniqueStrings(tables)
+		keys := make([]string, len(tables))
+		for i, table := range tables {
+			keys[i] = c.versionKey(table)
+		}
+		if versions, err = rds.MGet(ctx, keys...).Result(); err != nil {
+			return "", err
+		}
+	}
+	var b strings.Builder
+	b.WriteString(strings.Join(strings.Fields(db.Statement.SQL.String()), " "))
+	b.WriteByte(0)
+	b.Write(vars)
+	fmt.Fprintf(&b, "\x00%T", db.Statement.Dest)
+	for i, table := range tables {
+		fmt.Fprintf(&b, "\x00%s=%v", table, versions[i])
+	}
+	return c.prefix + ":" + c.datasource + ":" + Md5(b.String()), nil
+}
+
+func uniqueStrings(list []string) []string {
+	list = append([]string(nil), list...)
+	sort.Strings(list)
+	ret := list[:0]
+	for i, v := range list {
+		if i == 0 || v != list[i-1] {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// 写入提交后使表的缓存失效：sys.Tx 中的写入在事务提交后失效；
+// db.Transaction、db.Begin 等自行管理的事务无法得知提交时间，立即失效并在 tx_delay 之后再次失效，
+// 超过 tx_delay 的事务仍可能被并发查询以旧数据写入缓存，开启缓存的表应使用 sys.Tx
+func (c *gormCache) invalidate(db *gorm.DB) {
+	table := db.Statement.Table
+	if db.Error != nil || db.RowsAffected == 0 || table == "" {
+		return
+	}
+	ctx := db.Statement.Context
+	bump := func() {
+		if err := c.bump(context.Background(), table); err != nil {
+			c.fail(err)
+		}
+	}
+	if scope, ok := ctx.Value(txCtxKey{c.datasource}).(*txScope); ok {
+		scope.afterCommit(bump)
+		return
+	}
+	bump()
+	if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx {
+		time.AfterFunc(c.txDelay, bump)
+	}
+}
+
+func (c *gormCache) bump(ctx context.Context, tables ...string) error {
+	rds, err := c.client(ctx)
+	if err != nil {
+		return err
+	}
+	pipe := rds.Pipeline()
+	for _, table := range tables {
+		pipe.Incr(ctx, c.versionKey(table))
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// InvalidateGormCache 使数据源 name 上 tables 的查询缓存失效，用于 Raw、Exec 或其他程序写入表之后，
+// 数据源未开启缓存时不做处理
+func InvalidateGormCache(ctx context.Context, name string, tables ...string) error {
+	client, err := gormClient([]string{name})
+	if err != nil {
+		return err
+	}
+	c, ok := client.Config.Plugins["gotool:cache"].(*gormCache)
+	if !ok || len(tables) == 0 {
+		return nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return c.bump(ctx, tables...)
+}
+
+// 缓存内容：影响行数与查询结果
+func dumpCache(db *gorm.DB) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(db.RowsAffected); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(db.Statement.Dest); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func loadCache(db *gorm.DB, data []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	var rows int64
+	if err := dec.Decode(&rows); err != nil {
+		return err
+	}
+	// gob 不传输零值字段，先清空 dest
+	dest := reflect.ValueOf(db.Statement.Dest).Elem()
+	dest.Set(reflect.Zero(dest.Type()))
+	if err := dec.Decode(db.Statement.Dest); err != nil {
+		return err
+	}
+	if dest.Kind() == reflect.Slice && dest.IsNil() {
+		dest.Set(reflect.MakeSlice(dest.Type(), 0, 0))
+	}
+	db.RowsAffected = rows
+	if rows == 0 && db.Statement.RaiseErrorOnNotFound {
+		db.AddError(gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// 进程内合并相同缓存键的并发查询
+type cacheFlight struct {
+	mu    sync.Mutex
+	calls map[string]*cacheCall
+}
+
+type cacheCall struct {
+	wg   sync.WaitGroup
+	data []byte
+	err  error
+}
+
+// 执行 fn 或等待正在执行的 fn，shared 为 true 表示结果来自其他请求
+func (f *cacheFlight) do(key string, fn func() ([]byte, error)) (data []byte, err error, shared bool) {
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]*cacheCall)
+	}
+	if call, ok := f.calls[key]; ok {
+		f.mu.Unlock()
+		call.wg.Wait()
+		return call.data, call.err, true
+	}
+	call := &cacheCall{}
+	call.wg.Add(1)
+	f.calls[key] = call
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		delete(f.calls, key)
+		f.mu.Unlock()
+		call.wg.Done()
+	}()
+	call.data, call.err = fn()
+	return call.data, call.err, false
+}
+
+// CacheStat 数据源查询缓存的命中统计
+type CacheStat struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	Errors int64 `json:"errors"`
+}
+
+type cacheStat struct {
+	hits, misses, errors int64
+}
+
+var (
+	cacheStats   = make(map[string]*cacheStat)
+	cacheStatsRw sync.Mutex
+)
+
+func gormCacheStat(name string) *cacheStat {
+	cacheStatsRw.Lock()
+	defer cacheStatsRw.Unlock()
+	s, ok := cacheStats[name]
+	if !ok {
+		s = &cacheStat{}
+		cacheStats[name] = s
+	}
+	return s
+}
+
+// GormCacheStats 返回各数据源查询缓存的命中、未命中及 Redis 出错次数
+func GormCacheStats() map[string]CacheStat {
+	cacheStatsRw.Lock()
+	defer cacheStatsRw.Unlock()
+	ret := make(map[string]CacheStat, len(cacheStats))
+	for name, s := range cacheStats {
+		ret[name] = CacheStat{
+			Hits:   atomic.LoadInt64(&s.hits),
+			Misses: atomic.LoadInt64(&s.misses),
+			Errors: atomic.LoadInt64(&s.errors),
+		}
+	}
+	return ret
+}
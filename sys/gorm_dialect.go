@@ -0,0 +1,548 @@
+package sys
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/clickhouse"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// 数据源可选配置项，均可省略：
+//
+//	[db-scrm]
+//	driver                   = "mysql"
+//	host                     = "127.0.0.1"
+//	username                 = "root"
+//	database                 = "scrm"
+//	max_conn                 = 50      # 最大连接数
+//	max_idle_conn            = 10      # 最大空闲连接数
+//	conn_max_lifetime        = "30s"   # 连接可复用的最长时间，整数按秒计
+//	conn_max_idle_time       = "0s"    # 连接最长空闲时间，0 为不限制
+//	prepare_stmt             = false   # 缓存预编译语句
+//	skip_default_transaction = false   # 单条写入不再开启事务
+//	ping                     = true    # 创建时检查连接
+//	table_prefix             = ""      # 表名前缀
+//	singular_table           = false   # 表名不使用复数
+//	slow_threshold           = "200ms" # 慢查询阈值，超过时以 warning 写入 sys.Log
+//	ignore_record_not_found  = true    # ErrRecordNotFound 不记为错误
+//	log_level                = "warn"  # silent、error、warn、info，优先于 Nacos 的 MysqlDebugLevel，可被 MysqlDebugLevels 覆盖
+//
+//	# mysql
+//	charset       = "utf8mb4"
+//	timeout       = "5s"
+//	read_timeout  = "0s"
+//	write_timeout = "0s"
+//	loc           = "Local"
+//	parse_time    = true
+//	tls           = ""                  # true、skip-verify、preferred，配置 tls_ca 等证书时默认为 true
+//	tls_ca        = "/path/ca.pem"
+//	tls_cert      = "/path/client.pem"
+//	tls_key       = "/path/client.key"
+//	params        = { interpolateParams = "true" }
+//
+//	# postgres
+//	sslmode                = "disable"
+//	sslrootcert            = "/path/ca.pem"
+//	sslcert                = "/path/client.pem"
+//	sslkey                 = "/path/client.key"
+//	timezone               = "Asia/Shanghai"
+//	connect_timeout        = 5
+//	prefer_simple_protocol = true
+//	params                 = { application_name = "scrm" }
+//
+//	# sqlite，database 为文件路径，可写作 "file::memory:?cache=shared"；
+//	# 驱动为 mattn/go-sqlite3，需要 cgo，CGO_ENABLED=0 编译时返回 ErrInvalidDatasourceConfig
+//	params = { _busy_timeout = "5000" }
+//
+//	# sqlserver
+//	timeout = "5s"
+//	params  = { encrypt = "disable" }
+//
+//	# clickhouse，username 缺省为 default
+//	timeout       = "5s"
+//	read_timeout  = "10s"
+//	write_timeout = "20s"
+//	params        = { compress = "true" }
+
+// DialectorFactory 根据数据源配置创建 gorm.Dialector，配置有误时返回 ErrInvalidDatasourceConfig
+type DialectorFactory func(config map[string]interface{}) (gorm.Dialector, error)
+
+var (
+	dialectors = map[string]DialectorFactory{
+		"mysql":      newMysqlDialector,
+		"postgres":   newPostgresDialector,
+		"sqlite":     newSqliteDialector,
+		"sqlserver":  newSqlserverDialector,
+		"clickhouse": newClickhouseDialector,
+	}
+	dialectorsRw sync.RWMutex
+)
+
+// RegisterDialector 注册 driver 对应的 Dialector，数据源配置 driver = name 时使用，
+// 可覆盖内置的 mysql、postgres、sqlite、sqlserver、clickhouse
+//
+//	sys.RegisterDialector("tidb", func(config map[string]interface{}) (gorm.Dialector, error) {
+//		return mysql.Open(cast.ToString(config["dsn"])), nil
+//	})
+func RegisterDialector(driver string, factory DialectorFactory) {
+	dialectorsRw.Lock()
+	dialectors[driver] = factory
+	dialectorsRw.Unlock()
+}
+
+// Dialectors 返回已注册的 driver
+func Dialectors() []string {
+	dialectorsRw.RLock()
+	defer dialectorsRw.RUnlock()
+	set := make(map[string]bool, len(dialectors))
+	for driver := range dialectors {
+		set[driver] = true
+	}
+	return sortedKeys(set)
+}
+
+// 根据 driver 创建 Dialector
+func (m *GormClientManager) dialector(config map[string]interface{}) (gorm.Dialector, error) {
+	driver, err := dsString(config, "driver", true)
+	if err != nil {
+		return nil, err
+	}
+	dialectorsRw.RLock()
+	factory, ok := dialectors[driver]
+	dialectorsRw.RUnlock()
+	if !ok {
+		return nil, invalidDatasourceConfig("driver", fmt.Errorf("unsupported driver %q, registered: %s", driver, strings.Join(Dialectors(), ", ")))
+	}
+	return factory(config)
+}
+
+// 根据数据源配置创建 gorm.Config，name 为数据源名称，level 为未配置 log_level 时的日志级别
+func gormOptions(name string, config map[string]interface{}, level logger.LogLevel) (*gorm.Config, error) {
+	prepareStmt, err := dsBool(config, "prepare_stmt", false)
+	if err != nil {
+		return nil, err
+	}
+	skipTx, err := dsBool(config, "skip_default_transaction", false)
+	if err != nil {
+		return nil, err
+	}
+	ping, err := dsBool(config, "ping", true)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := dsString(config, "table_prefix", false)
+	if err != nil {
+		return nil, err
+	}
+	singular, err := dsBool(config, "singular_table", false)
+	if err != nil {
+		return nil, err
+	}
+	log, err := newGormLogger(name, config, level)
+	if err != nil {
+		return nil, err
+	}
+	return &gorm.Config{
+		Logger:                 log,
+		PrepareStmt:            prepareStmt,
+		SkipDefaultTransaction: skipTx,
+		DisableAutomaticPing:   !ping,
+		NamingStrategy:         schema.NamingStrategy{TablePrefix: prefix, SingularTable: singular},
+	}, nil
+}
+
+// 连接池配置，主库与从库共用
+type gormPool struct {
+	maxOpen     int
+	maxIdle     int
+	maxLifetime time.Duration
+	maxIdleTime time.Duration
+}
+
+func poolOptions(config map[string]interface{}) (p gormPool, err error) {
+	if p.maxOpen, err = dsInt(config, "max_conn", 50); err != nil {
+		return
+	}
+	if p.maxIdle, err = dsInt(config, "max_idle_conn", 10); err != nil {
+		return
+	}
+	if p.maxLifetime, err = dsDuration(config, "conn_max_lifetime", time.Second, 30*time.Second); err != nil {
+		return
+	}
+	p.maxIdleTime, err = dsDuration(config, "conn_max_idle_time", time.Second, 0)
+	return
+}
+
+func (p gormPool) apply(pool *sql.DB) {
+	// SetMaxIdleConns 设置空闲连接池中连接的最大数量
+	pool.SetMaxIdleConns(p.maxIdle)
+	// SetMaxOpenConns 设置打开数据库连接的最大数量。
+	pool.SetMaxOpenConns(p.maxOpen)
+	// SetConnMaxLifetime 设置了连接可复用的最大时间。
+	pool.SetConnMaxLifetime(p.maxLifetime)
+	pool.SetConnMaxIdleTime(p.maxIdleTime)
+}
+
+// 读取 mysql、postgres 共用的连接配置
+func dbConnConfig(config map[string]interface{}) (host, username, password, database string, port int, err error) {
+	if host, err = dsString(config, "host", true); err != nil {
+		return
+	}
+	if port, err = dsInt(config, "port", 0); err != nil {
+		return
+	}
+	if username, err = dsString(config, "username", true); err != nil {
+		return
+	}
+	if password, err = dsString(config, "password", false); err != nil {
+		return
+	}
+	database, err = dsString(config, "database", true)
+	return
+}
+
+func newMysqlDialector(config map[string]interface{}) (gorm.Dialector, error) {
+	dsn, err := mysqlDSN(config)
+	if err != nil {
+		return nil, err
+	}
+	return mysql.Open(dsn), nil
+}
+
+func mysqlDSN(config map[string]interface{}) (string, error) {
+	host, username, password, database, port, err := dbConnConfig(config)
+	if err != nil {
+		return "", err
+	}
+	if port == 0 {
+		port = 3306
+	}
+	c := mysqldriver.NewConfig()
+	c.User = username
+	c.Passwd = password
+	c.Net = "tcp"
+	c.Addr = fmt.Sprintf("%s:%d", host, port)
+	c.DBName = database
+	c.Params = map[string]string{}
+
+	charset, err := dsString(config, "charset", false)
+	if err != nil {
+		return "", err
+	}
+	if charset == "" {
+		charset = "utf8mb4"
+	}
+	c.Params["charset"] = charset
+	if c.Timeout, err = dsDuration(config, "timeout", time.Second, 5*time.Second); err != nil {
+		return "", err
+	}
+	if c.ReadTimeout, err = dsDuration(config, "read_timeout", time.Second, 0); err != nil {
+		return "", err
+	}
+	if c.WriteTimeout, err = dsDuration(config, "write_timeout", time.Second, 0); err != nil {
+		return "", err
+	}
+	if c.ParseTime, err = dsBool(config, "parse_time", true); err != nil {
+		return "", err
+	}
+	loc, err := dsString(config, "loc", false)
+	if err != nil {
+		return "", err
+	}
+	if loc == "" {
+		loc = "Local"
+	}
+	if c.Loc, err = time.LoadLocation(loc); err != nil {
+		return "", invalidDatasourceConfig("loc", err)
+	}
+	if c.TLSConfig, err = mysqlTLS(config); err != nil {
+		return "", err
+	}
+	params, err := dsParams(config, "params")
+	if err != nil {
+		return "", err
+	}
+	for k, v := range params {
+		c.Params[k] = v
+	}
+	return c.FormatDSN(), nil
+}
+
+// 解析 tls 配置，配置了证书时注册自定义的 tls.Config 并返回其名称
+func mysqlTLS(config map[string]interface{}) (string, error) {
+	mode, err := dsString(config, "tls", false)
+	if err != nil {
+		return "", err
+	}
+	ca, err := dsString(config, "tls_ca", false)
+	if err != nil {
+		return "", err
+	}
+	cert, err := dsString(config, "tls_cert", false)
+	if err != nil {
+		return "", err
+	}
+	key, err := dsString(config, "tls_key", false)
+	if err != nil {
+		return "", err
+	}
+	if ca == "" && cert == "" && key == "" {
+		switch mode {
+		case "", "false", "true", "skip-verify", "preferred":
+			return mode, nil
+		}
+		return "", invalidDatasourceConfig("tls", fmt.Errorf("unsupported tls mode %q", mode))
+	}
+	if mode == "false" {
+		return "", nil
+	}
+	host, _ := dsString(config, "host", false)
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: mode == "skip-verify"}
+	if ca != "" {
+		pem, err := os.ReadFile(ca)
+		if err != nil {
+			return "", invalidDatasourceConfig("tls_ca", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return "", invalidDatasourceConfig("tls_ca", errors.New("no certificate found in "+ca))
+		}
+	}
+	if cert != "" || key != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return "", invalidDatasourceConfig("tls_cert", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+	name := "gotool-" + Md5(strings.Join([]string{host, mode, ca, cert, key}, "|"))
+	if err = mysqldriver.RegisterTLSConfig(name, tlsConfig); err != nil {
+		return "", invalidDatasourceConfig("tls", err)
+	}
+	return name, nil
+}
+
+func newPostgresDialector(config map[string]interface{}) (gorm.Dialector, error) {
+	dsn, err := postgresDSN(config)
+	if err != nil {
+		return nil, err
+	}
+	simple, err := dsBool(config, "prefer_simple_protocol", true)
+	if err != nil {
+		return nil, err
+	}
+	return postgres.New(postgres.Config{
+		DSN:                  dsn,
+		PreferSimpleProtocol: simple,
+	}), nil
+}
+
+func postgresDSN(config map[string]interface{}) (string, error) {
+	host, username, password, database, port, err := dbConnConfig(config)
+	if err != nil {
+		return "", err
+	}
+	if port == 0 {
+		port = 5432
+	}
+	params := map[string]string{
+		"host":     host,
+		"user":     username,
+		"password": password,
+		"dbname":   database,
+		"port":     fmt.Sprint(port),
+	}
+	timeout, err := dsDuration(config, "connect_timeout", time.Second, 5*time.Second)
+	if err != nil {
+		return "", err
+	}
+	params["connect_timeout"] = fmt.Sprint(int(timeout / time.Second))
+	for key, def := range map[string]string{"sslmode": "disable", "sslrootcert": "", "sslcert": "", "sslkey": "", "timezone": "Asia/Shanghai"} {
+		v, err := dsString(config, key, false)
+		if err != nil {
+			return "", err
+		}
+		if v == "" {
+			v = def
+		}
+		if v != "" {
+			params[key] = v
+		}
+	}
+	// pgx 只识别 TimeZone
+	params["TimeZone"] = params["timezone"]
+	delete(params, "timezone")
+	extra, err := dsParams(config, "params")
+	if err != nil {
+		return "", err
+	}
+	for k, v := range extra {
+		params[k] = v
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+pgQuote(params[k]))
+	}
+	return strings.Join(pairs, " "), nil
+}
+
+// 按 libpq 的 key=value 格式转义，空值及含空格、引号的值加单引号
+func pgQuote(v string) string {
+	if v != "" && !strings.ContainsAny(v, " '\\\t\n") {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+func newSqliteDialector(config map[string]interface{}) (gorm.Dialector, error) {
+	database, err := dsString(config, "database", true)
+	if err != nil {
+		return nil, err
+	}
+	params, err := dsParams(config, "params")
+	if err != nil {
+		return nil, err
+	}
+	if !sqliteAvailable {
+		return nil, invalidDatasourceConfig("driver", errors.New("sqlite requires cgo, build with CGO_ENABLED=1 and a C compiler"))
+	}
+	return sqlite.Open(withQuery(database, params)), nil
+}
+
+func newSqlserverDialector(config map[string]interface{}) (gorm.Dialector, error) {
+	dsn, err := sqlserverDSN(config)
+	if err != nil {
+		return nil, err
+	}
+	return sqlserver.Open(dsn), nil
+}
+
+func sqlserverDSN(config map[string]interface{}) (string, error) {
+	host, username, password, database, port, err := dbConnConfig(config)
+	if err != nil {
+		return "", err
+	}
+	if port == 0 {
+		port = 1433
+	}
+	timeout, err := dsDuration(config, "timeout", time.Second, 5*time.Second)
+	if err != nil {
+		return "", err
+	}
+	params, err := dsParams(config, "params")
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("database", database)
+	query.Set("connection timeout", fmt.Sprint(int(timeout/time.Second)))
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	u := url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(username, password),
+		Host:     fmt.Sprintf("%s:%d", host, port),
+		RawQuery: query.Encode(),
+	}
+	return u.String(), nil
+}
+
+func newClickhouseDialector(config map[string]interface{}) (gorm.Dialector, error) {
+	dsn, err := clickhouseDSN(config)
+	if err != nil {
+		return nil, err
+	}
+	return clickhouse.Open(dsn), nil
+}
+
+func clickhouseDSN(config map[string]interface{}) (string, error) {
+	host, err := dsString(config, "host", true)
+	if err != nil {
+		return "", err
+	}
+	port, err := dsInt(config, "port", 9000)
+	if err != nil {
+		return "", err
+	}
+	username, err := dsString(config, "username", false)
+	if err != nil {
+		return "", err
+	}
+	if username == "" {
+		username = "default"
+	}
+	password, err := dsString(config, "password", false)
+	if err != nil {
+		return "", err
+	}
+	database, err := dsString(config, "database", false)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("username", username)
+	query.Set("password", password)
+	if database != "" {
+		query.Set("database", database)
+	}
+	// clickhouse-go 的超时以秒计
+	for key, def := range map[string]time.Duration{"timeout": 5 * time.Second, "read_timeout": 0, "write_timeout": 0} {
+		d, err := dsDuration(config, key, time.Second, def)
+		if err != nil {
+			return "", err
+		}
+		if d > 0 {
+			query.Set(key, fmt.Sprint(d.Seconds()))
+		}
+	}
+	params, err := dsParams(config, "params")
+	if err != nil {
+		return "", err
+	}
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	u := url.URL{Scheme: "tcp", Host: fmt.Sprintf("%s:%d", host, port), RawQuery: query.Encode()}
+	return u.String(), nil
+}
+
+// 在 dsn 后追加查询参数
+func withQuery(dsn string, params map[string]string) string {
+	if len(params) == 0 {
+		return dsn
+	}
+	query := url.Values{}
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + query.Encode()
+}
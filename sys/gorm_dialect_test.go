@@ -0,0 +1,167 @@
+package sys
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+func TestMysqlDSN(t *testing.T) {
+	dsn, err := mysqlDSN(map[string]interface{}{
+		"host":         "db.local",
+		"username":     "root",
+		"password":     "p@ss:/w?d",
+		"database":     "scrm",
+		"read_timeout": 10,
+		"timeout":      "2s",
+		"loc":          "Asia/Shanghai",
+		"tls":          "skip-verify",
+		"params":       map[string]interface{}{"interpolateParams": "true", "charset": "latin1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 以驱动自身的解析结果校验，密码中的特殊字符不需要转义
+	c, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("ParseDSN(%s): %v", dsn, err)
+	}
+	if c.User != "root" || c.Passwd != "p@ss:/w?d" || c.Net != "tcp" || c.Addr != "db.local:3306" || c.DBName != "scrm" {
+		t.Fatalf("conn %+v", c)
+	}
+	if c.Timeout != 2*time.Second || c.ReadTimeout != 10*time.Second || c.WriteTimeout != 0 || !c.ParseTime {
+		t.Fatalf("timeouts %v %v %v parseTime %v", c.Timeout, c.ReadTimeout, c.WriteTimeout, c.ParseTime)
+	}
+	if c.Loc.String() != "Asia/Shanghai" || c.TLSConfig != "skip-verify" {
+		t.Fatalf("loc %v tls %q", c.Loc, c.TLSConfig)
+	}
+	// params 覆盖 charset，驱动识别的参数解析为对应字段
+	if !reflect.DeepEqual(c.Params, map[string]string{"charset": "latin1"}) || !c.InterpolateParams {
+		t.Fatalf("params %v interpolateParams %v", c.Params, c.InterpolateParams)
+	}
+
+	dsn, err = mysqlDSN(map[string]interface{}{"host": "db.local", "port": 33306, "username": "root", "database": "scrm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err = mysqldriver.ParseDSN(dsn); err != nil {
+		t.Fatal(err)
+	}
+	if c.Addr != "db.local:33306" || c.Params["charset"] != "utf8mb4" || c.Timeout != 5*time.Second || c.Loc != time.Local {
+		t.Fatalf("defaults %+v", c)
+	}
+}
+
+func TestPostgresDSN(t *testing.T) {
+	dsn, err := postgresDSN(map[string]interface{}{
+		"host":     "pg.local",
+		"username": "scrm",
+		"password": `it's a \secret`,
+		"database": "scrm",
+		"sslmode":  "require",
+		"params":   map[string]interface{}{"application_name": "my app"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `TimeZone=Asia/Shanghai application_name='my app' connect_timeout=5 dbname=scrm host=pg.local ` +
+		`password='it\'s a \\secret' port=5432 sslmode=require user=scrm`
+	if dsn != want {
+		t.Fatalf("dsn\n got %s\nwant %s", dsn, want)
+	}
+}
+
+func TestPgQuote(t *testing.T) {
+	cases := map[string]string{
+		"plain":   "plain",
+		"":        "''",
+		"a b":     "'a b'",
+		"it's":    `'it\'s'`,
+		`c:\dir`:  `'c:\\dir'`,
+		"tab\tnl": "'tab\tnl'",
+		`\'`:      `'\\\''`,
+	}
+	for in, want := range cases {
+		if got := pgQuote(in); got != want {
+			t.Errorf("pgQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestSqlserverDSN(t *testing.T) {
+	dsn, err := sqlserverDSN(map[string]interface{}{
+		"host":     "mssql.local",
+		"username": "sa",
+		"password": "p@ss word",
+		"database": "scrm",
+		"timeout":  10,
+		"params":   map[string]interface{}{"encrypt": "disable"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, _ := u.User.Password()
+	if u.Scheme != "sqlserver" || u.Host != "mssql.local:1433" || u.User.Username() != "sa" || password != "p@ss word" {
+		t.Fatalf("dsn %s", dsn)
+	}
+	want := url.Values{"database": {"scrm"}, "connection timeout": {"10"}, "encrypt": {"disable"}}
+	if !reflect.DeepEqual(u.Query(), want) {
+		t.Fatalf("query %v, want %v", u.Query(), want)
+	}
+}
+
+func TestClickhouseDSN(t *testing.T) {
+	dsn, err := clickhouseDSN(map[string]interface{}{"host": "ch.local", "read_timeout": "1500ms", "params": map[string]interface{}{"debug": "true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{"username": {"default"}, "password": {""}, "timeout": {"5"}, "read_timeout": {"1.5"}, "debug": {"true"}}
+	if u.Scheme != "tcp" || u.Host != "ch.local:9000" || !reflect.DeepEqual(u.Query(), want) {
+		t.Fatalf("dsn %s", dsn)
+	}
+}
+
+func TestDSNInvalidConfig(t *testing.T) {
+	base := func(extra map[string]interface{}) map[string]interface{} {
+		config := map[string]interface{}{"host": "h", "username": "u", "database": "d"}
+		for k, v := range extra {
+			config[k] = v
+		}
+		return config
+	}
+	cases := []struct {
+		name   string
+		build  func(map[string]interface{}) (string, error)
+		config map[string]interface{}
+		key    string
+	}{
+		{"mysql host", mysqlDSN, map[string]interface{}{"username": "u", "database": "d"}, "host"},
+		{"mysql port", mysqlDSN, base(map[string]interface{}{"port": "x"}), "port"},
+		{"mysql loc", mysqlDSN, base(map[string]interface{}{"loc": "Nowhere/City"}), "loc"},
+		{"mysql tls", mysqlDSN, base(map[string]interface{}{"tls": "sometimes"}), "tls"},
+		{"mysql tls_ca", mysqlDSN, base(map[string]interface{}{"tls_ca": "/nonexistent/ca.pem"}), "tls_ca"},
+		{"mysql params", mysqlDSN, base(map[string]interface{}{"params": "a=b"}), "params"},
+		{"postgres timeout", postgresDSN, base(map[string]interface{}{"connect_timeout": "soon"}), "connect_timeout"},
+		{"sqlserver database", sqlserverDSN, map[string]interface{}{"host": "h", "username": "u"}, "database"},
+		{"clickhouse host", clickhouseDSN, map[string]interface{}{}, "host"},
+	}
+	for _, c := range cases {
+		_, err := c.build(c.config)
+		var de *DatasourceError
+		if !errors.Is(err, ErrInvalidDatasourceConfig) || !errors.As(err, &de) || de.Key != c.key {
+			t.Errorf("%s: err %v, want invalid %s", c.name, err, c.key)
+		}
+	}
+}
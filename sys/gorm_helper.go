@@ -1,171 +1,156 @@
 package sys
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
-	"gorm.io/driver/mysql"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
-	"strings"
 	"sync"
-	"time"
 )
 
 type GormClientManager struct {
-	rw         *sync.RWMutex
-	clients    map[string]*gorm.DB
+	clients  *ClientManager[*gorm.DB]
+	replicas sync.Map // 主库 *sql.DB -> 从库 []*sql.DB
+	// DebugLevel 数据源未配置 log_level 且 Nacos 未配置 MysqlDebugLevel(s) 时的日志级别，需在创建客户端前设置，
+	// 运行时修改日志级别使用 SetGormLogLevel
 	DebugLevel int
 }
 
 func NewGormClientManager() *GormClientManager {
-	fmt.Println("-------------------NewGormClientManager-------------------")
-	return &GormClientManager{
-		rw:         &sync.RWMutex{},
-		clients:    make(map[string]*gorm.DB),
+	m := &GormClientManager{
 		DebugLevel: 4,
 	}
+	m.clients = NewClientManager("gorm", ClientOptions[*gorm.DB]{
+		Factory: func(ctx context.Context, config map[string]interface{}) (*gorm.DB, error) {
+			return m.newInstance(DatasourceName(ctx), config)
+		},
+		HealthCheck: func(ctx context.Context, client *gorm.DB) error {
+			pools, err := m.pools(client)
+			if err != nil {
+				return err
+			}
+			for _, pool := range pools {
+				if err = pool.PingContext(ctx); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Close: func(client *gorm.DB) error {
+			pools, err := m.pools(client)
+			if err != nil {
+				return err
+			}
+			m.replicas.Delete(pools[0])
+			for _, pool := range pools {
+				if e := pool.Close(); e != nil {
+					err = e
+				}
+			}
+			return err
+		},
+	})
+	return m
 }
 
-// 获取给定名称的 Gorm 客户端实例（如果客户端不存在则返回 nil）
-func (m *GormClientManager) Get(name string, config map[string]interface{}) *gorm.DB {
-	// 1、获取连接实例
-	//Log().Printf("获取数据库链接：%s 读锁", name)
-	m.rw.RLock()
-	liveDebugLevel := Nacos().GetInt("MysqlDebugLevel")
-	if client, exists := m.clients[name]; exists {
-		m.rw.RUnlock()
-		//log level
-		// Silent LogLevel = iota + 1
-		// Error
-		// Warn
-		// Info
-		if m.DebugLevel != liveDebugLevel {
-			m.clients[name] = client.Session(&gorm.Session{
-				Logger: client.Logger.LogMode(logger.LogLevel(liveDebugLevel)),
-			})
-			m.DebugLevel = liveDebugLevel
-		}
-		return m.clients[name]
+// 返回主库及所有从库的连接池，主库在前
+func (m *GormClientManager) pools(client *gorm.DB) ([]*sql.DB, error) {
+	sqlDB, err := client.DB()
+	if err != nil {
+		return nil, err
+	}
+	pools := []*sql.DB{sqlDB}
+	if replicas, ok := m.replicas.Load(sqlDB); ok {
+		pools = append(pools, replicas.([]*sql.DB)...)
 	}
-	m.rw.RUnlock()
+	return pools, nil
+}
 
-	// 获取读写锁
-	//Log().Printf("获取数据库链接：%s 读写锁", name)
-	m.rw.Lock()
-	defer m.rw.Unlock()
+// Manager 返回底层的通用客户端管理器
+func (m *GormClientManager) Manager() *ClientManager[*gorm.DB] {
+	return m.clients
+}
 
-	if client, exists := m.clients[name]; exists {
-		if m.DebugLevel != liveDebugLevel {
-			m.clients[name] = client.Session(&gorm.Session{
-				Logger: client.Logger.LogMode(logger.LogLevel(liveDebugLevel)),
-			})
-			m.DebugLevel = liveDebugLevel
-		}
-		return m.clients[name]
+// 获取给定名称的 Gorm 客户端实例（如果客户端不存在则返回 nil）
+func (m *GormClientManager) Get(name string, config map[string]interface{}) *gorm.DB {
+	client, err := m.GetE(name, config)
+	if err != nil {
+		fmt.Println("db_helper Get err: ", err)
+		return nil
 	}
-	// 2、添加连接实例
-	client := m.NewInstance(config)
-	m.clients[name] = client
-	//Log().Printf("获取数据库链接：%s 成功，新建链接", name)
 	return client
 }
 
-func beforeUpdate(client *gorm.DB) {
-	sql := client.Dialector.Explain(client.Statement.SQL.String(), client.Statement.Vars...)
-	//Log().Printf("设计的sql===", sql)
-	sql = strings.Replace(sql, ",", "分", -1)
-	sql = strings.Replace(sql, "'", "分", -1)
-	sql = strings.Replace(sql, "`", "分", -1)
-	sql = strings.Replace(sql, "=", "分", -1)
-
-	//sql= fmt.Sprintf("`%s`", sql)
-
-	//Log().Printf("设计的sql===", sql)
+// GetE 获取给定名称的 Gorm 客户端实例，不存在时创建，创建失败的实例不会被缓存
+func (m *GormClientManager) GetE(name string, config map[string]interface{}) (*gorm.DB, error) {
+	return m.clients.Get(context.Background(), name, config)
+}
 
-	if strings.Contains(sql, "ww_client_staff_union") && !strings.Contains(sql, "ww_temp_id") {
-		//err:=dao.Factory.WwTempIdDao.AddAgent(sql)
-		//
-		//if err != nil {
-		//	println("插入日志失败",err)
-		//}else{
-		//	println("插入日志成功",err)
-		//
-		//}
-		_ = client.Raw("INSERT INTO ww_temp_id ( unionid ) VALUES (@unionid)", map[string]interface{}{"unionid": sql}).Error
+// 创建连接实例
+func (m *GormClientManager) NewInstance(config map[string]interface{}) (client *gorm.DB) {
+	client, err := m.NewInstanceE(config)
+	if err != nil {
+		fmt.Println("db_helper NewInstance err: ", err)
+		return nil
 	}
+	return
+}
 
+// NewInstanceE 创建连接实例，配置有误时返回 ErrInvalidDatasourceConfig，连接失败时返回 ErrConnectFailed。
+// 连接池、DSN 及 gorm 的可选配置项见 gormOptions，配置了 replicas 时读请求分发到从库，见 useReplicas，
+// 配置了 audit 时记录写操作，见 gormAudit，
+// 声明了租户列的模型按 ctx 中的租户隔离，见 gormTenant，配置了 cache 时查询结果缓存到 Redis，见 gormCache，
+// SQL 日志写入 sys.Log，见 gormLogger
+func (m *GormClientManager) NewInstanceE(config map[string]interface{}) (*gorm.DB, error) {
+	return m.newInstance("", config)
 }
 
-// 创建连接实例
-func (m *GormClientManager) NewInstance(config map[string]interface{}) (client *gorm.DB) {
-	var dialector gorm.Dialector = nil
-	switch config["driver"] {
-	case "postgres":
-		dialector = m.newPostgresDialector(config)
-	case "mysql":
-		dialector = m.newMysqlDialector(config)
-	default:
+// name 为数据源名称，用于日志与 SQL 统计
+func (m *GormClientManager) newInstance(name string, config map[string]interface{}) (*gorm.DB, error) {
+	dialector, err := m.dialector(config)
+	if err != nil {
+		return nil, err
 	}
-	if dialector == nil {
-		return
+	opts, err := gormOptions(name, config, logger.LogLevel(m.DebugLevel))
+	if err != nil {
+		return nil, err
 	}
-	client, err := gorm.Open(dialector, &gorm.Config{
-		PrepareStmt:          false,
-		DisableAutomaticPing: false,
-	})
+	pool, err := poolOptions(config)
 	if err != nil {
-		fmt.Println("db_helper NewInstance err: ", err)
-		return nil
+		return nil, err
+	}
+	client, err := gorm.Open(dialector, opts)
+	if err != nil {
+		return nil, &DatasourceError{Err: ErrConnectFailed, Cause: err}
 	}
-	// 日志级别交由 nacos 配置
-	client = client.Session(&gorm.Session{
-		Logger: client.Logger.LogMode(logger.LogLevel(m.DebugLevel)),
-	})
 
 	sqlDB, err := client.DB()
 	if err != nil {
-		fmt.Println("db_helper NewInstance err: ", err)
-		return
+		return nil, &DatasourceError{Err: ErrConnectFailed, Cause: err}
 	}
-	// SetMaxIdleConns 设置空闲连接池中连接的最大数量
-	sqlDB.SetMaxIdleConns(int(config["max_idle_conn"].(int64)))
-	// SetMaxOpenConns 设置打开数据库连接的最大数量。
-	sqlDB.SetMaxOpenConns(int(config["max_conn"].(int64)))
-	// SetConnMaxLifetime 设置了连接可复用的最大时间。
-	sqlDB.SetConnMaxLifetime(time.Second * 30)
-	return
-}
+	pool.apply(sqlDB)
 
-func (m *GormClientManager) newMysqlDialector(config map[string]interface{}) gorm.Dialector {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=True&loc=Local&timeout=5s",
-		config["username"],
-		config["password"],
-		config["host"],
-		config["port"],
-		config["database"],
-		config["charset"])
-	return mysql.Open(dsn)
-}
-
-func (m *GormClientManager) newPostgresDialector(config map[string]interface{}) gorm.Dialector {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d connect_timeout=5 sslmode=disable TimeZone=Asia/Shanghai",
-		config["host"],
-		config["username"],
-		config["password"],
-		config["database"],
-		config["port"],
-	)
-	return postgres.New(postgres.Config{
-		DSN:                  dsn,
-		PreferSimpleProtocol: true,
-	})
+	if err = m.useReplicas(client, config, pool.apply); err != nil {
+		_ = sqlDB.Close()
+		return nil, err
+	}
+	if err = client.Use(&gormTenant{}); err != nil {
+		_ = m.clients.opts.Close(client)
+		return nil, err
+	}
+	if err = useAudit(client, config); err != nil {
+		_ = m.clients.opts.Close(client)
+		return nil, err
+	}
+	if err = useCache(client, name, config); err != nil {
+		_ = m.clients.opts.Close(client)
+		return nil, err
+	}
+	return client, nil
 }
 
 // 清空 Gorm 客户端实例
 func (m *GormClientManager) Clear() {
-	m.rw.Lock()
-	defer m.rw.Unlock()
-	for k := range m.clients {
-		delete(m.clients, k)
-	}
+	m.clients.Clear()
 }
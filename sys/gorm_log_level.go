@@ -0,0 +1,259 @@
+package sys
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+	"gorm.io/gorm/logger"
+)
+
+// 数据源的日志级别，越具体的配置越优先，按以下顺序取第一个配置了的值：
+//  1. Nacos 默认 dataId 中 [MysqlDebugLevels] 表下以数据源名称为键的值，如 db-scrm = 4
+//  2. 数据源配置中的 log_level
+//  3. Nacos 默认 dataId 中的 MysqlDebugLevel，对所有数据源生效
+//  4. GormClientManager.DebugLevel
+//
+// 远程配置加载及推送后重新计算所有数据源的级别，SetGormLogLevel 的修改保留到下一次推送。
+// 级别可写作 1-4 或 silent、error、warn、info
+type gormLevel struct {
+	level int32 // logger.LogLevel，原子读写
+	local int32 // 第 2 项，未配置时为 0
+	def   int32 // 第 4 项
+}
+
+func (l *gormLevel) get() logger.LogLevel {
+	return logger.LogLevel(atomic.LoadInt32(&l.level))
+}
+
+func (l *gormLevel) resolve(name string, remote *viper.Viper) logger.LogLevel {
+	return resolveGormLevel(name, logger.LogLevel(atomic.LoadInt32(&l.local)), logger.LogLevel(atomic.LoadInt32(&l.def)), remote)
+}
+
+var (
+	gormLevels      = make(map[string]*gormLevel)
+	gormLevelsRw    sync.RWMutex
+	gormLevelsWatch bool // 是否已订阅 Nacos 配置变更
+)
+
+// 返回数据源的日志级别，local 为数据源配置的 log_level，未配置时为 0，def 为缺省级别
+func gormLevelOf(name string, local, def logger.LogLevel) *gormLevel {
+	remote := gormLevelRemote()
+	gormLevelsRw.Lock()
+	defer gormLevelsRw.Unlock()
+	if !gormLevelsWatch {
+		gormLevelsWatch = watchGormLogLevels()
+	}
+	l, ok := gormLevels[name]
+	if !ok {
+		l = &gormLevel{}
+		gormLevels[name] = l
+	}
+	atomic.StoreInt32(&l.local, int32(local))
+	atomic.StoreInt32(&l.def, int32(def))
+	atomic.StoreInt32(&l.level, int32(l.resolve(name, remote)))
+	return l
+}
+
+// 订阅默认 dataId 的变更，尚未配置默认 dataId 时返回 false，需持有 gormLevelsRw 写锁
+func watchGormLogLevels() bool {
+	id := defaultDataId()
+	if id == "" {
+		return false
+	}
+	OnCfgChange(id, func(old, new *viper.Viper) {
+		gormLevelsRw.RLock()
+		defer gormLevelsRw.RUnlock()
+		updateGormLevels(new)
+	})
+	return true
+}
+
+// 按 remote 重新计算所有数据源的级别，需持有 gormLevelsRw
+func updateGormLevels(remote *viper.Viper) {
+	for name, l := range gormLevels {
+		level := l.resolve(name, remote)
+		if prev := atomic.SwapInt32(&l.level, int32(level)); prev != int32(level) {
+			fmt.Println("gorm", name, "log level", prev, "=>", level)
+		}
+	}
+}
+
+// 远程配置加载后调用：订阅默认 dataId 的变更，并按首次加载的内容重新计算已创建数据源的级别。
+// 首次加载不会触发 OnCfgChange，数据源可能先于远程配置创建
+func refreshGormLogLevels() {
+	remote := gormLevelRemote()
+	gormLevelsRw.Lock()
+	defer gormLevelsRw.Unlock()
+	if !gormLevelsWatch {
+		gormLevelsWatch = watchGormLogLevels()
+	}
+	if remote != nil {
+		updateGormLevels(remote)
+	}
+}
+
+// 已加载的默认 dataId 配置，未加载时为 nil
+func gormLevelRemote() *viper.Viper {
+	id := defaultDataId()
+	if id == "" {
+		return nil
+	}
+	nacosConfigRw.RLock()
+	_, ok := NacosConfig[id]
+	nacosConfigRw.RUnlock()
+	if !ok {
+		return nil
+	}
+	return Nacos(id)
+}
+
+func resolveGormLevel(name string, local, def logger.LogLevel, remote *viper.Viper) logger.LogLevel {
+	if remote != nil {
+		for k, v := range remote.GetStringMap("MysqlDebugLevels") {
+			// viper 的键不区分大小写
+			if strings.EqualFold(k, name) {
+				if level, err := ParseGormLogLevel(v); err == nil {
+					return level
+				}
+				fmt.Println("gorm", name, "invalid MysqlDebugLevels:", v)
+			}
+		}
+	}
+	if local != 0 {
+		return local
+	}
+	if remote != nil && remote.IsSet("MysqlDebugLevel") {
+		if level, err := ParseGormLogLevel(remote.Get("MysqlDebugLevel")); err == nil {
+			return level
+		}
+		fmt.Println("gorm invalid MysqlDebugLevel:", remote.Get("MysqlDebugLevel"))
+	}
+	return def
+}
+
+// ParseGormLogLevel 解析日志级别，支持 1-4 及 silent、error、warn、info
+func ParseGormLogLevel(v interface{}) (logger.LogLevel, error) {
+	if s, ok := v.(string); ok {
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "silent":
+			return logger.Silent, nil
+		case "error":
+			return logger.Error, nil
+		case "warn", "warning":
+			return logger.Warn, nil
+		case "info":
+			return logger.Info, nil
+		}
+	}
+	n, err := cast.ToIntE(v)
+	if err != nil || n < int(logger.Silent) || n > int(logger.Info) {
+		return 0, fmt.Errorf("invalid gorm log level %v", v)
+	}
+	return logger.LogLevel(n), nil
+}
+
+func gormLevelName(level logger.LogLevel) string {
+	switch level {
+	case logger.Silent:
+		return "silent"
+	case logger.Error:
+		return "error"
+	case logger.Warn:
+		return "warn"
+	case logger.Info:
+		return "info"
+	}
+	return fmt.Sprint(int(level))
+}
+
+// SetGormLogLevel 修改数据源的日志级别，name 为空时修改所有数据源，数据源未创建时返回错误
+func SetGormLogLevel(name string, level logger.LogLevel) error {
+	if level < logger.Silent || level > logger.Info {
+		return fmt.Errorf("invalid gorm log level %d", level)
+	}
+	gormLevelsRw.RLock()
+	defer gormLevelsRw.RUnlock()
+	if name == "" {
+		for _, l := range gormLevels {
+			atomic.StoreInt32(&l.level, int32(level))
+		}
+		return nil
+	}
+	l, ok := gormLevels[name]
+	if !ok {
+		return fmt.Errorf("gorm datasource %q not found", name)
+	}
+	atomic.StoreInt32(&l.level, int32(level))
+	return nil
+}
+
+// GormLogLevels 返回各数据源当前的日志级别
+func GormLogLevels() map[string]logger.LogLevel {
+	gormLevelsRw.RLock()
+	defer gormLevelsRw.RUnlock()
+	ret := make(map[string]logger.LogLevel, len(gormLevels))
+	for name, l := range gormLevels {
+		ret[name] = l.get()
+	}
+	return ret
+}
+
+// GormLogLevelHandler 查看与修改数据源日志级别的管理接口：
+//
+//	GET  /admin/gorm/log-level                             {"db-scrm":"warn"}
+//	POST /admin/gorm/log-level?datasource=db-scrm&level=info
+//
+// datasource 为空时修改所有数据源。authorize 判断请求是否有权访问，为 nil 时拒绝所有请求，
+// 可使用 BearerTokenAuth 或自行校验管理后台的登录态
+//
+//	http.Handle("/admin/gorm/log-level", sys.GormLogLevelHandler(sys.BearerTokenAuth(os.Getenv("ADMIN_TOKEN"))))
+func GormLogLevelHandler(authorize func(r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authorize == nil || !authorize(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost, http.MethodPut:
+			level, err := ParseGormLogLevel(r.FormValue("level"))
+			if err == nil {
+				err = SetGormLogLevel(r.FormValue("datasource"), level)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		levels := GormLogLevels()
+		ret := make(map[string]string, len(levels))
+		for name, level := range levels {
+			ret[name] = gormLevelName(level)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ret)
+	})
+}
+
+// BearerTokenAuth 返回校验请求头 Authorization: Bearer <token> 的 authorize，token 为空时拒绝所有请求
+func BearerTokenAuth(token string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		// 只有 token 而没有 Bearer 前缀的请求头不接受
+		scheme, got, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || scheme != "Bearer" || token == "" {
+			return false
+		}
+		return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+	}
+}
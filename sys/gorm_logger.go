@@ -0,0 +1,387 @@
+package sys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// gormLogger 将 gorm 的日志写入 sys.Log：出错的 SQL 记为 error（触发 ErrNoticeRdsKey 通知），
+// 超过 slow_threshold 的 SQL 记为 warning，日志级别为 Info 时记录全部 SQL，日志级别见 gormLevel。
+// 无论日志级别如何，每条 SQL 都按指纹计入 GormSQLStats。
+// 未调用 InitLog 时输出到标准输出
+type gormLogger struct {
+	name           string
+	level          *gormLevel
+	fixed          logger.LogLevel // LogMode 指定的级别，如 db.Debug()，为 0 时使用数据源的级别
+	slow           time.Duration
+	ignoreNotFound bool
+	std            [logger.Info + 1]logger.Interface // 各级别的标准输出日志
+}
+
+func newGormLogger(name string, config map[string]interface{}, base logger.LogLevel) (*gormLogger, error) {
+	slow, err := dsDuration(config, "slow_threshold", time.Millisecond, 200*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	ignoreNotFound, err := dsBool(config, "ignore_record_not_found", true)
+	if err != nil {
+		return nil, err
+	}
+	var local logger.LogLevel
+	if v, ok := config["log_level"]; ok && v != nil {
+		if local, err = ParseGormLogLevel(v); err != nil {
+			return nil, invalidDatasourceConfig("log_level", err)
+		}
+	}
+	l := &gormLogger{name: name, level: gormLevelOf(name, local, base), slow: slow, ignoreNotFound: ignoreNotFound}
+	for level := logger.Silent; level <= logger.Info; level++ {
+		l.std[level] = logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
+			SlowThreshold:             slow,
+			LogLevel:                  level,
+			IgnoreRecordNotFoundError: ignoreNotFound,
+			Colorful:                  true,
+		})
+	}
+	return l, nil
+}
+
+func (l *gormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	nl := *l
+	nl.fixed = level
+	return &nl
+}
+
+// 当前的日志级别
+func (l *gormLogger) current() logger.LogLevel {
+	if l.fixed != 0 {
+		return l.fixed
+	}
+	return l.level.get()
+}
+
+func (l *gormLogger) stdLogger(level logger.LogLevel) logger.Interface {
+	if level < logger.Silent || level > logger.Info {
+		level = logger.Info
+	}
+	return l.std[level]
+}
+
+func (l *gormLogger) entry() *logrus.Entry {
+	return Log().WithField("datasource", l.name)
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	level := l.current()
+	if level < logger.Info {
+		return
+	}
+	if Log() == nil {
+		l.stdLogger(level).Info(ctx, msg, data...)
+		return
+	}
+	l.entry().Infof(msg, data...)
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	level := l.current()
+	if level < logger.Warn {
+		return
+	}
+	if Log() == nil {
+		l.stdLogger(level).Warn(ctx, msg, data...)
+		return
+	}
+	l.entry().Warnf(msg, data...)
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	level := l.current()
+	if level < logger.Error {
+		return
+	}
+	if Log() == nil {
+		l.stdLogger(level).Error(ctx, msg, data...)
+		return
+	}
+	l.entry().Errorf(msg, data...)
+}
+
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	sql, rows := fc()
+	failed := err != nil && !(l.ignoreNotFound && errors.Is(err, gorm.ErrRecordNotFound))
+	slow := l.slow > 0 && elapsed > l.slow
+	fingerprint := SQLFingerprint(sql)
+	sqlStats.add(l.name, fingerprint, elapsed, failed, slow)
+
+	level := l.current()
+	if level <= logger.Silent {
+		return
+	}
+	if Log() == nil {
+		l.stdLogger(level).Trace(ctx, begin, func() (string, int64) { return sql, rows }, err)
+		return
+	}
+	fields := logrus.Fields{
+		"datasource":  l.name,
+		"duration_ms": float64(elapsed.Microseconds()) / 1000,
+		"rows":        rows,
+		"sql":         sql,
+		"fingerprint": fingerprint,
+		"caller":      gormCaller(),
+	}
+	switch {
+	case failed && level >= logger.Error:
+		fields["error"] = err.Error()
+		Log().WithFields(fields).Error("gorm error")
+	case slow && level >= logger.Warn:
+		fields["slow_threshold_ms"] = l.slow.Milliseconds()
+		Log().WithFields(fields).Warn("gorm slow query")
+	case level >= logger.Info:
+		Log().WithFields(fields).Info("gorm sql")
+	}
+}
+
+// 调用 gorm 的业务代码位置，跳过 gorm 与 sys 包
+func gormCaller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.Contains(frame.File, "gorm.io/") && !strings.Contains(frame.Function, "gotool/sys.") &&
+			!strings.HasPrefix(frame.Function, "runtime.") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+var (
+	sqlSpaces = regexp.MustCompile(`\s+`)
+	sqlInList = regexp.MustCompile(`\(\s*\?(\s*,\s*\?)+\s*\)`)
+	sqlValues = regexp.MustCompile(`(\(\?\+?\))(\s*,\s*\(\?\+?\))+`)
+)
+
+// SQLFingerprint 将 SQL 中的字符串（单引号）、数字替换为 ?，合并 IN 列表与多行 VALUES，
+// 使参数不同的同一条 SQL 得到相同的指纹；双引号、反引号内为标识符，原样保留
+//
+//	SELECT * FROM user WHERE id IN (1, 2, 3) AND name = 'a'
+//	=> SELECT * FROM user WHERE id IN (?+) AND name = ?
+func SQLFingerprint(sql string) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '"' || c == '`':
+			// Postgres、SQLite 的 "name" 与 MySQL 的 `name` 为标识符，原样保留
+			end := len(sql)
+			if j := strings.IndexByte(sql[i+1:], c); j >= 0 {
+				end = i + j + 2
+			}
+			b.WriteString(sql[i:end])
+			i = end - 1
+		case c == '\'':
+			// 跳过字符串，支持 '' 与 \' 转义
+			j := i + 1
+			for ; j < len(sql); j++ {
+				if sql[j] == '\\' {
+					j++
+				} else if sql[j] == c {
+					if j+1 < len(sql) && sql[j+1] == c {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			b.WriteByte('?')
+			i = j
+		case c >= '0' && c <= '9' && (i == 0 || !isIdentByte(sql[i-1])):
+			j := i
+			for j < len(sql) && (sql[j] >= '0' && sql[j] <= '9' || sql[j] == '.') {
+				j++
+			}
+			b.WriteByte('?')
+			i = j - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	fp := strings.TrimSpace(sqlSpaces.ReplaceAllString(b.String(), " "))
+	fp = sqlInList.ReplaceAllString(fp, "(?+)")
+	return sqlValues.ReplaceAllString(fp, "$1")
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '`' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// SQLStat 一个 SQL 指纹的执行统计
+type SQLStat struct {
+	Datasource  string        `json:"datasource"`
+	Fingerprint string        `json:"fingerprint"`
+	Count       int64         `json:"count"`
+	Errors      int64         `json:"errors"`
+	Slow        int64         `json:"slow"`
+	Total       time.Duration `json:"total"`
+	Max         time.Duration `json:"max"`
+}
+
+// MaxSQLFingerprints 每个数据源统计的指纹数上限，超出后计入 "other"
+var MaxSQLFingerprints = 1000
+
+type sqlStatKey struct {
+	datasource, fingerprint string
+}
+
+type sqlStatSet struct {
+	sync.Mutex
+	stats  map[sqlStatKey]*SQLStat
+	counts map[string]int // 数据源 -> 指纹数
+}
+
+var sqlStats = &sqlStatSet{stats: make(map[sqlStatKey]*SQLStat), counts: make(map[string]int)}
+
+func (s *sqlStatSet) add(datasource, fingerprint string, elapsed time.Duration, failed, slow bool) {
+	s.Lock()
+	defer s.Unlock()
+	key := sqlStatKey{datasource, fingerprint}
+	stat, ok := s.stats[key]
+	if !ok {
+		if s.counts[datasource] >= MaxSQLFingerprints {
+			key.fingerprint = "other"
+			stat = s.stats[key]
+		}
+		if stat == nil {
+			stat = &SQLStat{Datasource: datasource, Fingerprint: key.fingerprint}
+			s.stats[key] = stat
+			s.counts[datasource]++
+		}
+	}
+	stat.Count++
+	stat.Total += elapsed
+	if elapsed > stat.Max {
+		stat.Max = elapsed
+	}
+	if failed {
+		stat.Errors++
+	}
+	if slow {
+		stat.Slow++
+	}
+}
+
+// GormSQLStats 返回各 SQL 指纹的执行统计，按总耗时降序
+func GormSQLStats() []SQLStat {
+	sqlStats.Lock()
+	list := make([]SQLStat, 0, len(sqlStats.stats))
+	for _, stat := range sqlStats.stats {
+		list = append(list, *stat)
+	}
+	sqlStats.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Total != list[j].Total {
+			return list[i].Total > list[j].Total
+		}
+		return list[i].Fingerprint < list[j].Fingerprint
+	})
+	return list
+}
+
+// ResetGormSQLStats 清空 SQL 执行统计
+func ResetGormSQLStats() {
+	sqlStats.Lock()
+	sqlStats.stats = make(map[sqlStatKey]*SQLStat)
+	sqlStats.counts = make(map[string]int)
+	sqlStats.Unlock()
+}
+
+// WriteGormMetrics 以 Prometheus 文本格式输出 SQL 执行统计
+func WriteGormMetrics(w io.Writer) error {
+	stats := GormSQLStats()
+	metrics := []struct {
+		name, typ, help string
+		value           func(s SQLStat) string
+	}{
+		{"gotool_sql_queries_total", "counter", "SQL executions by fingerprint.", func(s SQLStat) string { return fmt.Sprint(s.Count) }},
+		{"gotool_sql_errors_total", "counter", "Failed SQL executions by fingerprint.", func(s SQLStat) string { return fmt.Sprint(s.Errors) }},
+		{"gotool_sql_slow_total", "counter", "SQL executions slower than slow_threshold.", func(s SQLStat) string { return fmt.Sprint(s.Slow) }},
+		{"gotool_sql_duration_seconds_total", "counter", "Total SQL execution time.", func(s SQLStat) string { return fmt.Sprint(s.Total.Seconds()) }},
+		{"gotool_sql_duration_seconds_max", "gauge", "Slowest SQL execution time.", func(s SQLStat) string { return fmt.Sprint(s.Max.Seconds()) }},
+	}
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ); err != nil {
+			return err
+		}
+		for _, s := range stats {
+			if _, err := fmt.Fprintf(w, "%s{datasource=\"%s\",sql=\"%s\"} %s\n", m.name, promLabel(s.Datasource), promLabel(s.Fingerprint), m.value(s)); err != nil {
+				return err
+			}
+		}
+	}
+	return writeGormCacheMetrics(w)
+}
+
+func writeGormCacheMetrics(w io.Writer) error {
+	stats := GormCacheStats()
+	if len(stats) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metrics := []struct {
+		name, help string
+		value      func(s CacheStat) int64
+	}{
+		{"gotool_sql_cache_hits_total", "Query cache hits.", func(s CacheStat) int64 { return s.Hits }},
+		{"gotool_sql_cache_misses_total", "Query cache misses.", func(s CacheStat) int64 { return s.Misses }},
+		{"gotool_sql_cache_errors_total", "Query cache Redis errors.", func(s CacheStat) int64 { return s.Errors }},
+	}
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", m.name, m.help, m.name); err != nil {
+			return err
+		}
+		for _, name := range names {
+			if _, err := fmt.Fprintf(w, "%s{datasource=\"%s\"} %d\n", m.name, promLabel(name), m.value(stats[name])); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GormMetricsHandler 输出 WriteGormMetrics 的 http.Handler，供 Prometheus 抓取
+//
+//	http.Handle("/metrics/sql", sys.GormMetricsHandler())
+func GormMetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = WriteGormMetrics(w)
+	})
+}
+
+func promLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
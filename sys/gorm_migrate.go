@@ -0,0 +1,550 @@
+package sys
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EricJSanchez/gotool/environment"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrDestructiveMigration production 环境中未经确认执行 DROP、TRUNCATE 等破坏性迁移
+	ErrDestructiveMigration = errors.New("destructive migration requires confirmation in production")
+	// ErrNonAtomicMigration MySQL 上含 DDL 的多语句迁移，DDL 会隐式提交，中途失败时无法回滚已执行的语句
+	ErrNonAtomicMigration = errors.New("multi-statement DDL migration is not atomic on mysql")
+)
+
+// MigrationTable 记录已执行迁移的表
+var MigrationTable = "gotool_schema_migrations"
+
+// Migration 一个版本的迁移。SQL 迁移从 MigrateOptions.Dir/<数据源名称>/ 读取，文件名为
+// <版本>_<名称>.up.sql 与 <版本>_<名称>.down.sql，如 20240101120000_add_order_index.up.sql；
+// Go 迁移通过 RegisterMigration 注册
+type Migration struct {
+	Version     int64
+	Name        string
+	Up          func(tx *gorm.DB) error
+	Down        func(tx *gorm.DB) error
+	UpSQL       string
+	DownSQL     string
+	Destructive bool   // 升级是否有破坏性，Go 迁移需自行标记，SQL 迁移按语句判断
+	Source      string // SQL 文件所在目录，Go 迁移为空
+}
+
+// MigrateOptions Migrate 的选项
+type MigrateOptions struct {
+	Dir              string        // 迁移目录，缺省为 migrations
+	Down             bool          // 回滚已执行的迁移
+	Steps            int           // 执行的迁移数量，升级缺省为全部，回滚缺省为 1
+	DryRun           bool          // 只输出将要执行的迁移与 SQL，不加锁也不执行
+	AllowDestructive bool          // 允许在 production 环境执行破坏性迁移
+	AllowNonAtomic   bool          // 允许在 MySQL 上执行含 DDL 的多语句迁移
+	LockTimeout      time.Duration // 等待其他实例释放迁移锁的时长，缺省 1 分钟
+	Out              io.Writer     // 执行过程的输出，缺省为标准输出
+}
+
+// MigrationState 迁移及其执行状态
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type schemaMigration struct {
+	Version   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return MigrationTable
+}
+
+var (
+	goMigrations   = make(map[string][]Migration)
+	goMigrationsRw sync.RWMutex
+)
+
+// RegisterMigration 注册数据源 name 的 Go 迁移，用于无法用 SQL 表达的数据修复等，版本号不能与 SQL 迁移重复
+//
+//	func init() {
+//		sys.RegisterMigration("db-scrm", sys.Migration{Version: 20240102000000, Name: "fill_union_id", Up: fillUnionId})
+//	}
+func RegisterMigration(name string, m Migration) {
+	goMigrationsRw.Lock()
+	goMigrations[name] = append(goMigrations[name], m)
+	goMigrationsRw.Unlock()
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// 读取数据源 name 的全部迁移，按版本升序
+func loadMigrations(name, dir string) ([]Migration, error) {
+	if dir == "" {
+		dir = "migrations"
+	}
+	byVersion := make(map[int64]*Migration)
+	path := filepath.Join(dir, name)
+	entries, err := os.ReadDir(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		match := migrationFile.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", e.Name(), err)
+		}
+		data, err := os.ReadFile(filepath.Join(path, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2], Source: path}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names: %s, %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.UpSQL = string(data)
+		} else {
+			m.DownSQL = string(data)
+		}
+	}
+	for _, m := range byVersion {
+		if m.UpSQL == "" {
+			return nil, fmt.Errorf("migration %d_%s: missing up file", m.Version, m.Name)
+		}
+		m.Destructive = destructiveSQL(m.UpSQL)
+	}
+	goMigrationsRw.RLock()
+	registered := goMigrations[name]
+	goMigrationsRw.RUnlock()
+	for i := range registered {
+		m := registered[i]
+		if _, ok := byVersion[m.Version]; ok {
+			return nil, fmt.Errorf("migration %d registered more than once", m.Version)
+		}
+		if m.Up == nil {
+			return nil, fmt.Errorf("migration %d_%s: missing Up", m.Version, m.Name)
+		}
+		byVersion[m.Version] = &m
+	}
+	list := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// MigrationStatus 返回数据源 name 的全部迁移及其是否已执行
+func MigrationStatus(ctx context.Context, name, dir string) ([]MigrationState, error) {
+	db, err := GormE(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations(name, dir)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db, false)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		s := MigrationState{Migration: m}
+		if a, ok := applied[m.Version]; ok {
+			s.Applied, s.AppliedAt = true, a.AppliedAt
+		}
+		states = append(states, s)
+	}
+	return states, nil
+}
+
+// Migrate 对数据源 name 执行迁移，每个迁移在单独的事务中执行并记录到 MigrationTable。
+// 执行前获取数据库的会话级锁（MySQL GET_LOCK、Postgres advisory lock、SQL Server sp_getapplock），
+// 同一数据源只有一个实例在迁移，其余实例等待锁释放后发现已无待执行的迁移。
+// production 环境中含有 DROP、TRUNCATE、不带 WHERE 的 DELETE/UPDATE 的迁移需设置 AllowDestructive。
+//
+// MySQL 的 DDL 会隐式提交事务，含 DDL 的迁移并不是原子的：多条语句中途失败时，之前的语句已生效，
+// 迁移却未记录，需手工处理后才能重新执行。因此 MySQL 上含 DDL 的 SQL 迁移应每个文件只写一条语句，
+// 否则返回 ErrNonAtomicMigration，确认可以接受时设置 AllowNonAtomic；Go 迁移无法检查，需自行保证
+func Migrate(ctx context.Context, name string, opts MigrateOptions) error {
+	if opts.Out == nil {
+		opts.Out = os.Stdout
+	}
+	if opts.LockTimeout <= 0 {
+		opts.LockTimeout = time.Minute
+	}
+	db, err := GormE(ctx, name)
+	if err != nil {
+		return err
+	}
+	migrations, err := loadMigrations(name, opts.Dir)
+	if err != nil {
+		return err
+	}
+	if !opts.DryRun {
+		unlock, err := migrationLock(ctx, db, name, opts.LockTimeout)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	applied, err := appliedMigrations(db, !opts.DryRun)
+	if err != nil {
+		return err
+	}
+	plan, err := migrationPlan(migrations, applied, opts)
+	if err != nil {
+		return err
+	}
+	if len(plan) == 0 {
+		_, _ = fmt.Fprintf(opts.Out, "migrate %s: no migrations to run\n", name)
+		return nil
+	}
+	direction := "up"
+	if opts.Down {
+		direction = "down"
+	}
+	if environment.Is(environment.Production) && !opts.AllowDestructive && !opts.DryRun {
+		for _, m := range plan {
+			if m.destructive(opts.Down) {
+				return fmt.Errorf("migrate %s: %d_%s: %w", name, m.Version, m.Name, ErrDestructiveMigration)
+			}
+		}
+	}
+	if db.Dialector.Name() == "mysql" {
+		for _, m := range plan {
+			if !nonAtomicSQL(m.script(opts.Down)) {
+				continue
+			}
+			if !opts.AllowNonAtomic && !opts.DryRun {
+				return fmt.Errorf("migrate %s: %d_%s: %w", name, m.Version, m.Name, ErrNonAtomicMigration)
+			}
+			_, _ = fmt.Fprintf(opts.Out, "-- warning: %d_%s runs DDL among several statements, it cannot be rolled back on mysql\n", m.Version, m.Name)
+		}
+	}
+	for _, m := range plan {
+		if opts.DryRun {
+			printMigration(opts.Out, name, direction, m)
+			continue
+		}
+		start := time.Now()
+		if err = runMigration(ctx, db, m, opts.Down); err != nil {
+			return fmt.Errorf("migrate %s: %s %d_%s: %w", name, direction, m.Version, m.Name, err)
+		}
+		_, _ = fmt.Fprintf(opts.Out, "migrate %s: %s %d_%s (%s)\n", name, direction, m.Version, m.Name, time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// 待执行的迁移，回滚时按版本降序
+func migrationPlan(migrations []Migration, applied map[int64]schemaMigration, opts MigrateOptions) ([]Migration, error) {
+	var plan []Migration
+	if !opts.Down {
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; !ok {
+				plan = append(plan, m)
+			}
+		}
+		if opts.Steps > 0 && len(plan) > opts.Steps {
+			plan = plan[:opts.Steps]
+		}
+		return plan, nil
+	}
+	steps := opts.Steps
+	if steps <= 0 {
+		steps = 1
+	}
+	known := make(map[int64]Migration, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+	versions := make([]int64, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+	for _, v := range versions {
+		if len(plan) == steps {
+			break
+		}
+		m, ok := known[v]
+		if !ok {
+			return nil, fmt.Errorf("applied migration %d_%s not found", v, applied[v].Name)
+		}
+		if m.Down == nil && m.DownSQL == "" {
+			return nil, fmt.Errorf("migration %d_%s has no down", m.Version, m.Name)
+		}
+		plan = append(plan, m)
+	}
+	return plan, nil
+}
+
+// 在事务中执行迁移并记录版本，MySQL 的 DDL 会隐式提交，见 Migrate
+func runMigration(ctx context.Context, db *gorm.DB, m Migration, down bool) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		fn, script := m.Up, m.script(down)
+		if down {
+			fn = m.Down
+		}
+		if fn != nil {
+			if err := fn(tx); err != nil {
+				return err
+			}
+		} else {
+			for _, stmt := range splitSQL(script) {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if down {
+			return tx.Delete(&schemaMigration{}, m.Version).Error
+		}
+		return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+	})
+}
+
+// 执行方向上是否有破坏性，回滚 Go 迁移视为有破坏性
+func (m Migration) destructive(down bool) bool {
+	if !down {
+		return m.Destructive
+	}
+	if m.Down != nil {
+		return true
+	}
+	return destructiveSQL(m.DownSQL)
+}
+
+// 执行方向上的 SQL 脚本，Go 迁移为空
+func (m Migration) script(down bool) string {
+	if down {
+		return m.DownSQL
+	}
+	return m.UpSQL
+}
+
+func printMigration(out io.Writer, name, direction string, m Migration) {
+	mark := ""
+	if m.destructive(direction == "down") {
+		mark = " [destructive]"
+	}
+	_, _ = fmt.Fprintf(out, "-- migrate %s: %s %d_%s%s\n", name, direction, m.Version, m.Name, mark)
+	script := m.script(direction == "down")
+	if script == "" {
+		_, _ = fmt.Fprintln(out, "-- (go migration)")
+		return
+	}
+	for _, stmt := range splitSQL(script) {
+		_, _ = fmt.Fprintln(out, stmt+";")
+	}
+}
+
+// 已执行的迁移，create 为 true 时自动创建 MigrationTable
+func appliedMigrations(db *gorm.DB, create bool) (map[int64]schemaMigration, error) {
+	applied := make(map[int64]schemaMigration)
+	if !db.Migrator().HasTable(&schemaMigration{}) {
+		if !create {
+			return applied, nil
+		}
+		if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+			return nil, err
+		}
+	}
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// 获取迁移锁，sqlite、clickhouse 等不支持会话级锁的数据库不加锁
+func migrationLock(ctx context.Context, db *gorm.DB, name string, timeout time.Duration) (func(), error) {
+	unlock, err := sessionLock(ctx, db, "gotool_migrate:"+name, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("migrate %s: %w", name, err)
+	}
+	return unlock, nil
+}
+
+// 锁未在超时时间内获取
+var errLockNotAcquired = errors.New("lock not acquired")
+
+// 获取数据库会话级的命名锁，timeout 为 0 时不等待，返回释放锁的函数；不支持的数据库不加锁
+func sessionLock(ctx context.Context, db *gorm.DB, key string, timeout time.Duration) (func(), error) {
+	var acquire, release string
+	var args []interface{}
+	switch db.Dialector.Name() {
+	case "mysql":
+		acquire, release = "SELECT GET_LOCK(?, ?)", "SELECT RELEASE_LOCK(?)"
+		args = []interface{}{key, int(timeout / time.Second)}
+	case "postgres":
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(key))
+		acquire, release = "SELECT pg_try_advisory_lock($1)", "SELECT pg_advisory_unlock($1)"
+		args = []interface{}{int64(h.Sum64())}
+	case "sqlserver":
+		acquire = "DECLARE @r int; EXEC @r = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = @p2; SELECT CASE WHEN @r >= 0 THEN 1 ELSE 0 END"
+		release = "EXEC sp_releaseapplock @Resource = @p1, @LockOwner = 'Session'"
+		args = []interface{}{key, int(timeout / time.Millisecond)}
+	default:
+		return func() {}, nil
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	// 会话级锁需要在同一连接上获取与释放
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		var ok sql.NullBool
+		if err = conn.QueryRowContext(ctx, acquire, args...).Scan(&ok); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("lock %s: %w", key, err)
+		}
+		if ok.Valid && ok.Bool {
+			break
+		}
+		// pg_try_advisory_lock 不等待，其余数据库已在语句中等待至超时
+		if db.Dialector.Name() != "postgres" || time.Now().After(deadline) {
+			_ = conn.Close()
+			return nil, fmt.Errorf("%s: %w within %s", key, errLockNotAcquired, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+			return nil, ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), release, args[0]); err != nil {
+			fmt.Println("lock", key, "unlock err:", err)
+		}
+		_ = conn.Close()
+	}, nil
+}
+
+// 将 SQL 脚本按分号拆分为语句，忽略注释及引号、$$ 内的分号
+func splitSQL(script string) []string {
+	var (
+		stmts []string
+		b     strings.Builder
+	)
+	flush := func() {
+		if s := strings.TrimSpace(b.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		b.Reset()
+	}
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			b.WriteByte('\n')
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+			b.WriteByte(' ')
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(script); j++ {
+				if script[j] == '\\' && c != '`' {
+					j++
+				} else if script[j] == c {
+					break
+				}
+			}
+			if j >= len(script) {
+				j = len(script) - 1
+			}
+			b.WriteString(script[i : j+1])
+			i = j
+		case c == '$' && strings.HasPrefix(script[i:], "$$"):
+			end := strings.Index(script[i+2:], "$$")
+			if end < 0 {
+				b.WriteString(script[i:])
+				i = len(script)
+				break
+			}
+			b.WriteString(script[i : i+end+4])
+			i += end + 3
+		case c == ';':
+			flush()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	flush()
+	return stmts
+}
+
+var (
+	sqlDDL         = regexp.MustCompile(`(?i)^(CREATE|ALTER|DROP|RENAME|TRUNCATE)\s`)
+	sqlDestructive = regexp.MustCompile(`(?i)^(DROP\s|TRUNCATE\s|ALTER\s+TABLE\s.*\sDROP\s)`)
+	sqlUnbounded   = regexp.MustCompile(`(?i)^(DELETE|UPDATE)\s`)
+	sqlWhere       = regexp.MustCompile(`(?i)\sWHERE\s`)
+)
+
+// SQL 脚本是否含有破坏性语句
+func destructiveSQL(script string) bool {
+	for _, stmt := range splitSQL(script) {
+		stmt = sqlSpaces.ReplaceAllString(stmt, " ")
+		if sqlDestructive.MatchString(stmt) {
+			return true
+		}
+		if sqlUnbounded.MatchString(stmt) && !sqlWhere.MatchString(stmt+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// SQL 脚本是否有多条语句且含 DDL，MySQL 上无法在一个事务中执行
+func nonAtomicSQL(script string) bool {
+	stmts := splitSQL(script)
+	if len(stmts) < 2 {
+		return false
+	}
+	for _, stmt := range stmts {
+		if sqlDDL.MatchString(stmt) {
+			return true
+		}
+	}
+	return false
+}
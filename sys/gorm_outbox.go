@@ -0,0 +1,752 @@
+package sys
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OutboxTable outbox 事件表名，需在写入与启动 OutboxRelay 前设置；聚合键的序号记录在 OutboxTable_seq
+var OutboxTable = "gotool_outbox"
+
+// postgres 写入事件后 NOTIFY 的频道
+const outboxChannel = "gotool_outbox"
+
+// outbox 事件状态
+const (
+	OutboxPending = 0 // 待投递
+	OutboxSent    = 1 // 已投递
+	OutboxDead    = 2 // 超过最大重试次数，需人工处理，见 OutboxDeadLetters、RetryOutbox
+)
+
+// OutboxEvent outbox 表中的事件
+type OutboxEvent struct {
+	ID           int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Topic        string     `gorm:"size:128;not null" json:"topic"`
+	AggregateKey string     `gorm:"size:128;not null;uniqueIndex:idx_gotool_outbox_key,priority:1" json:"aggregate_key"`
+	Seq          int64      `gorm:"not null;uniqueIndex:idx_gotool_outbox_key,priority:2" json:"seq"`
+	Payload      string     `gorm:"type:text;not null" json:"payload"`
+	Status       int        `gorm:"not null;default:0;index:idx_gotool_outbox_due,priority:1" json:"status"`
+	Attempts     int        `gorm:"not null;default:0" json:"attempts"`
+	NextAt       time.Time  `gorm:"not null;index:idx_gotool_outbox_due,priority:2" json:"next_at"`
+	LastError    string     `gorm:"type:text" json:"last_error"`
+	CreatedAt    time.Time  `json:"created_at"`
+	SentAt       *time.Time `json:"sent_at"`
+}
+
+func (OutboxEvent) TableName() string {
+	return OutboxTable
+}
+
+// 聚合键已分配的最大序号。写入事件时先更新该行，行锁持有到事务提交，
+// 同一键的事件因此按提交顺序编号，不依赖写入时分配的自增 ID
+type outboxSeq struct {
+	AggregateKey string `gorm:"primaryKey;size:128"`
+	Seq          int64  `gorm:"not null"`
+}
+
+func (outboxSeq) TableName() string {
+	return OutboxTable + "_seq"
+}
+
+// OutboxMessage 投递给 OutboxSink 的消息，ID 在 outbox 表内唯一，可用于下游去重
+type OutboxMessage struct {
+	ID        int64           `json:"id"`
+	Topic     string          `json:"topic"`
+	Key       string          `json:"key"`
+	Seq       int64           `json:"seq"` // 同一 Key 内从 1 开始按提交顺序递增
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func (e OutboxEvent) message() OutboxMessage {
+	return OutboxMessage{
+		ID:        e.ID,
+		Topic:     e.Topic,
+		Key:       e.AggregateKey,
+		Seq:       e.Seq,
+		Payload:   json.RawMessage(e.Payload),
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+// OutboxMigration 创建 outbox 表的迁移，注册后随 Migrate 执行，version 不能与数据源的其他迁移重复：
+//
+//	func init() {
+//		sys.RegisterMigration("db-scrm", sys.OutboxMigration(20240101000000))
+//	}
+//
+// 已存在的表不重复创建，MySQL 上中途失败后可直接重新执行
+func OutboxMigration(version int64) Migration {
+	return Migration{
+		Version: version,
+		Name:    "create_" + OutboxTable,
+		Up: func(tx *gorm.DB) error {
+			for _, model := range []interface{}{&OutboxEvent{}, &outboxSeq{}} {
+				if tx.Migrator().HasTable(model) {
+					continue
+				}
+				if err := tx.Migrator().CreateTable(model); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&outboxSeq{}, &OutboxEvent{})
+		},
+	}
+}
+
+// PublishOutbox 在数据源 name 上写入事件，ctx 中有 sys.Tx 开启的事务时随事务一起提交，提交后通知本进程的 OutboxRelay。
+// key 为聚合键，不能为空，同一键的事件按提交顺序投递，并发写入同一键的事务依次等待；payload 为 []byte、json.RawMessage 时原样写入，其余按 JSON 编码
+//
+//	err := sys.Tx(ctx, "db-scrm", func(tx *gorm.DB) error {
+//		if err := tx.Create(&order).Error; err != nil {
+//			return err
+//		}
+//		return sys.PublishOutbox(tx.Statement.Context, "db-scrm", "order.created", order.No, order)
+//	})
+func PublishOutbox(ctx context.Context, name, topic, key string, payload interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	name, err := datasourceName("gorm", "default_db", []string{name})
+	if err != nil {
+		return err
+	}
+	db, err := GormE(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err = PublishOutboxTx(db, topic, key, payload); err != nil {
+		return err
+	}
+	if scope, ok := ctx.Value(txCtxKey{name}).(*txScope); ok {
+		scope.afterCommit(func() { notifyOutbox(name) })
+	} else {
+		notifyOutbox(name)
+	}
+	return nil
+}
+
+// PublishOutboxTx 在 tx 中写入事件，用于 db.Transaction 等未经 sys.Tx 开启的事务；tx 不在事务中时开启一个
+func PublishOutboxTx(tx *gorm.DB, topic, key string, payload interface{}) error {
+	if topic == "" {
+		return errors.New("outbox: empty topic")
+	}
+	// 空键的事件都会在同一序号行上排队，且一个事件失败会阻塞其余所有事件
+	if key == "" {
+		return fmt.Errorf("outbox %s: empty key", topic)
+	}
+	var body []byte
+	switch v := payload.(type) {
+	case []byte:
+		body = v
+	case json.RawMessage:
+		body = v
+	default:
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return fmt.Errorf("outbox %s: %w", topic, err)
+		}
+	}
+	now := time.Now()
+	ev := &OutboxEvent{Topic: topic, AggregateKey: key, Payload: string(body), NextAt: now, CreatedAt: now}
+	ctx := tx.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	tx = tx.WithContext(context.WithValue(ctx, skipAuditCtxKey{}, true))
+	if _, inTx := tx.Statement.ConnPool.(gorm.TxCommitter); !inTx {
+		// 序号的行锁需持有到事件写入后提交
+		return tx.Transaction(func(tx *gorm.DB) error {
+			return publishOutbox(tx, ev)
+		})
+	}
+	return publishOutbox(tx, ev)
+}
+
+func publishOutbox(tx *gorm.DB, ev *OutboxEvent) error {
+	seq := outboxSeq{AggregateKey: ev.AggregateKey, Seq: 1}
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "aggregate_key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"seq": gorm.Expr("?.seq + 1", clause.Table{Name: seq.TableName()})}),
+	}).Create(&seq).Error
+	if err != nil {
+		return err
+	}
+	if err = tx.Where("aggregate_key = ?", ev.AggregateKey).Take(&seq).Error; err != nil {
+		return err
+	}
+	ev.Seq = seq.Seq
+	if err = tx.Create(ev).Error; err != nil {
+		return err
+	}
+	if tx.Dialector.Name() == "postgres" {
+		// 通知在事务提交后送达
+		return tx.Exec("SELECT pg_notify(?, '')", outboxChannel).Error
+	}
+	return nil
+}
+
+// OutboxSink 事件的投递目标，返回错误时按退避策略重试
+type OutboxSink interface {
+	Send(ctx context.Context, msg OutboxMessage) error
+}
+
+// OutboxSinkFactory 根据数据源 outbox 配置创建 OutboxSink
+type OutboxSinkFactory func(config map[string]interface{}) (OutboxSink, error)
+
+var (
+	outboxSinks = map[string]OutboxSinkFactory{
+		"redis":   newRedisOutboxSink,
+		"webhook": newWebhookOutboxSink,
+		"elastic": newElasticOutboxSink,
+	}
+	outboxSinksRw sync.RWMutex
+)
+
+// RegisterOutboxSink 注册事件的投递目标，数据源配置 outbox.sink = name 时使用，可覆盖内置的 redis、webhook、elastic
+func RegisterOutboxSink(name string, factory OutboxSinkFactory) {
+	outboxSinksRw.Lock()
+	outboxSinks[name] = factory
+	outboxSinksRw.Unlock()
+}
+
+// OutboxOptions OutboxRelay 的选项，零值使用括号中的默认值
+type OutboxOptions struct {
+	PollInterval time.Duration // 轮询间隔（1s）
+	BatchSize    int           // 每次读取的事件数（100）
+	MaxAttempts  int           // 投递失败达到该次数后标记为 OutboxDead（10）
+	Backoff      time.Duration // 第 n 次失败后等待 Backoff*2^(n-1)（1s）
+	MaxBackoff   time.Duration // 最长等待（10m）
+	Retention    time.Duration // 已投递事件的保留时长，小于 0 时不清理（168h）
+	Listen       bool          // postgres：LISTEN 写入通知，无需等待轮询
+}
+
+// OutboxRelay 将数据源 outbox 表中的事件投递到 OutboxSink。
+// 多个进程同时运行时以数据库会话锁保证同一时刻只有一个在投递，同一聚合键的事件按 Seq 即提交顺序投递，
+// 前一个事件等待重试期间后续事件不投递，事件进入 OutboxDead 后不再阻塞后续事件。
+// 投递至少一次，下游需按 OutboxMessage.ID 去重
+type OutboxRelay struct {
+	name      string
+	sink      OutboxSink
+	opts      OutboxOptions
+	wake      chan struct{}
+	cleanedAt time.Time
+}
+
+var (
+	outboxRelays   = make(map[string]map[*OutboxRelay]struct{})
+	outboxRelaysRw sync.RWMutex
+)
+
+// NewOutboxRelay 创建数据源 name 的 outbox 投递器，name 为空时使用 app.toml 的 default_db
+func NewOutboxRelay(name string, sink OutboxSink, opts OutboxOptions) *OutboxRelay {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 10
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 10 * time.Minute
+	}
+	if opts.Retention == 0 {
+		opts.Retention = 7 * 24 * time.Hour
+	}
+	return &OutboxRelay{name: name, sink: sink, opts: opts, wake: make(chan struct{}, 1)}
+}
+
+// StartOutboxRelay 按数据源配置中的 outbox 在后台投递，ctx 结束时停止。
+// outbox 表需先由 OutboxMigration 创建，不存在时返回错误：
+//
+//	[db-scrm.outbox]
+//	sink          = "redis"          # redis、webhook、elastic 或 RegisterOutboxSink 注册的名称
+//	poll_interval = "1s"
+//	batch_size    = 100
+//	max_attempts  = 10
+//	backoff       = "1s"
+//	max_backoff   = "10m"
+//	retention     = "168h"           # 已投递事件的保留时长，"-1s" 为不清理
+//	listen        = true             # postgres：LISTEN 写入通知
+//	redis         = "redis-default"  # redis：数据源名称，缺省为 app.toml 的 default_redis
+//	stream        = "outbox:{topic}" # redis：写入的 Stream，{topic} 替换为事件主题
+//	maxlen        = 100000           # redis：Stream 的近似最大长度，0 为不限
+//	url           = "https://hooks.example.com/outbox" # webhook：POST JSON
+//	timeout       = "5s"             # webhook：请求超时
+//	headers       = { Authorization = "Bearer xxx" }   # webhook：请求头
+//	elastic       = "es-default"     # elastic：数据源名称，缺省为 app.toml 的 default_es
+//	index         = "outbox-{topic}" # elastic：写入的索引，文档 ID 为事件 ID
+func StartOutboxRelay(ctx context.Context, name string) (*OutboxRelay, error) {
+	name, config, err := datasourceConfig("gorm", "default_db", []string{name})
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := config["outbox"]
+	if !ok || raw == nil {
+		return nil, datasourceError("gorm", name, invalidDatasourceConfig("outbox", errors.New("not configured")))
+	}
+	cfg, err := cast.ToStringMapE(raw)
+	if err != nil {
+		return nil, datasourceError("gorm", name, invalidDatasourceConfig("outbox", fmt.Errorf("expected table, got %T", raw)))
+	}
+	relay, err := newOutboxRelay(name, cfg)
+	if err != nil {
+		return nil, datasourceError("gorm", name, prefixConfigError("outbox", err))
+	}
+	db, err := GormE(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range []string{OutboxTable, outboxSeq{}.TableName()} {
+		if !db.Migrator().HasTable(table) {
+			return nil, fmt.Errorf("outbox %s: table %s not found, register sys.OutboxMigration and run Migrate", name, table)
+		}
+	}
+	go func() {
+		if err := relay.Run(ctx); err != nil && ctx.Err() == nil {
+			fmt.Println("outbox", name, "err:", err)
+		}
+	}()
+	return relay, nil
+}
+
+func newOutboxRelay(name string, cfg map[string]interface{}) (*OutboxRelay, error) {
+	var (
+		opts OutboxOptions
+		err  error
+	)
+	if opts.PollInterval, err = dsDuration(cfg, "poll_interval", time.Second, 0); err != nil {
+		return nil, err
+	}
+	if opts.BatchSize, err = dsInt(cfg, "batch_size", 0); err != nil {
+		return nil, err
+	}
+	if opts.MaxAttempts, err = dsInt(cfg, "max_attempts", 0); err != nil {
+		return nil, err
+	}
+	if opts.Backoff, err = dsDuration(cfg, "backoff", time.Second, 0); err != nil {
+		return nil, err
+	}
+	if opts.MaxBackoff, err = dsDuration(cfg, "max_backoff", time.Second, 0); err != nil {
+		return nil, err
+	}
+	if opts.Retention, err = dsDuration(cfg, "retention", time.Second, 0); err != nil {
+		return nil, err
+	}
+	if opts.Listen, err = dsBool(cfg, "listen", false); err != nil {
+		return nil, err
+	}
+	sinkName, err := dsString(cfg, "sink", true)
+	if err != nil {
+		return nil, err
+	}
+	outboxSinksRw.RLock()
+	factory, ok := outboxSinks[sinkName]
+	outboxSinksRw.RUnlock()
+	if !ok {
+		return nil, invalidDatasourceConfig("sink", fmt.Errorf("unsupported sink %q", sinkName))
+	}
+	sink, err := factory(cfg)
+	if err != nil {
+		var de *DatasourceError
+		if !errors.As(err, &de) {
+			err = invalidDatasourceConfig("sink", err)
+		}
+		return nil, err
+	}
+	return NewOutboxRelay(name, sink, opts), nil
+}
+
+// 唤醒本进程中数据源 name 的 OutboxRelay
+func notifyOutbox(name string) {
+	outboxRelaysRw.RLock()
+	defer outboxRelaysRw.RUnlock()
+	for r := range outboxRelays[name] {
+		r.Notify()
+	}
+}
+
+// Notify 立即开始下一轮投递
+func (r *OutboxRelay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 持续投递直到 ctx 结束，返回 ctx.Err()
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	name, err := datasourceName("gorm", "default_db", []string{r.name})
+	if err != nil {
+		return err
+	}
+	outboxRelaysRw.Lock()
+	if outboxRelays[name] == nil {
+		outboxRelays[name] = make(map[*OutboxRelay]struct{})
+	}
+	outboxRelays[name][r] = struct{}{}
+	outboxRelaysRw.Unlock()
+	defer func() {
+		outboxRelaysRw.Lock()
+		delete(outboxRelays[name], r)
+		outboxRelaysRw.Unlock()
+	}()
+
+	if r.opts.Listen {
+		go r.listen(ctx)
+	}
+	ticker := time.NewTicker(r.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			fmt.Println("outbox", name, "err:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// RunOnce 投递当前到期的所有事件并清理过期的已投递事件，返回投递成功的数量；
+// 其他进程正在投递时直接返回
+func (r *OutboxRelay) RunOnce(ctx context.Context) (int, error) {
+	db, err := GormE(ctx, r.name)
+	if err != nil {
+		return 0, err
+	}
+	// outbox 表的读写不记录审计
+	db = db.WithContext(context.WithValue(ctx, skipAuditCtxKey{}, true))
+	unlock, err := sessionLock(ctx, db, "gotool_outbox:"+OutboxTable, 0)
+	if errors.Is(err, errLockNotAcquired) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	sent := 0
+	for ctx.Err() == nil {
+		n, fetched, err := r.relayBatch(ctx, db)
+		sent += n
+		if err != nil {
+			return sent, err
+		}
+		if fetched < r.opts.BatchSize {
+			break
+		}
+	}
+	if r.opts.Retention > 0 && time.Since(r.cleanedAt) > 10*time.Minute {
+		r.cleanedAt = time.Now()
+		err = db.Where("status = ? AND sent_at < ?", OutboxSent, time.Now().Add(-r.opts.Retention)).Delete(&OutboxEvent{}).Error
+	}
+	return sent, err
+}
+
+// 读取一批到期事件并逐个投递，返回投递成功与读取的数量
+func (r *OutboxRelay) relayBatch(ctx context.Context, db *gorm.DB) (sent, fetched int, err error) {
+	now := time.Now()
+	var events []OutboxEvent
+	// 同一聚合键有更早的事件在等待重试时跳过；按 seq 排序使同一键更早的到期事件总在同一批的前面，
+	// 序号的行锁保证 seq 更大的事件可见时更早的事件已提交
+	blocked := fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %[1]s b WHERE b.aggregate_key = %[1]s.aggregate_key AND b.status = ? AND b.next_at > ? AND b.seq < %[1]s.seq)", OutboxTable)
+	err = db.Where("status = ? AND next_at <= ?", OutboxPending, now).
+		Where(blocked, OutboxPending, now).
+		Order("seq, id").Limit(r.opts.BatchSize).Find(&events).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	failed := make(map[string]bool)
+	for _, ev := range events {
+		if ctx.Err() != nil {
+			return sent, len(events), ctx.Err()
+		}
+		if failed[ev.AggregateKey] {
+			continue
+		}
+		sendErr := r.sink.Send(ctx, ev.message())
+		updates := map[string]interface{}{"attempts": ev.Attempts + 1}
+		if sendErr == nil {
+			updates["status"], updates["sent_at"] = OutboxSent, time.Now()
+			sent++
+		} else {
+			failed[ev.AggregateKey] = true
+			updates["last_error"] = truncateString(sendErr.Error(), 1000)
+			if ev.Attempts+1 >= r.opts.MaxAttempts {
+				updates["status"] = OutboxDead
+				fmt.Println("outbox", ev.Topic, ev.ID, "dead after", ev.Attempts+1, "attempts:", sendErr)
+			} else {
+				updates["next_at"] = time.Now().Add(r.backoff(ev.Attempts + 1))
+			}
+		}
+		if err = db.Model(&OutboxEvent{}).Where("id = ?", ev.ID).Updates(updates).Error; err != nil {
+			return sent, len(events), err
+		}
+	}
+	return sent, len(events), nil
+}
+
+func (r *OutboxRelay) backoff(attempts int) time.Duration {
+	d := r.opts.Backoff
+	for i := 1; i < attempts && d < r.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.opts.MaxBackoff {
+		d = r.opts.MaxBackoff
+	}
+	return d
+}
+
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// 监听 postgres 写入通知，连接断开后按轮询间隔重连
+func (r *OutboxRelay) listen(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := r.listenOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Println("outbox listen err:", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(r.opts.PollInterval):
+		}
+	}
+}
+
+func (r *OutboxRelay) listenOnce(ctx context.Context) error {
+	db, err := gormClient([]string{r.name})
+	if err != nil {
+		return err
+	}
+	if db.Dialector.Name() != "postgres" {
+		return fmt.Errorf("listen is not supported by %s", db.Dialector.Name())
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn interface{}) error {
+		pc, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("listen: unsupported driver connection %T", driverConn)
+		}
+		if _, err := pc.Conn().Exec(ctx, "LISTEN "+outboxChannel); err != nil {
+			return err
+		}
+		for {
+			if _, err := pc.Conn().WaitForNotification(ctx); err != nil {
+				return err
+			}
+			r.Notify()
+		}
+	})
+}
+
+// OutboxDeadLetters 返回数据源 name 上超过最大重试次数的事件，按 ID 升序
+func OutboxDeadLetters(ctx context.Context, name string, limit int) ([]OutboxEvent, error) {
+	db, err := GormE(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var events []OutboxEvent
+	q := db.Where("status = ?", OutboxDead).Order("id")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	return events, q.Find(&events).Error
+}
+
+// RetryOutbox 将 OutboxDead 事件重新置为待投递并清零重试次数，返回更新的数量
+func RetryOutbox(ctx context.Context, name string, ids ...int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	db, err := GormE(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	db = db.Model(&OutboxEvent{}).Where("id IN ? AND status = ?", ids, OutboxDead).Updates(map[string]interface{}{
+		"status":   OutboxPending,
+		"attempts": 0,
+		"next_at":  time.Now(),
+	})
+	if db.Error == nil && db.RowsAffected > 0 {
+		notifyOutbox(name)
+	}
+	return db.RowsAffected, db.Error
+}
+
+// 写入 Redis Stream，字段为 id、topic、key、payload、created_at
+type redisOutboxSink struct {
+	redis  string
+	stream string
+	maxLen int64
+}
+
+func newRedisOutboxSink(config map[string]interface{}) (OutboxSink, error) {
+	s := &redisOutboxSink{}
+	var err error
+	if s.redis, err = dsString(config, "redis", false); err != nil {
+		return nil, err
+	}
+	if s.stream, err = dsString(config, "stream", false); err != nil {
+		return nil, err
+	}
+	if s.stream == "" {
+		s.stream = "gotool:outbox:{topic}"
+	}
+	maxLen, err := dsInt(config, "maxlen", 0)
+	if err != nil {
+		return nil, err
+	}
+	s.maxLen = int64(maxLen)
+	return s, nil
+}
+
+func (s *redisOutboxSink) Send(ctx context.Context, msg OutboxMessage) error {
+	var names []string
+	if s.redis != "" {
+		names = append(names, s.redis)
+	}
+	rds, err := RedisE(ctx, names...)
+	if err != nil {
+		return err
+	}
+	return rds.XAdd(ctx, &redis.XAddArgs{
+		Stream: strings.ReplaceAll(s.stream, "{topic}", msg.Topic),
+		MaxLen: s.maxLen,
+		Approx: s.maxLen > 0,
+		Values: map[string]interface{}{
+			"id":         msg.ID,
+			"topic":      msg.Topic,
+			"key":        msg.Key,
+			"seq":        msg.Seq,
+			"payload":    string(msg.Payload),
+			"created_at": msg.CreatedAt.Format(time.RFC3339Nano),
+		},
+	}).Err()
+}
+
+// 以 JSON POST 到 url，非 2xx 响应视为失败
+type webhookOutboxSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newWebhookOutboxSink(config map[string]interface{}) (OutboxSink, error) {
+	s := &webhookOutboxSink{}
+	var err error
+	if s.url, err = dsString(config, "url", true); err != nil {
+		return nil, err
+	}
+	if s.headers, err = dsParams(config, "headers"); err != nil {
+		return nil, err
+	}
+	timeout, err := dsDuration(config, "timeout", time.Second, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	s.client = &http.Client{Timeout: timeout}
+	return s, nil
+}
+
+func (s *webhookOutboxSink) Send(ctx context.Context, msg OutboxMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", strconv.FormatInt(msg.ID, 10))
+	req.Header.Set("X-Outbox-Topic", msg.Topic)
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook %s: %s %s", s.url, resp.Status, strings.TrimSpace(string(b)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// 写入 Elasticsearch 索引，文档 ID 为事件 ID，重复投递时覆盖
+type elasticOutboxSink struct {
+	elastic string
+	index   string
+}
+
+func newElasticOutboxSink(config map[string]interface{}) (OutboxSink, error) {
+	s := &elasticOutboxSink{}
+	var err error
+	if s.elastic, err = dsString(config, "elastic", false); err != nil {
+		return nil, err
+	}
+	if s.index, err = dsString(config, "index", true); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *elasticOutboxSink) Send(ctx context.Context, msg OutboxMessage) error {
+	var names []string
+	if s.elastic != "" {
+		names = append(names, s.elastic)
+	}
+	es, err := ElasticE(ctx, names...)
+	if err != nil {
+		return err
+	}
+	_, err = es.Index().
+		Index(strings.ReplaceAll(s.index, "{topic}", msg.Topic)).
+		Id(strconv.FormatInt(msg.ID, 10)).
+		BodyJson(msg).
+		Do(ctx)
+	return err
+}
@@ -0,0 +1,596 @@
+package sys
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// ErrInvalidQuery 请求参数中的过滤、排序或分页条件不合法
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrInvalidCursor 游标无法解析或与排序条件不一致
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+var (
+	// DefaultPageSize 未指定每页条数时的默认值
+	DefaultPageSize = 20
+	// MaxPageSize 每页条数的上限，QueryOptions.MaxSize 可覆盖
+	MaxPageSize = 500
+)
+
+// Scope 查询条件，与 gorm.DB.Scopes 的参数相同
+type Scope = func(*gorm.DB) *gorm.DB
+
+// Repo 绑定到数据源的 T 类型仓储，name 为空时使用 app.toml 的 default_db。
+// 所有方法以 sys.GormE 获取连接，ctx 中有 sys.Tx 开启的事务时在事务中执行
+//
+//	var messages = sys.NewRepo[ChatMessage]("db-scrm")
+//	list, err := messages.Find(ctx, sys.Where("corp_id = ?", corpId))
+type Repo[T any] struct {
+	name string
+}
+
+// NewRepo 创建绑定到数据源 name 的仓储
+func NewRepo[T any](name string) *Repo[T] {
+	return &Repo[T]{name: name}
+}
+
+// Where 返回等价于 db.Where(query, args...) 的查询条件
+func Where(query interface{}, args ...interface{}) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(query, args...)
+	}
+}
+
+// OrderBy 返回按 sort 排序的查询条件
+func OrderBy(sort ...SortField) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		for _, s := range sort {
+			db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: s.Column}, Desc: s.Desc})
+		}
+		return db
+	}
+}
+
+// DB 返回已应用 scopes 的 T 类型查询
+func (r *Repo[T]) DB(ctx context.Context, scopes ...Scope) (*gorm.DB, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	db, err := GormE(ctx, r.name)
+	if err != nil {
+		return nil, err
+	}
+	return db.Model(new(T)).Scopes(scopes...), nil
+}
+
+// Find 查询所有满足条件的记录
+func (r *Repo[T]) Find(ctx context.Context, scopes ...Scope) ([]T, error) {
+	db, err := r.DB(ctx, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	var list []T
+	return list, db.Find(&list).Error
+}
+
+// First 按主键顺序返回第一条满足条件的记录，不存在时返回 gorm.ErrRecordNotFound
+func (r *Repo[T]) First(ctx context.Context, scopes ...Scope) (*T, error) {
+	db, err := r.DB(ctx, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	var v T
+	if err = db.First(&v).Error; err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// Get 按主键查询，不存在时返回 gorm.ErrRecordNotFound
+func (r *Repo[T]) Get(ctx context.Context, id interface{}) (*T, error) {
+	db, err := r.DB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var v T
+	if err = db.First(&v, id).Error; err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// Count 统计满足条件的记录数
+func (r *Repo[T]) Count(ctx context.Context, scopes ...Scope) (int64, error) {
+	db, err := r.DB(ctx, scopes...)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	return total, db.Count(&total).Error
+}
+
+// Create 插入记录，自增主键回填到 v
+func (r *Repo[T]) Create(ctx context.Context, v *T) error {
+	db, err := r.DB(ctx)
+	if err != nil {
+		return err
+	}
+	return db.Create(v).Error
+}
+
+// CreateInBatches 按每批 batchSize 条批量插入
+func (r *Repo[T]) CreateInBatches(ctx context.Context, list []T, batchSize int) error {
+	if len(list) == 0 {
+		return nil
+	}
+	db, err := r.DB(ctx)
+	if err != nil {
+		return err
+	}
+	return db.CreateInBatches(list, batchSize).Error
+}
+
+// Save 按主键更新所有字段，主键为零值时插入
+func (r *Repo[T]) Save(ctx context.Context, v *T) error {
+	db, err := r.DB(ctx)
+	if err != nil {
+		return err
+	}
+	return db.Save(v).Error
+}
+
+// Update 更新满足条件的记录，values 为 map 或结构体（只更新非零值字段），返回影响的行数。
+// 没有条件时返回 gorm.ErrMissingWhereClause
+func (r *Repo[T]) Update(ctx context.Context, values interface{}, scopes ...Scope) (int64, error) {
+	db, err := r.DB(ctx, scopes...)
+	if err != nil {
+		return 0, err
+	}
+	db = db.Updates(values)
+	return db.RowsAffected, db.Error
+}
+
+// Delete 删除满足条件的记录，返回影响的行数，T 有 gorm.DeletedAt 字段时为软删除。
+// 没有条件时返回 gorm.ErrMissingWhereClause
+func (r *Repo[T]) Delete(ctx context.Context, scopes ...Scope) (int64, error) {
+	db, err := r.DB(ctx, scopes...)
+	if err != nil {
+		return 0, err
+	}
+	db = db.Delete(new(T))
+	return db.RowsAffected, db.Error
+}
+
+// PageResult 分页查询结果
+type PageResult[T any] struct {
+	Items []T   `json:"items"`
+	Total int64 `json:"total"`
+	Page  int   `json:"page"`
+	Size  int   `json:"size"`
+}
+
+// Page 分页查询，page 从 1 开始，size 不大于 0 时为 DefaultPageSize，超过 MaxPageSize 时取 MaxPageSize
+func (r *Repo[T]) Page(ctx context.Context, page, size int, scopes ...Scope) (*PageResult[T], error) {
+	page, size = pageArgs(page, size, MaxPageSize)
+	db, err := r.DB(ctx, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	ret := &PageResult[T]{Items: []T{}, Page: page, Size: size}
+	if err = db.Session(&gorm.Session{}).Count(&ret.Total).Error; err != nil {
+		return nil, err
+	}
+	if ret.Total <= int64((page-1)*size) {
+		return ret, nil
+	}
+	return ret, db.Offset((page - 1) * size).Limit(size).Find(&ret.Items).Error
+}
+
+func pageArgs(page, size, max int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	if max > 0 && size > max {
+		size = max
+	}
+	return page, size
+}
+
+// SortField 排序字段
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+func (s SortField) String() string {
+	if s.Desc {
+		return s.Column + ":desc"
+	}
+	return s.Column + ":asc"
+}
+
+// CursorPage 游标分页结果，Next 为空表示没有更多记录
+type CursorPage[T any] struct {
+	Items []T    `json:"items"`
+	Next  string `json:"next"`
+}
+
+type cursorData struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+}
+
+// Seek 按 sort 做游标（keyset）分页，cursor 为空时从头开始，传入上一页返回的 Next 取下一页。
+// sort 中的列需为 T 的字段且不为 NULL，未包含主键时自动追加主键保证顺序唯一，方向与最后一个排序列相同；
+// sort 为空时按主键升序，scopes 中只放过滤条件。游标与排序条件绑定，排序条件变化后旧游标返回 ErrInvalidCursor
+//
+//	page, err := messages.Seek(ctx, req.Cursor, 50, []sys.SortField{{Column: "created_at", Desc: true}},
+//		sys.Where("chat_id = ?", chatId))
+func (r *Repo[T]) Seek(ctx context.Context, cursor string, limit int, sort []SortField, scopes ...Scope) (*CursorPage[T], error) {
+	_, limit = pageArgs(1, limit, MaxPageSize)
+	return r.seek(ctx, cursor, limit, sort, scopes)
+}
+
+func (r *Repo[T]) seek(ctx context.Context, cursor string, limit int, sort []SortField, scopes []Scope) (*CursorPage[T], error) {
+	db, err := r.DB(ctx, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	s, err := r.schema(db)
+	if err != nil {
+		return nil, err
+	}
+	keys, fields, err := keysetFields(s, sort)
+	if err != nil {
+		return nil, err
+	}
+	if cursor != "" {
+		values, err := decodeCursor(cursor, keys, fields)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Clauses(clause.Where{Exprs: []clause.Expression{keysetAfter(keys, values)}})
+	}
+	ret := &CursorPage[T]{Items: []T{}}
+	if err = db.Scopes(OrderBy(keys...)).Limit(limit + 1).Find(&ret.Items).Error; err != nil {
+		return nil, err
+	}
+	if len(ret.Items) > limit {
+		ret.Items = ret.Items[:limit]
+		if ret.Next, err = encodeCursor(keys, fields, ret.Items[limit-1]); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// Each 按主键顺序每次取 batchSize 条交给 fn，fn 返回错误时停止并返回该错误，适合遍历大表
+func (r *Repo[T]) Each(ctx context.Context, batchSize int, fn func(batch []T) error, scopes ...Scope) error {
+	if batchSize <= 0 {
+		batchSize = DefaultPageSize
+	}
+	cursor := ""
+	for {
+		// 批量遍历不受 MaxPageSize 限制
+		page, err := r.seek(ctx, cursor, batchSize, nil, scopes)
+		if err != nil {
+			return err
+		}
+		if len(page.Items) > 0 {
+			if err = fn(page.Items); err != nil {
+				return err
+			}
+		}
+		if page.Next == "" {
+			return nil
+		}
+		cursor = page.Next
+	}
+}
+
+// T 的 gorm 模型信息
+func (r *Repo[T]) schema(db *gorm.DB) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+// 排序列对应的字段，未包含主键时追加主键
+func keysetFields(s *schema.Schema, sort []SortField) ([]SortField, []*schema.Field, error) {
+	keys := make([]SortField, 0, len(sort)+len(s.PrimaryFields))
+	fields := make([]*schema.Field, 0, cap(keys))
+	for _, k := range sort {
+		f := s.LookUpField(k.Column)
+		if f == nil || f.DBName == "" {
+			return nil, nil, fmt.Errorf("%w: unknown sort column %q", ErrInvalidQuery, k.Column)
+		}
+		keys = append(keys, SortField{Column: f.DBName, Desc: k.Desc})
+		fields = append(fields, f)
+	}
+	if len(s.PrimaryFields) == 0 {
+		return nil, nil, gorm.ErrPrimaryKeyRequired
+	}
+	desc := len(keys) > 0 && keys[len(keys)-1].Desc
+	for _, pk := range s.PrimaryFields {
+		if !inFields(pk, fields) {
+			keys = append(keys, SortField{Column: pk.DBName, Desc: desc})
+			fields = append(fields, pk)
+		}
+	}
+	return keys, fields, nil
+}
+
+func inFields(f *schema.Field, fields []*schema.Field) bool {
+	for _, v := range fields {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
+
+// 排在 values 之后的条件：(a > ?) OR (a = ? AND b > ?) ...，降序时为 <
+func keysetAfter(keys []SortField, values []interface{}) clause.Expression {
+	ors := make([]clause.Expression, 0, len(keys))
+	for i, k := range keys {
+		ands := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, clause.Eq{Column: clause.Column{Name: keys[j].Column}, Value: values[j]})
+		}
+		col := clause.Column{Name: k.Column}
+		if k.Desc {
+			ands = append(ands, clause.Lt{Column: col, Value: values[i]})
+		} else {
+			ands = append(ands, clause.Gt{Column: col, Value: values[i]})
+		}
+		ors = append(ors, clause.And(ands...))
+	}
+	return clause.Or(ors...)
+}
+
+func sortSignature(keys []SortField) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func encodeCursor(keys []SortField, fields []*schema.Field, item interface{}) (string, error) {
+	rv := reflect.Indirect(reflect.ValueOf(item))
+	data := cursorData{Sort: sortSignature(keys), Values: make([]json.RawMessage, len(fields))}
+	for i, f := range fields {
+		v, _ := f.ValueOf(rv)
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		data.Values[i] = b
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// 按字段类型还原游标中的值，避免大整数经 float64 丢失精度
+func decodeCursor(cursor string, keys []SortField, fields []*schema.Field) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var data cursorData
+	if err = json.Unmarshal(b, &data); err != nil || data.Sort != sortSignature(keys) || len(data.Values) != len(fields) {
+		return nil, ErrInvalidCursor
+	}
+	values := make([]interface{}, len(fields))
+	for i, f := range fields {
+		v := reflect.New(f.FieldType)
+		if err = json.Unmarshal(data.Values[i], v.Interface()); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values[i] = v.Elem().Interface()
+	}
+	return values, nil
+}
+
+// QueryOptions ParseQuery 允许的过滤与排序参数，未列出的参数被忽略，列名只取自这里
+type QueryOptions struct {
+	Filters     map[string]string // 可过滤的参数名 -> 列名
+	Sorts       map[string]string // 可排序的参数名 -> 列名
+	DefaultSort string            // 未传 sort 时的排序，格式同 sort 参数，如 "-id"
+	MaxSize     int               // 每页条数上限，缺省为 MaxPageSize
+}
+
+// Query ParseQuery 的解析结果
+type Query struct {
+	Filters []clause.Expression
+	Sort    []SortField
+	Page    int
+	Size    int
+	Cursor  string
+}
+
+var queryOps = []string{"eq", "ne", "gt", "gte", "lt", "lte", "like", "in", "null"}
+
+// ParseQuery 从请求参数解析过滤、排序与分页条件：
+//
+//	?status=1                 status = 1
+//	?created_at__gte=2021-01-01   支持 eq ne gt gte lt lte like in null
+//	?name__like=张            name LIKE '%张%'
+//	?id__in=1,2,3             id IN (1,2,3)
+//	?deleted_at__null=true    deleted_at IS NULL，false 为 IS NOT NULL
+//	?sort=-created_at,id      按 created_at 降序、id 升序
+//	?page=2&size=20&cursor=…
+//
+// 参数名与列名需在 opts 中声明，不合法时返回 ErrInvalidQuery
+//
+//	q, err := sys.ParseQuery(r.URL.Query(), sys.QueryOptions{
+//		Filters: map[string]string{"status": "status", "created_at": "created_at"},
+//		Sorts:   map[string]string{"created_at": "created_at"},
+//		DefaultSort: "-created_at",
+//	})
+//	page, err := orders.Page(ctx, q.Page, q.Size, q.Scopes()...)
+func ParseQuery(values url.Values, opts QueryOptions) (*Query, error) {
+	q := &Query{Cursor: values.Get("cursor")}
+	var err error
+	if q.Page, err = queryInt(values, "page"); err != nil {
+		return nil, err
+	}
+	if q.Size, err = queryInt(values, "size"); err != nil {
+		return nil, err
+	}
+	max := opts.MaxSize
+	if max <= 0 {
+		max = MaxPageSize
+	}
+	q.Page, q.Size = pageArgs(q.Page, q.Size, max)
+
+	// 按参数名排序，同样的请求生成同样的 SQL，便于查询缓存与 SQL 统计
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		vs := values[key]
+		param, op := key, "eq"
+		if i := strings.LastIndex(key, "__"); i > 0 {
+			param, op = key[:i], key[i+2:]
+		}
+		column, ok := opts.Filters[param]
+		if !ok || len(vs) == 0 {
+			continue
+		}
+		if !inStrings(op, queryOps) {
+			return nil, fmt.Errorf("%w: unsupported operator %q", ErrInvalidQuery, key)
+		}
+		expr, err := filterExpr(column, op, vs[len(vs)-1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidQuery, key, err)
+		}
+		q.Filters = append(q.Filters, expr)
+	}
+
+	sorts := values.Get("sort")
+	if sorts == "" {
+		sorts = opts.DefaultSort
+	}
+	for _, s := range strings.Split(sorts, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		desc := strings.HasPrefix(s, "-")
+		s = strings.TrimLeft(s, "+-")
+		column, ok := opts.Sorts[s]
+		if !ok {
+			return nil, fmt.Errorf("%w: unsupported sort %q", ErrInvalidQuery, s)
+		}
+		q.Sort = append(q.Sort, SortField{Column: column, Desc: desc})
+	}
+	return q, nil
+}
+
+func queryInt(values url.Values, key string) (int, error) {
+	v := values.Get(key)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s must be an integer", ErrInvalidQuery, key)
+	}
+	return n, nil
+}
+
+func filterExpr(column, op, value string) (clause.Expression, error) {
+	col := clause.Column{Name: column}
+	switch op {
+	case "eq":
+		return clause.Eq{Column: col, Value: value}, nil
+	case "ne":
+		return clause.Neq{Column: col, Value: value}, nil
+	case "gt":
+		return clause.Gt{Column: col, Value: value}, nil
+	case "gte":
+		return clause.Gte{Column: col, Value: value}, nil
+	case "lt":
+		return clause.Lt{Column: col, Value: value}, nil
+	case "lte":
+		return clause.Lte{Column: col, Value: value}, nil
+	case "like":
+		r := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+		return likeEscaped{Column: col, Value: "%" + r.Replace(value) + "%"}, nil
+	case "in":
+		parts := strings.Split(value, ",")
+		vs := make([]interface{}, len(parts))
+		for i, p := range parts {
+			vs[i] = strings.TrimSpace(p)
+		}
+		return clause.IN{Column: col, Values: vs}, nil
+	case "null":
+		isNull, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+		if isNull {
+			return clause.Eq{Column: col, Value: nil}, nil
+		}
+		return clause.Neq{Column: col, Value: nil}, nil
+	}
+	return nil, fmt.Errorf("unsupported operator %q", op)
+}
+
+// LIKE 条件，值中的 %、_ 以 \ 转义。MySQL、Postgres 默认以 \ 为转义符，
+// SQLite、SQL Server 没有默认转义符，需声明 ESCAPE
+type likeEscaped struct {
+	Column clause.Column
+	Value  string
+}
+
+func (l likeEscaped) Build(builder clause.Builder) {
+	builder.WriteQuoted(l.Column)
+	builder.WriteString(" LIKE ")
+	builder.AddVar(builder, l.Value)
+	if stmt, ok := builder.(*gorm.Statement); ok {
+		switch stmt.Dialector.Name() {
+		case "sqlite", "sqlserver":
+			builder.WriteString(` ESCAPE '\'`)
+		}
+	}
+}
+
+// Where 返回过滤条件
+func (q *Query) Where() Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(q.Filters) == 0 {
+			return db
+		}
+		return db.Clauses(clause.Where{Exprs: q.Filters})
+	}
+}
+
+// Scopes 返回过滤与排序条件，用于 Find、Page
+func (q *Query) Scopes() []Scope {
+	return []Scope{q.Where(), OrderBy(q.Sort...)}
+}
@@ -0,0 +1,244 @@
+package sys
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+type primaryCtxKey struct{}
+
+// WithPrimary 返回强制使用主库的 ctx，用于写后立即读取等需要强一致的场景
+//
+//	db, _ := sys.GormE(sys.WithPrimary(ctx))
+//	db.First(&order, id)
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryCtxKey{}, true)
+}
+
+// IsPrimary 判断 ctx 是否要求使用主库
+func IsPrimary(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	v, _ := ctx.Value(primaryCtxKey{}).(bool)
+	return v
+}
+
+// useReplicas 按数据源配置中的 replicas 注册读写分离：查询发往从库，写入与事务发往主库，
+// WithPrimary 的 ctx 中的查询也发往主库。
+//
+//	[db-scrm]
+//	driver         = "mysql"
+//	host           = "master.db"
+//	replica_policy = "random"       # random（按权重随机，默认）或 round_robin（按权重轮询）
+//	replicas       = ["slave1.db", "slave2.db:3307"]
+//
+//	# 或逐个配置，未配置的项沿用主库
+//	[[db-scrm.replicas]]
+//	host   = "slave1.db"
+//	weight = 2
+func (m *GormClientManager) useReplicas(client *gorm.DB, config map[string]interface{}, setPool func(pool *sql.DB)) error {
+	replicas, weights, err := replicaConfigs(config)
+	if err != nil || len(replicas) == 0 {
+		return err
+	}
+	policyName, err := dsString(config, "replica_policy", false)
+	if err != nil {
+		return err
+	}
+	policy, err := newReplicaPolicy(policyName, weights)
+	if err != nil {
+		return err
+	}
+	dialectors := make([]gorm.Dialector, 0, len(replicas))
+	for i, replica := range replicas {
+		d, err := m.dialector(replica)
+		if err != nil {
+			var de *DatasourceError
+			if errors.As(err, &de) && de.Key != "" {
+				de.Key = fmt.Sprintf("replicas[%d].%s", i, de.Key)
+			}
+			return err
+		}
+		dialectors = append(dialectors, d)
+	}
+	primary, err := client.DB()
+	if err != nil {
+		return &DatasourceError{Err: ErrConnectFailed, Cause: err}
+	}
+	// 主库连接，开启 PrepareStmt 时为 gorm 的预编译连接
+	source := client.Statement.ConnPool
+	var pools []*sql.DB
+	resolver := dbresolver.Register(dbresolver.Config{Replicas: dialectors, Policy: policy})
+	// 在插件初始化时依次回调主库与各从库的连接池，借此设置连接池参数并记录从库以便关闭
+	_ = resolver.Call(func(connPool gorm.ConnPool) error {
+		if pool, ok := connPool.(*sql.DB); ok && pool != primary {
+			setPool(pool)
+			pools = append(pools, pool)
+		}
+		return nil
+	})
+	if err = client.Use(resolver); err != nil {
+		for _, pool := range pools {
+			_ = pool.Close()
+		}
+		return &DatasourceError{Key: "replicas", Err: ErrConnectFailed, Cause: err}
+	}
+	m.replicas.Store(primary, pools)
+	// dbresolver 的回调位于最前，在其选择连接之后将 WithPrimary 的读请求改回主库
+	fn := forcePrimary(source)
+	if err = client.Callback().Query().Before("gorm:query").Register("gotool:force_primary", fn); err != nil {
+		return err
+	}
+	if err = client.Callback().Row().Before("gorm:row").Register("gotool:force_primary", fn); err != nil {
+		return err
+	}
+	return client.Callback().Raw().Before("gorm:raw").Register("gotool:force_primary", fn)
+}
+
+// WithPrimary 的 ctx 中的读请求发往主库，事务中的请求已在主库上，不做处理
+func forcePrimary(source gorm.ConnPool) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if !IsPrimary(db.Statement.Context) {
+			return
+		}
+		if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx {
+			return
+		}
+		db.Statement.ConnPool = source
+	}
+}
+
+// 解析 replicas 配置，每个从库沿用主库未覆盖的配置项，返回从库配置与权重
+func replicaConfigs(config map[string]interface{}) (replicas []map[string]interface{}, weights []int, err error) {
+	raw, ok := config["replicas"]
+	if !ok || raw == nil {
+		return nil, nil, nil
+	}
+	var items []interface{}
+	switch v := raw.(type) {
+	case []interface{}:
+		items = v
+	case []map[string]interface{}:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	case []string:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	default:
+		return nil, nil, invalidDatasourceConfig("replicas", fmt.Errorf("expected list, got %T", raw))
+	}
+	for i, item := range items {
+		replica := make(map[string]interface{}, len(config))
+		for k, v := range config {
+			if k != "replicas" && k != "replica_policy" {
+				replica[k] = v
+			}
+		}
+		weight := 1
+		switch v := item.(type) {
+		case string:
+			host, port, splitErr := net.SplitHostPort(v)
+			if splitErr != nil {
+				host, port = v, ""
+			}
+			replica["host"] = strings.TrimSpace(host)
+			if port != "" {
+				replica["port"] = port
+			}
+		case map[string]interface{}:
+			for k, val := range v {
+				replica[strings.ToLower(k)] = val
+			}
+			if weight, err = dsInt(v, "weight", 1); err != nil {
+				return nil, nil, invalidDatasourceConfig(fmt.Sprintf("replicas[%d].weight", i), err)
+			}
+			delete(replica, "weight")
+		default:
+			return nil, nil, invalidDatasourceConfig(fmt.Sprintf("replicas[%d]", i), fmt.Errorf("expected string or table, got %T", item))
+		}
+		if weight <= 0 {
+			return nil, nil, invalidDatasourceConfig(fmt.Sprintf("replicas[%d].weight", i), fmt.Errorf("must be positive, got %d", weight))
+		}
+		replicas = append(replicas, replica)
+		weights = append(weights, weight)
+	}
+	return
+}
+
+func newReplicaPolicy(name string, weights []int) (dbresolver.Policy, error) {
+	switch name {
+	case "", "random":
+		return newWeightedRandomPolicy(weights), nil
+	case "round_robin":
+		return newRoundRobinPolicy(weights), nil
+	}
+	return nil, invalidDatasourceConfig("replica_policy", fmt.Errorf("unsupported policy %q", name))
+}
+
+// 按权重随机选择从库
+type weightedRandomPolicy struct {
+	weights []int
+	total   int
+}
+
+func newWeightedRandomPolicy(weights []int) *weightedRandomPolicy {
+	p := &weightedRandomPolicy{weights: weights}
+	for _, w := range weights {
+		p.total += w
+	}
+	return p
+}
+
+func (p *weightedRandomPolicy) Resolve(connPools []gorm.ConnPool) gorm.ConnPool {
+	if len(connPools) != len(p.weights) || p.total == 0 {
+		return connPools[rand.Intn(len(connPools))]
+	}
+	n := rand.Intn(p.total)
+	for i, w := range p.weights {
+		if n < w {
+			return connPools[i]
+		}
+		n -= w
+	}
+	return connPools[len(connPools)-1]
+}
+
+// 按权重轮询从库，权重为 2 的从库在每轮中被选中两次
+type roundRobinPolicy struct {
+	slots []int
+	next  uint64
+}
+
+func newRoundRobinPolicy(weights []int) *roundRobinPolicy {
+	p := &roundRobinPolicy{}
+	for i, w := range weights {
+		for j := 0; j < w; j++ {
+			p.slots = append(p.slots, i)
+		}
+	}
+	return p
+}
+
+func (p *roundRobinPolicy) Resolve(connPools []gorm.ConnPool) gorm.ConnPool {
+	n := atomic.AddUint64(&p.next, 1) - 1
+	if len(p.slots) == 0 {
+		return connPools[n%uint64(len(connPools))]
+	}
+	i := p.slots[n%uint64(len(p.slots))]
+	if i >= len(connPools) {
+		i = len(connPools) - 1
+	}
+	return connPools[i]
+}
@@ -0,0 +1,6 @@
+//go:build cgo
+
+package sys
+
+// mattn/go-sqlite3 依赖 cgo，CGO_ENABLED=0 编译时 sqlite 数据源不可用
+const sqliteAvailable = true
@@ -0,0 +1,6 @@
+//go:build !cgo
+
+package sys
+
+// CGO_ENABLED=0 编译时 mattn/go-sqlite3 只有桩实现，连接时才报错，这里提前给出明确的错误
+const sqliteAvailable = false
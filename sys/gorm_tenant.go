@@ -0,0 +1,242 @@
+package sys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// ErrTenantRequired 按租户隔离的模型在 ctx 中没有租户时执行查询、写入
+	ErrTenantRequired = errors.New("tenant required")
+	// ErrTenantMismatch 写入的租户与 ctx 中的租户不一致
+	ErrTenantMismatch = errors.New("tenant mismatch")
+	// ErrUnknownTenantColumn TenantScoped 返回的租户列在模型中不存在，该模型的查询、写入均失败
+	ErrUnknownTenantColumn = errors.New("unknown tenant column")
+)
+
+// TenantScoped 按租户隔离的模型，返回租户列名。也可在字段的 gorm 标签中加 tenant 声明：
+//
+//	CorpId string `gorm:"column:corp_id;tenant"`
+type TenantScoped interface {
+	TenantColumn() string
+}
+
+type tenantCtxKey struct{}
+
+// WithTenant 返回携带租户的 ctx，按租户隔离的模型的查询、更新、删除自动加上租户条件，创建时自动填充租户列
+//
+//	list, err := messages.Find(sys.WithTenant(ctx, corpId), sys.Where("room_id = ?", roomId))
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenant)
+}
+
+// Tenant 返回 ctx 中的租户，未通过 WithTenant 设置时取 WithAuditor 的租户
+func Tenant(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if tenant, ok := ctx.Value(tenantCtxKey{}).(string); ok {
+		return tenant
+	}
+	_, tenant := Auditor(ctx)
+	return tenant
+}
+
+const skipTenantKey = "gotool:skip_tenant"
+
+// SkipTenant 不加租户条件，用于跨租户的后台任务、统计等，需显式使用
+//
+//	db.Scopes(sys.SkipTenant).Find(&list)
+//	messages.Count(ctx, sys.SkipTenant)
+func SkipTenant(db *gorm.DB) *gorm.DB {
+	return db.Set(skipTenantKey, true)
+}
+
+// 租户隔离插件，对声明了租户列的模型：查询、更新、删除加上 租户列 = ctx 中的租户，创建时填充租户列；
+// ctx 中没有租户且未使用 SkipTenant 时返回 ErrTenantRequired。Raw、Exec 执行的 SQL 不做处理
+type gormTenant struct {
+	columns sync.Map // *schema.Schema -> tenantColumn
+}
+
+// 模型的租户列，未声明时 field 为 nil；TenantScoped 声明的列不存在时 err 不为 nil
+type tenantColumn struct {
+	field *schema.Field
+	err   error
+}
+
+func (t *gormTenant) Name() string {
+	return "gotool:tenant"
+}
+
+func (t *gormTenant) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register("gotool:tenant", t.create); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("gotool:tenant", t.where); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("gotool:tenant", t.where); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("gotool:tenant", t.update); err != nil {
+		return err
+	}
+	return cb.Delete().Before("gorm:delete").Register("gotool:tenant", t.where)
+}
+
+// 模型的租户列，未声明时返回 nil
+func (t *gormTenant) field(s *schema.Schema) (*schema.Field, error) {
+	if v, ok := t.columns.Load(s); ok {
+		c := v.(tenantColumn)
+		return c.field, c.err
+	}
+	var c tenantColumn
+	if scoped, ok := reflect.New(s.ModelType).Interface().(TenantScoped); ok {
+		// 列名写错时不能退化为不加租户条件
+		if c.field = s.LookUpField(scoped.TenantColumn()); c.field == nil {
+			c.err = fmt.Errorf("%w: %s.%s", ErrUnknownTenantColumn, s.Table, scoped.TenantColumn())
+		}
+	} else {
+		for _, f := range s.Fields {
+			if _, ok := f.TagSettings["TENANT"]; ok && f.DBName != "" {
+				c.field = f
+				break
+			}
+		}
+	}
+	t.columns.Store(s, c)
+	return c.field, c.err
+}
+
+// 返回租户列与 ctx 中的租户，无需处理时 field 为 nil
+func (t *gormTenant) tenant(db *gorm.DB) (field *schema.Field, tenant string) {
+	// Raw 的 SQL 已写好，迁移工具查询表结构时也会带上模型，均不处理
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.SQL.Len() > 0 {
+		return nil, ""
+	}
+	if skip, ok := db.Get(skipTenantKey); ok && skip == true {
+		return nil, ""
+	}
+	field, err := t.field(db.Statement.Schema)
+	if err != nil {
+		db.AddError(err)
+		return nil, ""
+	}
+	if field == nil {
+		return nil, ""
+	}
+	if tenant = Tenant(db.Statement.Context); tenant == "" {
+		db.AddError(fmt.Errorf("%w: %s", ErrTenantRequired, db.Statement.Schema.Table))
+		return nil, ""
+	}
+	return field, tenant
+}
+
+func (t *gormTenant) where(db *gorm.DB) {
+	field, tenant := t.tenant(db)
+	if field == nil {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenant},
+	}})
+}
+
+func (t *gormTenant) create(db *gorm.DB) {
+	field, tenant := t.tenant(db)
+	if field == nil {
+		return
+	}
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := setTenant(field, reflect.Indirect(rv.Index(i)), tenant); err != nil {
+				db.AddError(err)
+				return
+			}
+		}
+	default:
+		db.AddError(setTenant(field, rv, tenant))
+	}
+}
+
+// 租户列为零值时填充，已有值时需与 tenant 一致；Model(&T{}).Create(map) 的 map 同样处理
+func setTenant(field *schema.Field, rv reflect.Value, tenant string) error {
+	switch rv.Kind() {
+	case reflect.Struct:
+	case reflect.Map:
+		return setMapTenant(field, rv, tenant)
+	default:
+		return fmt.Errorf("%w: cannot set %s on %s", ErrTenantRequired, field.DBName, rv.Type())
+	}
+	if v, zero := field.ValueOf(rv); !zero {
+		if fmt.Sprint(v) != tenant {
+			return fmt.Errorf("%w: %s = %v, tenant %s", ErrTenantMismatch, field.DBName, v, tenant)
+		}
+		return nil
+	}
+	return field.Set(rv, tenant)
+}
+
+// map 的键可以是列名或字段名，均未设置时以列名填充
+func setMapTenant(field *schema.Field, m reflect.Value, tenant string) error {
+	value := reflect.ValueOf(tenant)
+	if m.IsNil() || m.Type().Key().Kind() != reflect.String || !value.Type().AssignableTo(m.Type().Elem()) {
+		return fmt.Errorf("%w: cannot set %s on %s", ErrTenantRequired, field.DBName, m.Type())
+	}
+	key := reflect.ValueOf(field.DBName).Convert(m.Type().Key())
+	for _, name := range []string{field.DBName, field.Name} {
+		k := reflect.ValueOf(name).Convert(m.Type().Key())
+		v := m.MapIndex(k)
+		if !v.IsValid() {
+			continue
+		}
+		if v = reflect.Indirect(reflect.ValueOf(v.Interface())); v.IsValid() && !v.IsZero() {
+			if fmt.Sprint(v.Interface()) != tenant {
+				return fmt.Errorf("%w: %s = %v, tenant %s", ErrTenantMismatch, field.DBName, v.Interface(), tenant)
+			}
+			return nil
+		}
+		key = k
+		break
+	}
+	m.SetMapIndex(key, value)
+	return nil
+}
+
+// 更新时加上租户条件，且不允许把租户列改为其他租户
+func (t *gormTenant) update(db *gorm.DB) {
+	field, tenant := t.tenant(db)
+	if field == nil {
+		return
+	}
+	var v interface{}
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]interface{}:
+		if value, ok := dest[field.DBName]; ok {
+			v = value
+		} else {
+			v = dest[field.Name]
+		}
+	default:
+		if rv := reflect.Indirect(reflect.ValueOf(dest)); rv.Kind() == reflect.Struct && rv.Type() == db.Statement.Schema.ModelType {
+			if value, zero := field.ValueOf(rv); !zero {
+				v = value
+			}
+		}
+	}
+	if v != nil && fmt.Sprint(v) != tenant {
+		db.AddError(fmt.Errorf("%w: %s = %v, tenant %s", ErrTenantMismatch, field.DBName, v, tenant))
+		return
+	}
+	t.where(db)
+}
@@ -0,0 +1,226 @@
+package sys
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+var (
+	// TxMaxRetries 死锁、序列化失败时整个事务的默认重试次数
+	TxMaxRetries = 3
+	// TxBackoff 首次重试前的默认等待时长，之后逐次翻倍并加入随机抖动
+	TxBackoff = 20 * time.Millisecond
+)
+
+// TxOptions TxWithOptions 的选项
+type TxOptions struct {
+	Isolation  sql.IsolationLevel
+	ReadOnly   bool
+	MaxRetries int           // 缺省为 TxMaxRetries，小于 0 时不重试
+	Backoff    time.Duration // 缺省为 TxBackoff
+}
+
+type txCtxKey struct {
+	name string
+}
+
+// 事务、其中已创建的保存点数量及提交后执行的函数
+type txScope struct {
+	tx         *gorm.DB
+	savepoints int32
+	mu         sync.Mutex
+	committed  []func()
+}
+
+// 事务提交后执行 fn，回滚时不执行
+func (s *txScope) afterCommit(fn func()) {
+	s.mu.Lock()
+	s.committed = append(s.committed, fn)
+	s.mu.Unlock()
+}
+
+// Tx 在数据源 name 上执行事务，name 为空时使用 app.toml 的 default_db。
+// fn 返回错误或 panic 时回滚，否则提交；遇到死锁、序列化失败时按 TxBackoff 退避后重新执行整个 fn。
+// 事务保存在 tx 绑定的 ctx 中，在 fn 内以该 ctx 调用 sys.GormE 会得到同一事务，
+// 再次调用 sys.Tx 则在同一事务中创建保存点，内层出错只回滚到保存点，重试由最外层负责
+//
+//	err := sys.Tx(ctx, "db-scrm", func(tx *gorm.DB) error {
+//		if err := tx.Create(&order).Error; err != nil {
+//			return err
+//		}
+//		return stock.Deduct(tx.Statement.Context, order.SkuId, order.Num) // 内部使用 sys.GormE(ctx, "db-scrm")
+//	})
+func Tx(ctx context.Context, name string, fn func(tx *gorm.DB) error) error {
+	return TxWithOptions(ctx, name, nil, fn)
+}
+
+// TxWithOptions 与 Tx 相同，可指定隔离级别、只读及重试策略，嵌套调用时忽略 opts
+func TxWithOptions(ctx context.Context, name string, opts *TxOptions, fn func(tx *gorm.DB) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	name, err := datasourceName("gorm", "default_db", []string{name})
+	if err != nil {
+		return err
+	}
+	if scope, ok := ctx.Value(txCtxKey{name}).(*txScope); ok {
+		return scope.nested(ctx, fn)
+	}
+	db, err := gormClient([]string{name})
+	if err != nil {
+		return err
+	}
+	o := TxOptions{MaxRetries: TxMaxRetries, Backoff: TxBackoff}
+	if opts != nil {
+		o.Isolation, o.ReadOnly = opts.Isolation, opts.ReadOnly
+		if opts.MaxRetries != 0 {
+			o.MaxRetries = opts.MaxRetries
+		}
+		if opts.Backoff > 0 {
+			o.Backoff = opts.Backoff
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		err = runTx(ctx, name, db, o, fn)
+		if err == nil || attempt >= o.MaxRetries || !IsRetryableTxError(err) {
+			return err
+		}
+		wait := o.Backoff << attempt
+		wait += time.Duration(rand.Int63n(int64(wait)/2 + 1))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+func runTx(ctx context.Context, name string, db *gorm.DB, o TxOptions, fn func(tx *gorm.DB) error) error {
+	var txOpts *sql.TxOptions
+	if o.Isolation != sql.LevelDefault || o.ReadOnly {
+		txOpts = &sql.TxOptions{Isolation: o.Isolation, ReadOnly: o.ReadOnly}
+	}
+	tx := db.WithContext(ctx).Begin(txOpts)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	scope := &txScope{}
+	tx = tx.WithContext(context.WithValue(ctx, txCtxKey{name}, scope))
+	scope.tx = tx
+
+	panicked := true
+	defer func() {
+		// fn panic 时回滚，panic 继续向上传递
+		if panicked {
+			tx.Rollback()
+		}
+	}()
+	err := fn(tx)
+	panicked = false
+	if err != nil {
+		if rbErr := tx.Rollback().Error; rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			fmt.Println("Tx rollback", name, "err:", rbErr)
+		}
+		return err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return err
+	}
+	for _, fn := range scope.committed {
+		fn()
+	}
+	return nil
+}
+
+// 在已有事务中以保存点执行 fn
+func (s *txScope) nested(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	sp := fmt.Sprintf("gotool_sp_%d", atomic.AddInt32(&s.savepoints, 1))
+	tx := s.tx.WithContext(ctx)
+	if err := tx.SavePoint(sp).Error; err != nil {
+		return err
+	}
+	panicked := true
+	defer func() {
+		if panicked {
+			tx.RollbackTo(sp)
+		}
+	}()
+	err := fn(tx)
+	panicked = false
+	if err != nil {
+		// 死锁等错误已使整个事务失效，回滚到保存点也会失败，交由外层回滚并重试
+		if !IsRetryableTxError(err) {
+			if rbErr := tx.RollbackTo(sp).Error; rbErr != nil {
+				fmt.Println("Tx rollback to", sp, "err:", rbErr)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// 隐藏 ctx 中 sys.Tx 开启的事务，其余值不变
+type noTxCtx struct {
+	context.Context
+}
+
+func (c noTxCtx) Value(key interface{}) interface{} {
+	if _, ok := key.(txCtxKey); ok {
+		return nil
+	}
+	return c.Context.Value(key)
+}
+
+func withoutTx(ctx context.Context) context.Context {
+	return noTxCtx{ctx}
+}
+
+// TxFromContext 返回 ctx 中 sys.Tx 在数据源 name 上开启的事务，name 为空时使用 default_db
+func TxFromContext(ctx context.Context, name string) (*gorm.DB, bool) {
+	return txFromContext(ctx, []string{name})
+}
+
+func txFromContext(ctx context.Context, names []string) (*gorm.DB, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	name, err := datasourceName("gorm", "default_db", names)
+	if err != nil {
+		return nil, false
+	}
+	if scope, ok := ctx.Value(txCtxKey{name}).(*txScope); ok {
+		return scope.tx, true
+	}
+	return nil, false
+}
+
+// IsRetryableTxError 判断是否为重试事务即可解决的错误：
+// MySQL 1213 死锁、1205 锁等待超时，Postgres 40001 序列化失败、40P01 死锁，SQL Server 1205 死锁
+func IsRetryableTxError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var my *mysqldriver.MySQLError
+	if errors.As(err, &my) {
+		return my.Number == 1213 || my.Number == 1205
+	}
+	var pg interface{ SQLState() string }
+	if errors.As(err, &pg) {
+		state := pg.SQLState()
+		return state == "40001" || state == "40P01"
+	}
+	var ms interface{ SQLErrorNumber() int32 }
+	if errors.As(err, &ms) {
+		return ms.SQLErrorNumber() == 1205
+	}
+	return false
+}
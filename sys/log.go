@@ -55,7 +55,10 @@ func (hook lineHook) Fire(entry *logrus.Entry) error {
 	logMsg, _ := json.Marshal(entry.Data)
 	// 发送错误消息
 	if Cfg("app").GetString("ErrNoticeRdsKey") != "" {
-		_ = Redis().LPush(context.Background(), Cfg("app").GetString("ErrNoticeRdsKey"), "【"+Cfg("app").GetString("service_name")+"】"+string(logMsg)).Err()
+		// Redis 不可用时不影响日志输出
+		if rds := Redis(); rds != nil {
+			_ = rds.LPush(context.Background(), Cfg("app").GetString("ErrNoticeRdsKey"), "【"+Cfg("app").GetString("service_name")+"】"+string(logMsg)).Err()
+		}
 	}
 	return nil
 }
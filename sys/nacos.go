@@ -4,14 +4,22 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/spf13/viper"
+	"path/filepath"
+	"strings"
+	"sync"
 )
 
-var NacosConfig map[string]string
+var (
+	NacosConfig   map[string]string
+	nacosGroups   = make(map[string]string)
+	nacosFormats  = make(map[string]string)
+	nacosConfigRw sync.RWMutex
+)
 
 func Nacos(files ...string) *viper.Viper {
 	var file string
 	if len(files) == 0 {
-		file = Cfg("app").GetString("nacos.defaultDataId")
+		file = defaultDataId()
 	} else {
 		file = files[0]
 	}
@@ -19,7 +27,15 @@ func Nacos(files ...string) *viper.Viper {
 		fmt.Println("获取 naocs 失败")
 		return nil
 	}
-	if _, ok := NacosConfig[file]; !ok {
+	nacosConfigRw.RLock()
+	data, ok := NacosConfig[file]
+	group := nacosGroups[file]
+	format := nacosFormats[file]
+	nacosConfigRw.RUnlock()
+	if format == "" {
+		format = formatByExt(file)
+	}
+	if !ok {
 		fmt.Println("read nacos configLocal file err 0")
 		return nil
 	}
@@ -30,13 +46,67 @@ func Nacos(files ...string) *viper.Viper {
 	}
 	// 读取基础配置
 	baseConfig := viper.New()
-	baseConfig.SetConfigType("toml")
-	err := baseConfig.ReadConfig(bytes.NewBuffer([]byte(NacosConfig[file])))
+	baseConfig.SetConfigType(format)
+	err := baseConfig.ReadConfig(bytes.NewBuffer([]byte(data)))
 	if err != nil {
-		fmt.Println("read nacos configLocal err 1")
+		fmt.Println("read nacos configLocal err 1:", file, format, err)
 		return nil
-	} else {
-		configLocal.vipers[file] = baseConfig
-		return baseConfig
 	}
+	layers := []*cfgLayer{{Kind: "nacos", Source: "dataId=" + file + " group=" + group + " format=" + format, Settings: baseConfig.AllSettings()}}
+	configLocal.layers[file], configLocal.vipers[file] = buildViper(file, layers)
+	return configLocal.vipers[file]
+}
+
+// SetNacosConfig 更新 dataId 的远程配置内容，已读取过的配置会重新解析并通知 OnCfgChange 的订阅者
+func SetNacosConfig(dataId, group, data string) {
+	nacosConfigRw.Lock()
+	if NacosConfig == nil {
+		NacosConfig = make(map[string]string)
+	}
+	NacosConfig[dataId] = data
+	nacosGroups[dataId] = group
+	nacosConfigRw.Unlock()
+
+	configLocal.RLock()
+	old, loaded := configLocal.vipers[dataId]
+	configLocal.RUnlock()
+	ResetCfgKey(dataId)
+	if !loaded {
+		return
+	}
+	if vp := Nacos(dataId); vp != nil {
+		notifyCfgChange(dataId, old, vp)
+	}
+}
+
+// 记录 dataId 的配置格式，需在 SetNacosConfig 之前调用
+func setNacosFormat(dataId, format string) {
+	nacosConfigRw.Lock()
+	nacosFormats[dataId] = format
+	nacosConfigRw.Unlock()
+}
+
+// 将各种写法统一为 viper 支持的格式名，不支持时返回空字符串
+func normalizeCfgFormat(format string) string {
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "toml":
+		return "toml"
+	case "yaml", "yml":
+		return "yaml"
+	case "json":
+		return "json"
+	case "properties", "props", "prop":
+		return "properties"
+	case "hcl":
+		return "hcl"
+	}
+	return ""
+}
+
+// 按 dataId 的扩展名判断配置格式，无法判断时为 toml
+func formatByExt(dataId string) string {
+	if format := normalizeCfgFormat(filepath.Ext(dataId)); format != "" {
+		return format
+	}
+	return "toml"
 }
@@ -1,31 +1,44 @@
 package sys
 
 import (
-	"encoding/json"
-	"github.com/EricJSanchez/gotool/environment"
+	"context"
+	"fmt"
+
 	"github.com/redis/go-redis/v9"
 )
 
 var redisManager = NewRedisClientManager()
 
+func init() {
+	addDatasource(redisManager.Manager())
+}
+
+// Redis 获取 Redis 连接，names 为空时使用 app.toml 的 default_redis，未配置或配置有误时返回 nil；
+// 与以往一致，PING 失败时只打印错误，仍返回连接
 func Redis(names ...string) (client *redis.Client) {
-	var name = Cfg("app").GetString("default_redis")
+	client, err := redisClient(lenientConnect(context.Background()), names)
+	if err != nil {
+		fmt.Println("Redis err:", err)
+		return nil
+	}
+	return
+}
+
+// RedisE 与 Redis 相同，获取失败时返回 *DatasourceError，可通过 errors.Is 判断
+// ErrDatasourceNotConfigured、ErrInvalidDatasourceConfig、ErrConnectFailed。
+// 首次创建连接时以 ctx 执行 PING
+func RedisE(ctx context.Context, names ...string) (*redis.Client, error) {
+	return redisClient(ctx, names)
+}
 
-	if len(names) > 0 {
-		name = names[0]
+func redisClient(ctx context.Context, names []string) (*redis.Client, error) {
+	name, config, err := datasourceConfig("redis", "default_redis", names)
+	if err != nil {
+		return nil, err
 	}
-	var config map[string]interface{}
-	if environment.Is(environment.Development) {
-		config = Cfg("db").GetStringMap(name)
-		if len(config) == 0 {
-			config = Nacos("database.toml").GetStringMap(name)
-		}
-	} else {
-		config = Nacos("database.toml").GetStringMap(name)
+	pool, err := redisManager.GetE(ctx, name, config)
+	if err != nil {
+		return nil, err
 	}
-	connectUniq, _ := json.Marshal(config)
-	name = name + Md5(string(connectUniq))
-	pool := redisManager.Get(name, config)
-	client = pool.pool
-	return
+	return pool.pool, nil
 }
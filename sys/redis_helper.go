@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"github.com/redis/go-redis/v9"
 	"github.com/spf13/cast"
-	"sync"
 	"time"
 )
 
@@ -21,64 +20,74 @@ func (rds *RedisConn) ShowDebug(b bool) {
 }
 
 type RedisClientManager struct {
-	rw      *sync.RWMutex
-	clients map[string]*RedisConn
+	clients *ClientManager[*RedisConn]
 }
 
 func NewRedisClientManager() *RedisClientManager {
-	return &RedisClientManager{
-		rw:      &sync.RWMutex{},
-		clients: make(map[string]*RedisConn),
-	}
+	m := &RedisClientManager{}
+	m.clients = NewClientManager("redis", ClientOptions[*RedisConn]{
+		Factory: m.NewInstanceE,
+		HealthCheck: func(ctx context.Context, client *RedisConn) error {
+			return client.pool.Ping(ctx).Err()
+		},
+		Close: func(client *RedisConn) error {
+			return client.pool.Close()
+		},
+	})
+	return m
+}
+
+// Manager 返回底层的通用客户端管理器
+func (m *RedisClientManager) Manager() *ClientManager[*RedisConn] {
+	return m.clients
 }
 
 // 获取给定名称的 Gorm 客户端实例（如果客户端不存在则返回 nil）
 func (m *RedisClientManager) Get(name string, config map[string]interface{}) *RedisConn {
-	// 1、获取连接实例
-	m.rw.RLock()
-	if client, exists := m.clients[name]; exists {
-		m.rw.RUnlock()
-		return client
+	client, err := m.GetE(context.Background(), name, config)
+	if err != nil {
+		fmt.Println("redis Get err:", err)
+		return nil
 	}
-	m.rw.RUnlock()
+	return client
+}
 
-	// 获取读写锁
-	m.rw.Lock()
-	defer m.rw.Unlock()
+// GetE 获取给定名称的 Redis 连接池，不存在时创建，连接失败的连接池会被关闭且不缓存
+func (m *RedisClientManager) GetE(ctx context.Context, name string, config map[string]interface{}) (*RedisConn, error) {
+	return m.clients.Get(ctx, name, config)
+}
 
-	if client, exists := m.clients[name]; exists {
-		return client
-	}
-	// 2、添加连接实例
-	client := m.NewInstance(config)
-	m.clients[name] = client
-	return client
+// 清空 Redis 连接池
+func (m *RedisClientManager) Clear() {
+	m.clients.Clear()
 }
 
 // 创建连接实例
 func (m *RedisClientManager) NewInstance(config map[string]interface{}) (client *RedisConn) {
-	ro := &redis.Options{
-		Addr:            config["addr"].(string) + ":" + cast.ToString(config["port"].(int64)),
-		Password:        config["password"].(string),
-		DB:              int(config["database"].(int64)),
-		PoolSize:        int(config["pool_size"].(int64)),
-		MinIdleConns:    int(config["min_idle_conns"].(int64)),
-		ConnMaxIdleTime: time.Duration(config["conn_max_idle_time"].(int64)) * time.Second,
-		ConnMaxLifetime: time.Duration(config["conn_max_lifetime"].(int64)) * time.Second,
-		MaxRetries:      int(config["max_retries"].(int64)),
-		MinRetryBackoff: time.Duration(config["min_retry_backoff"].(int64)) * time.Millisecond,
+	client, err := m.NewInstanceE(context.Background(), config)
+	if err != nil {
+		fmt.Println("redis connect fail", err)
+		return nil
 	}
-	pool := redis.NewClient(ro)
+	return
+}
 
-	pong, err := pool.Ping(context.Background()).Result()
+// NewInstanceE 创建连接实例并以 ctx 执行 PING，配置有误时返回 ErrInvalidDatasourceConfig，连接失败时返回 ErrConnectFailed
+func (m *RedisClientManager) NewInstanceE(ctx context.Context, config map[string]interface{}) (*RedisConn, error) {
+	ro, err := redisOptions(config)
 	if err != nil {
+		return nil, err
+	}
+	pool := redis.NewClient(ro)
+
+	if err = pool.Ping(ctx).Err(); err != nil {
+		if !isLenientConnect(ctx) {
+			_ = pool.Close()
+			return nil, &DatasourceError{Err: ErrConnectFailed, Cause: err}
+		}
 		fmt.Println("redis connect fail", err)
-		//Log().Error(err)
-		//Log().Info("redis连接失败")
-		//Log().Panic(err)
 	}
-	fmt.Println("redis连接成功:", pong)
-	client = &RedisConn{
+	client := &RedisConn{
 		pool: pool,
 	}
 
@@ -87,5 +96,43 @@ func (m *RedisClientManager) NewInstance(config map[string]interface{}) (client
 	//	client.ShowDebug(true)
 	//}
 
-	return
+	return client, nil
+}
+
+func redisOptions(config map[string]interface{}) (ro *redis.Options, err error) {
+	ro = &redis.Options{}
+	addr, err := dsString(config, "addr", true)
+	if err != nil {
+		return nil, err
+	}
+	port, err := dsInt(config, "port", 6379)
+	if err != nil {
+		return nil, err
+	}
+	ro.Addr = addr + ":" + cast.ToString(port)
+	if ro.Password, err = dsString(config, "password", false); err != nil {
+		return nil, err
+	}
+	if ro.DB, err = dsInt(config, "database", 0); err != nil {
+		return nil, err
+	}
+	if ro.PoolSize, err = dsInt(config, "pool_size", 0); err != nil {
+		return nil, err
+	}
+	if ro.MinIdleConns, err = dsInt(config, "min_idle_conns", 0); err != nil {
+		return nil, err
+	}
+	if ro.ConnMaxIdleTime, err = dsDuration(config, "conn_max_idle_time", time.Second, 0); err != nil {
+		return nil, err
+	}
+	if ro.ConnMaxLifetime, err = dsDuration(config, "conn_max_lifetime", time.Second, 0); err != nil {
+		return nil, err
+	}
+	if ro.MaxRetries, err = dsInt(config, "max_retries", 0); err != nil {
+		return nil, err
+	}
+	if ro.MinRetryBackoff, err = dsDuration(config, "min_retry_backoff", time.Millisecond, 0); err != nil {
+		return nil, err
+	}
+	return ro, nil
 }
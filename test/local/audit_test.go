@@ -0,0 +1,81 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/EricJSanchez/gotool/sys"
+	"gorm.io/gorm"
+)
+
+func init() {
+	addConfig("db", `
+[db-audit]
+driver    = "sqlite"
+database  = "{dir}/audit.db"
+log_level = 1
+[db-audit.audit]
+tables = ["widgets"]
+sink   = "table"
+table  = "audit_log"
+db     = "db-audit-log"
+
+[db-audit-log]
+driver    = "sqlite"
+database  = "{dir}/audit_log.db"
+log_level = 1`)
+}
+
+type widget struct {
+	ID   int64
+	Name string
+}
+
+func TestAuditSurvivesRollback(t *testing.T) {
+	ctx := context.Background()
+	db, err := sys.GormE(ctx, "db-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logDB, err := sys.GormE(ctx, "db-audit-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&widget{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = logDB.Table("audit_log").AutoMigrate(&sys.AuditRecord{}); err != nil {
+		t.Fatal(err)
+	}
+
+	errRollback := errors.New("rollback")
+	// 业务事务在审计数据源上时，审计记录也不写入该事务
+	for _, txName := range []string{"db-audit", "db-audit-log"} {
+		t.Run(txName, func(t *testing.T) {
+			if err := logDB.Table("audit_log").Where("1 = 1").Delete(&sys.AuditRecord{}).Error; err != nil {
+				t.Fatal(err)
+			}
+			err := sys.Tx(ctx, txName, func(tx *gorm.DB) error {
+				widgets, err := sys.GormE(tx.Statement.Context, "db-audit")
+				if err != nil {
+					return err
+				}
+				if err = widgets.Create(&widget{Name: txName}).Error; err != nil {
+					return err
+				}
+				return errRollback
+			})
+			if !errors.Is(err, errRollback) {
+				t.Fatalf("tx err: %v", err)
+			}
+			var records []sys.AuditRecord
+			if err = logDB.Table("audit_log").Find(&records).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 || records[0].Table != "widgets" || records[0].Op != "create" {
+				t.Fatalf("audit records %+v", records)
+			}
+		})
+	}
+}
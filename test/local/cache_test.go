@@ -0,0 +1,173 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EricJSanchez/gotool/sys"
+	"gorm.io/gorm"
+)
+
+var cacheRedis = newFakeRedis()
+
+func init() {
+	addConfig("db", fmt.Sprintf(`
+[redis-fake]
+addr = "127.0.0.1"
+port = %d
+
+[db-cache]
+driver    = "sqlite"
+database  = "{dir}/cache.db"
+log_level = 1
+[db-cache.params]
+_busy_timeout = "10000"
+_journal_mode = "WAL"
+[db-cache.cache]
+redis        = "redis-fake"
+tables       = ["products"]
+lock_timeout = "1s"
+tx_delay     = "50ms"`, cacheRedis.port()))
+}
+
+type product struct {
+	ID    int64
+	Stock int64
+}
+
+// 并发读写：每次写入提交后，之后开始的读取不能再得到旧值，读取到的值也不会倒退
+func TestCacheConcurrentWriteRead(t *testing.T) {
+	ctx := context.Background()
+	db, err := sys.GormE(ctx, "db-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&product{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Create(&product{ID: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 放大写入与提交之间的窗口，提交前失效缓存时读取会以新版本号缓存旧值
+	err = db.Callback().Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").
+		Register("test:slow_commit", func(*gorm.DB) { time.Sleep(5 * time.Millisecond) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Callback().Update().Remove("test:slow_commit")
+
+	read := func() int64 {
+		var p product
+		if err := db.WithContext(ctx).First(&p, 1).Error; err != nil {
+			t.Error(err)
+		}
+		return p.Stock
+	}
+	update := func(i int, tx *gorm.DB) error {
+		return tx.Model(&product{ID: 1}).Update("stock", gorm.Expr("stock + 1")).Error
+	}
+	// 事务中写入后稍等再提交
+	updateTx := func(i int, tx *gorm.DB) error {
+		err := update(i, tx)
+		time.Sleep(5 * time.Millisecond)
+		return err
+	}
+
+	const writes = 60
+	var committed int64 // 已提交的写入次数
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var last int64
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				floor := atomic.LoadInt64(&committed)
+				got := read()
+				if got < floor || got < last {
+					t.Errorf("stale read %d, committed %d, previous read %d", got, floor, last)
+					return
+				}
+				last = got
+			}
+		}()
+	}
+	for i := 0; i < writes; i++ {
+		switch i % 3 {
+		case 0: // gorm 为单条写入开启的事务
+			err = update(i, db.WithContext(ctx))
+		case 1: // sys.Tx，提交后失效
+			err = sys.Tx(ctx, "db-cache", func(tx *gorm.DB) error { return updateTx(i, tx) })
+		case 2: // 自行管理的事务，提交后等待 tx_delay 再次失效
+			err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error { return updateTx(i, tx) })
+			time.Sleep(60 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		atomic.AddInt64(&committed, 1)
+		time.Sleep(2 * time.Millisecond)
+	}
+	close(done)
+	wg.Wait()
+	if got := read(); got != writes {
+		t.Fatalf("final read %d, want %d", got, writes)
+	}
+	if stat := sys.GormCacheStats()["db-cache"]; stat.Hits == 0 || stat.Errors != 0 {
+		t.Fatalf("cache stat %+v", stat)
+	}
+}
+
+// 同一进程内等待同一查询的请求不因执行查询的请求 ctx 超时而失败
+func TestCacheSharedQueryError(t *testing.T) {
+	ctx := context.Background()
+	db, err := sys.GormE(ctx, "db-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&product{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Save(&product{ID: 2, Stock: 7}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 其他进程持有锁，首个请求等待缓存直到 ctx 超时
+	cacheRedis.holdLocks(true)
+	defer cacheRedis.holdLocks(false)
+
+	leaderCtx, cancel := context.WithTimeout(ctx, 150*time.Millisecond)
+	defer cancel()
+	leaderErr := make(chan error, 1)
+	go func() {
+		var p product
+		leaderErr <- db.WithContext(leaderCtx).First(&p, 2).Error
+	}()
+	time.Sleep(30 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var p product
+			if err := db.WithContext(ctx).First(&p, 2).Error; err != nil || p.Stock != 7 {
+				t.Errorf("waiter: stock %d, err %v", p.Stock, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err = <-leaderErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("leader err = %v, want deadline exceeded", err)
+	}
+}
@@ -0,0 +1,188 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EricJSanchez/gotool/sys"
+	"github.com/spf13/cast"
+)
+
+func init() {
+	addConfig("db", `
+[fake-a]
+version = 1`)
+}
+
+// 记录关闭次数的客户端
+type fakeClient struct {
+	name    string
+	version int
+	mu      sync.Mutex
+	closed  int
+}
+
+func (c *fakeClient) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed++
+	if c.name == "bad-close" {
+		return errors.New("close failed")
+	}
+	return nil
+}
+
+func (c *fakeClient) closeCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func fakeClientOptions(grace time.Duration) sys.ClientOptions[*fakeClient] {
+	return sys.ClientOptions[*fakeClient]{
+		Factory: func(ctx context.Context, config map[string]interface{}) (*fakeClient, error) {
+			if config["fail"] != nil {
+				return nil, errors.New("dial failed")
+			}
+			return &fakeClient{name: sys.DatasourceName(ctx), version: cast.ToInt(config["version"])}, nil
+		},
+		HealthCheck: func(_ context.Context, c *fakeClient) error {
+			if c.version < 0 {
+				return errors.New("unhealthy")
+			}
+			return nil
+		},
+		Close:       (*fakeClient).close,
+		GracePeriod: grace,
+	}
+}
+
+func TestClientManagerRetire(t *testing.T) {
+	ctx := context.Background()
+	m := sys.NewClientManager("fake", fakeClientOptions(100*time.Millisecond))
+	get := func(name string, config map[string]interface{}) *fakeClient {
+		t.Helper()
+		c, err := m.Get(ctx, name, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	v1 := get("a", map[string]interface{}{"version": 1})
+	if v1.name != "a" {
+		t.Fatalf("DatasourceName in factory = %q", v1.name)
+	}
+	if get("a", map[string]interface{}{"version": 1}) != v1 {
+		t.Fatal("same config created a new client")
+	}
+	other := get("b", map[string]interface{}{"version": 1})
+
+	// 创建失败时不缓存，也不替换已有的客户端
+	_, err := m.Get(ctx, "a", map[string]interface{}{"fail": true})
+	var de *sys.DatasourceError
+	if !errors.Is(err, sys.ErrConnectFailed) || !errors.As(err, &de) || de.Kind != "fake" || de.Name != "a" {
+		t.Fatalf("factory err: %v", err)
+	}
+	if get("a", map[string]interface{}{"version": 1}) != v1 {
+		t.Fatal("failed factory replaced the client")
+	}
+
+	// 配置变化后创建新客户端，旧客户端在 GracePeriod 之后关闭
+	v2 := get("a", map[string]interface{}{"version": 2})
+	if v2 == v1 {
+		t.Fatal("changed config reused the client")
+	}
+	if !reflect.DeepEqual(m.Names(), []string{"a", "b"}) {
+		t.Fatalf("Names = %v", m.Names())
+	}
+	if v1.closeCount() != 0 {
+		t.Fatal("retired client closed before the grace period")
+	}
+	time.Sleep(300 * time.Millisecond)
+	if v1.closeCount() != 1 || v2.closeCount() != 0 || other.closeCount() != 0 {
+		t.Fatalf("closed v1 %d v2 %d b %d", v1.closeCount(), v2.closeCount(), other.closeCount())
+	}
+
+	// Clear 后的客户端同样延迟关闭，Close 立即关闭全部且不会重复关闭
+	m.Clear()
+	if len(m.Names()) != 0 {
+		t.Fatalf("Names after Clear = %v", m.Names())
+	}
+	v3 := get("a", map[string]interface{}{"version": 3})
+	if err = m.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	for _, c := range []*fakeClient{v1, v2, v3, other} {
+		if c.closeCount() != 1 {
+			t.Fatalf("client %s v%d closed %d times", c.name, c.version, c.closeCount())
+		}
+	}
+
+	// 关闭失败时返回 ErrCloseFailed
+	get("bad-close", nil)
+	if err = m.Close(ctx); !errors.Is(err, sys.ErrCloseFailed) || !errors.As(err, &de) || de.Kind != "fake" {
+		t.Fatalf("Close err: %v", err)
+	}
+}
+
+func TestRegisterDatasource(t *testing.T) {
+	ctx := context.Background()
+	ds := sys.RegisterDatasource("fake", "default_fake", fakeClientOptions(time.Hour))
+	found := false
+	for _, kind := range sys.Datasources() {
+		found = found || kind == "fake"
+	}
+	if !found {
+		t.Fatalf("Datasources = %v", sys.Datasources())
+	}
+
+	// 配置读取方式与 sys.Gorm 相同
+	c, err := ds.Get(ctx, "fake-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.name != "fake-a" || c.version != 1 {
+		t.Fatalf("client %+v", c)
+	}
+	if _, err = ds.Get(ctx); !errors.Is(err, sys.ErrDatasourceNotConfigured) {
+		t.Fatalf("default datasource: %v", err)
+	}
+	if health := sys.DatasourceHealth(ctx)["fake"]; len(health) != 1 || health["fake-a"] != nil {
+		t.Fatalf("health %v", health)
+	}
+	c.version = -1
+	if err = sys.DatasourceHealth(ctx)["fake"]["fake-a"]; !errors.Is(err, sys.ErrConnectFailed) {
+		t.Fatalf("unhealthy: %v", err)
+	}
+
+	// CloseAll 立即关闭所有数据源的客户端，包括尚未到期的旧客户端
+	ds.Manager.Clear()
+	cur, err := ds.Get(ctx, "fake-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sys.GormE(ctx, "db-audit"); err != nil {
+		t.Fatal(err)
+	}
+	if err = sys.CloseAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.closeCount() != 1 || cur.closeCount() != 1 {
+		t.Fatalf("after CloseAll: retired closed %d, current closed %d", c.closeCount(), cur.closeCount())
+	}
+	for kind, names := range sys.DatasourceHealth(ctx) {
+		if len(names) != 0 {
+			t.Fatalf("%s clients left after CloseAll: %v", kind, names)
+		}
+	}
+	// 关闭后再次获取时重新创建
+	if c2, err := ds.Get(ctx, "fake-a"); err != nil || c2 == cur {
+		t.Fatalf("Get after CloseAll = %v, %v", c2, err)
+	}
+}
@@ -0,0 +1,76 @@
+package local
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/EricJSanchez/gotool/sys"
+)
+
+func TestCfgDumpRedaction(t *testing.T) {
+	useTestCfgKey()
+	writeConfig(t, "development/dump.toml", fmt.Sprintf(`
+name = "svc"
+dsn  = %q
+keys = [%q, "visible"]
+[db]
+password = "pw-plain"
+port     = 3306
+[api]
+access_token = "tk-plain"`, encrypt(t, "dsn-plain"), encrypt(t, "key-plain")))
+
+	var b strings.Builder
+	if err := sys.CfgDump("dump", &b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	lines := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		kv := strings.SplitN(line, "  # ", 2)
+		if len(kv) != 2 {
+			t.Fatalf("bad line %q", line)
+		}
+		key, value, _ := strings.Cut(kv[0], " = ")
+		lines[key] = value
+		if !strings.HasPrefix(kv[1], "file ") || !strings.HasSuffix(kv[1], "development/dump.toml") {
+			t.Fatalf("source of %s = %q", key, kv[1])
+		}
+	}
+	cases := []struct {
+		key  string
+		want string
+	}{
+		{key: "name", want: `"svc"`},
+		{key: "db.port", want: "3306"},
+		// 按键名隐藏
+		{key: "db.password", want: `"******"`},
+		{key: "api.access_token", want: `"******"`},
+		// 按来源层中的 ENC 值隐藏
+		{key: "dsn", want: `"******"`},
+		{key: "keys", want: `"******"`},
+	}
+	for _, c := range cases {
+		if got := lines[c.key]; got != c.want {
+			t.Errorf("%s = %s, want %s", c.key, got, c.want)
+		}
+	}
+	for _, plain := range []string{"pw-plain", "tk-plain", "dsn-plain", "key-plain"} {
+		if strings.Contains(out, plain) {
+			t.Errorf("dump leaks %q:\n%s", plain, out)
+		}
+	}
+
+	// CfgExplain 同样不输出明文
+	for _, key := range []string{"dsn", "db.password", "db", "api"} {
+		e, err := sys.CfgExplain("dump", key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, plain := range []string{"pw-plain", "tk-plain", "dsn-plain"} {
+			if s := e.String(); strings.Contains(s, plain) {
+				t.Errorf("explain %s leaks %q:\n%s", key, plain, s)
+			}
+		}
+	}
+}
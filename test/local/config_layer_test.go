@@ -0,0 +1,60 @@
+package local
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/EricJSanchez/gotool/sys"
+)
+
+func TestCfgLayers(t *testing.T) {
+	writeConfig(t, "common/layers.toml", `
+name        = "common"
+only_common = 1
+[db]
+host = "common-host"
+port = 3306
+user = "root"`)
+	writeConfig(t, "development/layers.toml", `
+name = "env"
+[db]
+host = "env-host"`)
+	writeConfig(t, "development/layers.local.toml", `
+[db]
+host = "local-host"`)
+	sys.SetCfgDefault("layers", "db.timeout", "3s")
+	sys.SetCfgDefault("layers", "name", "default")
+
+	vp := sys.Cfg("layers")
+	if vp == nil {
+		t.Fatal("layers not loaded")
+	}
+	cases := []struct {
+		key    string
+		want   interface{}
+		kind   string // 生效的层
+		source string // 生效层来源的后缀
+	}{
+		{key: "db.timeout", want: "3s", kind: "default", source: "sys.SetCfgDefault"},
+		{key: "only_common", want: int64(1), kind: "file", source: "common/layers.toml"},
+		// 表按键逐级合并
+		{key: "db.port", want: int64(3306), kind: "file", source: "common/layers.toml"},
+		{key: "name", want: "env", kind: "file", source: "development/layers.toml"},
+		{key: "db.host", want: "local-host", kind: "file", source: "development/layers.local.toml"},
+	}
+	for _, c := range cases {
+		t.Run(c.key, func(t *testing.T) {
+			if got := vp.Get(c.key); !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("Get = %#v, want %#v", got, c.want)
+			}
+			e, err := sys.CfgExplain("layers", c.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Winner == nil || e.Winner.Kind != c.kind || !strings.HasSuffix(e.Winner.Source, c.source) {
+				t.Fatalf("winner %+v, want %s %s\n%s", e.Winner, c.kind, c.source, e)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/EricJSanchez/gotool/sys"
+)
+
+// 仓库自带的配置文件
+const shippedConfigs = "../../configs"
+
+func lintShipped(t *testing.T, path string) []sys.CfgLintIssue {
+	t.Helper()
+	sys.InitConfig(path)
+	issues, err := sys.LintCfg(sys.CfgLintOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 其他测试登记的结构与自带配置无关
+	var ret []sys.CfgLintIssue
+	for _, issue := range issues {
+		if issue.File == "app" || issue.File == "db" {
+			ret = append(ret, issue)
+		}
+	}
+	return ret
+}
+
+func TestCfgLintShipped(t *testing.T) {
+	defer sys.InitConfig(dataDir)
+	if issues := lintShipped(t, shippedConfigs); len(issues) != 0 {
+		t.Fatalf("shipped configs: %v", issues)
+	}
+
+	// 与 development 类型不同的配置项会被报告
+	dir := t.TempDir()
+	err := filepath.Walk(shippedConfigs, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(shippedConfigs, path)
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if rel == filepath.Join("production", "app.toml") {
+			b = []byte(strings.Replace(string(b), "8848", `"8848"`, 1))
+		}
+		if err = os.MkdirAll(filepath.Join(dir, filepath.Dir(rel)), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, rel), b, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := lintShipped(t, dir)
+	if len(issues) != 1 || issues[0].File != "app" || issues[0].Key != "nacos.port" || issues[0].Rule != "type" ||
+		!strings.Contains(issues[0].Msg, "inconsistent across environments") {
+		t.Fatalf("issues %v", issues)
+	}
+}
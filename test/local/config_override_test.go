@@ -0,0 +1,74 @@
+package local
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/EricJSanchez/gotool/sys"
+)
+
+func TestCfgOverrides(t *testing.T) {
+	writeConfig(t, "development/override.toml", `
+port  = 8080
+debug = false
+ratio = 0.5
+name  = "svc"
+hosts = ["a"]
+[db-scrm]
+max-open = 10`)
+	for k, v := range map[string]string{
+		"GOTOOL_OVERRIDE__PORT":               "9090",
+		"GOTOOL_OVERRIDE__DEBUG":              "true",
+		"GOTOOL_OVERRIDE__NAME":               "123",
+		"GOTOOL_OVERRIDE__DB_SCRM__MAX_OPEN":  "20",
+		"GOTOOL_OVERRIDE__NEW_FLAG":           "true",
+		"GOTOOL_OVERRIDE__RATIO":              "not-a-number",
+		"GOTOOL_OTHER__PORT":                  "1",
+		"gotool_override__lower_case_ignored": "1",
+	} {
+		t.Setenv(k, v)
+	}
+	rest, err := sys.ParseCfgArgs([]string{"-v", "--set", "override.port=7070", "-set=override.hosts=[b, c]", "run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rest, []string{"-v", "run"}) {
+		t.Fatalf("rest args %v", rest)
+	}
+	if _, err = sys.ParseCfgArgs([]string{"--set", "override"}); err == nil {
+		t.Fatal("--set without value accepted")
+	}
+	sys.ResetCfgKey("override")
+
+	vp := sys.Cfg("override")
+	cases := []struct {
+		key  string
+		want interface{}
+		kind string
+	}{
+		// --set 优先于环境变量
+		{key: "port", want: int64(7070), kind: "flag"},
+		{key: "debug", want: true, kind: "env"},
+		// 按已有值的类型转换
+		{key: "name", want: "123", kind: "env"},
+		{key: "db-scrm.max-open", want: int64(20), kind: "env"},
+		{key: "new_flag", want: true, kind: "env"},
+		{key: "hosts", want: []interface{}{"b", "c"}, kind: "flag"},
+		// 无法转换时保留原始字符串
+		{key: "ratio", want: "not-a-number", kind: "env"},
+	}
+	for _, c := range cases {
+		t.Run(c.key, func(t *testing.T) {
+			if got := vp.Get(c.key); !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("Get = %#v (%T), want %#v (%T)", got, got, c.want, c.want)
+			}
+			e, err := sys.CfgExplain("override", c.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Winner == nil || e.Winner.Kind != c.kind {
+				t.Fatalf("winner %+v, want %s\n%s", e.Winner, c.kind, e)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package local
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/EricJSanchez/gotool/sys"
+)
+
+var testCfgKey = []byte("gotool-test-key")
+
+func useTestCfgKey() {
+	sys.SetCfgKeyProvider(sys.SecretKeyFunc(func() ([]byte, error) { return testCfgKey, nil }))
+}
+
+func encrypt(t *testing.T, plain string) string {
+	t.Helper()
+	enc, err := sys.EncryptCfgValueWithKey(testCfgKey, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc
+}
+
+func TestCfgSecretMerge(t *testing.T) {
+	useTestCfgKey()
+	password, token := encrypt(t, "s3cret"), encrypt(t, "t0ken")
+	writeConfig(t, "common/secret.toml", `
+[db]
+user = "root"`)
+	writeConfig(t, "development/secret.toml", fmt.Sprintf(`
+[db]
+tokens = [%q, "plain"]
+[db.auth]
+password = %q`, token, password))
+
+	// db.auth 只在一层中出现，合并时不能直接引用该层的表
+	cases := []struct {
+		key  string
+		want interface{}
+		raw  interface{} // 层中保留的原值
+	}{
+		{key: "db.user", want: "root", raw: "root"},
+		{key: "db.auth.password", want: "s3cret", raw: password},
+		{key: "db.tokens", want: []interface{}{"t0ken", "plain"}, raw: []interface{}{token, "plain"}},
+	}
+	// 第二轮在重新合并后检查，解密结果不能写回各层
+	for _, round := range []string{"load", "reload"} {
+		sys.ResetCfgKey("secret")
+		vp := sys.Cfg("secret")
+		for _, c := range cases {
+			t.Run(round+"/"+c.key, func(t *testing.T) {
+				if got := vp.Get(c.key); !reflect.DeepEqual(got, c.want) {
+					t.Fatalf("Get = %#v, want %#v", got, c.want)
+				}
+				e, err := sys.CfgExplain("secret", c.key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if e.Winner == nil || !reflect.DeepEqual(e.Winner.Value, c.raw) {
+					t.Fatalf("layer value %+v, want %#v", e.Winner, c.raw)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package local
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EricJSanchez/gotool/sys"
+)
+
+// 配置中心不可用
+type downProvider struct{}
+
+func (downProvider) Fetch(sys.ConfigItem) (string, error) {
+	return "", errors.New("provider down")
+}
+
+func (downProvider) Watch(sys.ConfigItem, func(string)) error {
+	return nil
+}
+
+func (downProvider) Close() error {
+	return nil
+}
+
+func TestCfgSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	sys.SetCfgSnapshotDir(dir)
+	defer sys.SetCfgSnapshotDir("")
+	items := []sys.ConfigItem{{DataId: "snap.yaml", Group: "SNAP"}}
+	file := filepath.Join(dir, "SNAP", "snap.yaml.json")
+	status := func() sys.RemoteConfigStatus {
+		for _, s := range sys.CfgHealth() {
+			if s.DataId == "snap.yaml" {
+				return s
+			}
+		}
+		t.Fatal("snap.yaml not in CfgHealth")
+		return sys.RemoteConfigStatus{}
+	}
+	readSnapshot := func() map[string]interface{} {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var snap map[string]interface{}
+		if err = json.Unmarshal(b, &snap); err != nil {
+			t.Fatal(err)
+		}
+		return snap
+	}
+
+	// 获取成功时写入快照
+	p := &memProvider{data: map[string]string{"snap.yaml": "a: 1"}, onChange: make(map[string]func(string))}
+	if err := sys.LoadRemoteConfig(p, items); err != nil {
+		t.Fatal(err)
+	}
+	defer sys.CloseRemoteConfig()
+	if s := status(); s.Stale || s.Error != "" || sys.CfgStale() {
+		t.Fatalf("fresh status %+v", s)
+	}
+	p.push("snap.yaml", "a: 2")
+	snap := readSnapshot()
+	if snap["content"] != "a: 2" || snap["format"] != "yaml" || snap["md5"] != sys.Md5("a: 2") {
+		t.Fatalf("snapshot %v", snap)
+	}
+
+	// 配置中心不可用时使用快照并标记为过期
+	sys.SetNacosConfig("snap.yaml", "SNAP", "a: 0")
+	if err := sys.LoadRemoteConfig(downProvider{}, items); err != nil {
+		t.Fatal(err)
+	}
+	if got := sys.Nacos("snap.yaml").GetInt("a"); got != 2 {
+		t.Fatalf("a from snapshot = %d", got)
+	}
+	s := status()
+	if !s.Stale || !sys.CfgStale() || !strings.Contains(s.Error, "provider down") {
+		t.Fatalf("stale status %+v", s)
+	}
+	fetched, err := time.Parse(time.RFC3339Nano, snap["fetched_at"].(string))
+	if err != nil || !s.FetchedAt.Equal(fetched) {
+		t.Fatalf("FetchedAt %v, snapshot %v %v", s.FetchedAt, fetched, err)
+	}
+
+	// 快照被篡改或不存在时启动失败
+	snap["content"] = "a: 3"
+	b, _ := json.Marshal(snap)
+	if err := os.WriteFile(file, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := sys.LoadRemoteConfig(downProvider{}, items); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("tampered snapshot: %v", err)
+	}
+	missing := []sys.ConfigItem{{DataId: "missing.toml", Group: "SNAP"}}
+	if err := sys.LoadRemoteConfig(downProvider{}, missing); err == nil || !strings.Contains(err.Error(), "provider down") {
+		t.Fatalf("missing snapshot: %v", err)
+	}
+
+	// 恢复后不再标记为过期
+	if err := sys.LoadRemoteConfig(p, items); err != nil {
+		t.Fatal(err)
+	}
+	if s := status(); s.Stale || sys.CfgStale() {
+		t.Fatalf("recovered status %+v", s)
+	}
+	if snap := readSnapshot(); snap["content"] != "a: 2" {
+		t.Fatalf("snapshot after recovery %v", snap)
+	}
+}
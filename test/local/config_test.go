@@ -0,0 +1,81 @@
+package local
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/EricJSanchez/gotool/sys"
+)
+
+type bindTags []string
+
+type bindCfg struct {
+	Addr    string        `validate:"required,hostport"`
+	Mode    string        `validate:"oneof=debug release"`
+	Level   string        `default:"info" validate:"oneof=debug info"`
+	Workers int           `validate:"min=1,max=64"`
+	Retry   int           `validate:"min=1"`
+	Tags    bindTags      `default:"a,b"`
+	Timeout time.Duration `default:"3s"`
+}
+
+func init() {
+	addConfig("bind_ok", `
+addr    = "127.0.0.1:8848"
+mode    = "release"
+workers = 8
+retry   = 3
+tags    = ["x"]`)
+	addConfig("bind_absent", `addr = "localhost:80"`)
+	addConfig("bind_bad", `
+mode    = "test"
+level   = "trace"
+workers = 0
+retry   = 0`)
+	addConfig("bind_type", `
+addr    = "localhost:80"
+workers = "many"`)
+}
+
+func TestCfgAs(t *testing.T) {
+	cases := []struct {
+		file  string
+		fails []string // 未通过的 key/rule
+		want  bindCfg
+	}{
+		{file: "bind_ok", want: bindCfg{Addr: "127.0.0.1:8848", Mode: "release", Level: "info", Workers: 8, Retry: 3, Tags: bindTags{"x"}, Timeout: 3 * time.Second}},
+		// 未配置的可选项不触发 oneof、min
+		{file: "bind_absent", want: bindCfg{Addr: "localhost:80", Level: "info", Tags: bindTags{"a", "b"}, Timeout: 3 * time.Second}},
+		{file: "bind_bad", fails: []string{"addr/required", "level/oneof", "mode/oneof", "retry/min", "workers/min"}},
+		{file: "bind_type", fails: []string{"workers/type"}},
+	}
+	for _, c := range cases {
+		t.Run(c.file, func(t *testing.T) {
+			got, err := sys.CfgAs[bindCfg](c.file)
+			var cfgErr *sys.CfgError
+			if len(c.fails) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(got, c.want) {
+					t.Fatalf("got %+v, want %+v", got, c.want)
+				}
+				return
+			}
+			if !errors.As(err, &cfgErr) {
+				t.Fatalf("expected *sys.CfgError, got %v", err)
+			}
+			var fails []string
+			for _, f := range cfgErr.Fields {
+				fails = append(fails, f.Key+"/"+f.Rule)
+			}
+			sort.Strings(fails)
+			if !reflect.DeepEqual(fails, c.fails) {
+				t.Fatalf("got failures %v, want %v", fails, c.fails)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package local
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/EricJSanchez/gotool/sys"
+	"github.com/spf13/viper"
+)
+
+func TestCfgWatch(t *testing.T) {
+	writeConfig(t, "development/watch.toml", "n = 1")
+	if got := sys.Cfg("watch").GetInt("n"); got != 1 {
+		t.Fatalf("n = %d", got)
+	}
+	type change struct{ old, new int }
+	changes := make(chan change, 10)
+	sys.OnCfgChange("watch", func(old, new *viper.Viper) {
+		changes <- change{old.GetInt("n"), new.GetInt("n")}
+	})
+	// 回调 panic 不影响其他订阅者
+	sys.OnCfgChange("watch", func(_, _ *viper.Viper) { panic("subscriber") })
+
+	expect := func(want change) {
+		t.Helper()
+		select {
+		case got := <-changes:
+			if got != want {
+				t.Fatalf("change %+v, want %+v", got, want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("no change, want %+v", want)
+		}
+		// 同一批写入只回调一次
+		select {
+		case got := <-changes:
+			t.Fatalf("extra change %+v", got)
+		case <-time.After(400 * time.Millisecond):
+		}
+	}
+
+	// 连续多次保存合并为一次重新加载
+	for i := 2; i <= 4; i++ {
+		writeConfig(t, "development/watch.toml", fmt.Sprintf("n = %d", i))
+		time.Sleep(20 * time.Millisecond)
+	}
+	expect(change{1, 4})
+	if got := sys.Cfg("watch").GetInt("n"); got != 4 {
+		t.Fatalf("n after reload = %d", got)
+	}
+
+	// .local 文件的修改重新加载同名配置
+	writeConfig(t, "development/watch.local.toml", "n = 5")
+	expect(change{4, 5})
+
+	// 无法解析时保留旧配置且不回调
+	writeConfig(t, "development/watch.local.toml", "n = ")
+	select {
+	case got := <-changes:
+		t.Fatalf("change on broken file %+v", got)
+	case <-time.After(600 * time.Millisecond):
+	}
+	if got := sys.Cfg("watch").GetInt("n"); got != 5 {
+		t.Fatalf("n after broken write = %d", got)
+	}
+}
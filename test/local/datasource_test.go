@@ -0,0 +1,114 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/EricJSanchez/gotool/sys"
+)
+
+func init() {
+	// 127.0.0.1:1 没有服务监听，连接被拒绝
+	addConfig("db", `
+[db-bad-driver]
+driver = "nope"
+
+[db-bad-pool]
+driver   = "sqlite"
+database = "{dir}/bad.db"
+max_conn = "many"
+
+[db-no-database]
+driver = "sqlite"
+
+[redis-bad-port]
+addr = "127.0.0.1"
+port = "abc"
+
+[redis-no-addr]
+port = 6379
+
+[redis-down]
+addr = "127.0.0.1"
+port = 1
+
+[es-no-addresses]
+username = "elastic"
+
+[es-down]
+addresses = "http://127.0.0.1:1, http://127.0.0.1:1"`)
+}
+
+func TestDatasourceErrors(t *testing.T) {
+	ctx := context.Background()
+	gormE := func(names ...string) error {
+		_, err := sys.GormE(ctx, names...)
+		return err
+	}
+	redisE := func(names ...string) error {
+		_, err := sys.RedisE(ctx, names...)
+		return err
+	}
+	elasticE := func(names ...string) error {
+		_, err := sys.ElasticE(ctx, names...)
+		return err
+	}
+	cases := []struct {
+		kind  string
+		get   func(names ...string) error
+		names []string
+		want  error
+		name  string // DatasourceError.Name
+		key   string // DatasourceError.Key
+	}{
+		// 未指定名称且 app.toml 没有默认数据源
+		{kind: "gorm", get: gormE, want: sys.ErrDatasourceNotConfigured, key: "default_db"},
+		{kind: "redis", get: redisE, want: sys.ErrDatasourceNotConfigured, key: "default_redis"},
+		{kind: "elastic", get: elasticE, want: sys.ErrDatasourceNotConfigured, key: "default_es"},
+		{kind: "gorm", get: gormE, names: []string{"db-missing"}, want: sys.ErrDatasourceNotConfigured, name: "db-missing"},
+		{kind: "redis", get: redisE, names: []string{"redis-missing"}, want: sys.ErrDatasourceNotConfigured, name: "redis-missing"},
+		{kind: "elastic", get: elasticE, names: []string{"es-missing"}, want: sys.ErrDatasourceNotConfigured, name: "es-missing"},
+
+		{kind: "gorm", get: gormE, names: []string{"db-bad-driver"}, want: sys.ErrInvalidDatasourceConfig, name: "db-bad-driver", key: "driver"},
+		{kind: "gorm", get: gormE, names: []string{"db-bad-pool"}, want: sys.ErrInvalidDatasourceConfig, name: "db-bad-pool", key: "max_conn"},
+		{kind: "gorm", get: gormE, names: []string{"db-no-database"}, want: sys.ErrInvalidDatasourceConfig, name: "db-no-database", key: "database"},
+		{kind: "redis", get: redisE, names: []string{"redis-bad-port"}, want: sys.ErrInvalidDatasourceConfig, name: "redis-bad-port", key: "port"},
+		{kind: "redis", get: redisE, names: []string{"redis-no-addr"}, want: sys.ErrInvalidDatasourceConfig, name: "redis-no-addr", key: "addr"},
+		{kind: "elastic", get: elasticE, names: []string{"es-no-addresses"}, want: sys.ErrInvalidDatasourceConfig, name: "es-no-addresses", key: "addresses"},
+
+		{kind: "redis", get: redisE, names: []string{"redis-down"}, want: sys.ErrConnectFailed, name: "redis-down"},
+		{kind: "elastic", get: elasticE, names: []string{"es-down"}, want: sys.ErrConnectFailed, name: "es-down"},
+	}
+	sentinels := []error{sys.ErrDatasourceNotConfigured, sys.ErrInvalidDatasourceConfig, sys.ErrConnectFailed, sys.ErrCloseFailed}
+	for _, c := range cases {
+		t.Run(c.kind+"/"+c.key+c.name, func(t *testing.T) {
+			err := c.get(c.names...)
+			for _, s := range sentinels {
+				if got := errors.Is(err, s); got != (s == c.want) {
+					t.Fatalf("errors.Is(%v, %v) = %v", err, s, got)
+				}
+			}
+			var de *sys.DatasourceError
+			if !errors.As(err, &de) {
+				t.Fatalf("%T is not a *DatasourceError", err)
+			}
+			if de.Kind != c.kind || de.Name != c.name || de.Key != c.key {
+				t.Fatalf("DatasourceError %+v, want kind %q name %q key %q", de, c.kind, c.name, c.key)
+			}
+			// 配置有误与连接失败时保留原始错误
+			if c.want != sys.ErrDatasourceNotConfigured && errors.Unwrap(err) == nil {
+				t.Fatalf("%v has no cause", err)
+			}
+		})
+	}
+
+	// 兼容的访问方法出错时返回 nil
+	if sys.Gorm("db-missing") != nil || sys.Elastic("es-no-addresses") != nil || sys.Redis("redis-bad-port") != nil {
+		t.Fatal("accessor returned a client on error")
+	}
+	// Redis 与以往一致，PING 失败时仍返回连接
+	if sys.Redis("redis-down") == nil {
+		t.Fatal("Redis returned nil when only PING failed")
+	}
+}
@@ -0,0 +1,31 @@
+package local
+
+import (
+	"testing"
+
+	"github.com/EricJSanchez/gotool/sys"
+)
+
+func TestSQLFingerprint(t *testing.T) {
+	cases := []struct {
+		sql, want string
+	}{
+		{"SELECT * FROM user WHERE id IN (1, 2, 3) AND name = 'a'", "SELECT * FROM user WHERE id IN (?+) AND name = ?"},
+		{"SELECT  *\n FROM user\tWHERE id = 10", "SELECT * FROM user WHERE id = ?"},
+		{"SELECT * FROM t WHERE a = 'it''s' AND b = 'x\\'y'", "SELECT * FROM t WHERE a = ? AND b = ?"},
+		{"SELECT price * 1.5 FROM t1 WHERE c2 = -3", "SELECT price * ? FROM t1 WHERE c2 = -?"},
+		{"INSERT INTO t (a,b) VALUES (?,?),(?,?),(?,?)", "INSERT INTO t (a,b) VALUES (?+)"},
+		{"INSERT INTO t (a) VALUES (1),(2)", "INSERT INTO t (a) VALUES (?)"},
+		// Postgres、SQLite 的双引号与 MySQL 的反引号为标识符
+		{`SELECT "users"."name" FROM "users" WHERE "users"."id" = $1`, `SELECT "users"."name" FROM "users" WHERE "users"."id" = $1`},
+		{`SELECT * FROM "orders" WHERE "2fa" = 1`, `SELECT * FROM "orders" WHERE "2fa" = ?`},
+		{"SELECT * FROM `order` WHERE `1st` = 'x'", "SELECT * FROM `order` WHERE `1st` = ?"},
+		{`SELECT "a" FROM t WHERE x = 'b'`, `SELECT "a" FROM t WHERE x = ?`},
+		{`SELECT * FROM "unterminated`, `SELECT * FROM "unterminated`},
+	}
+	for _, c := range cases {
+		if got := sys.SQLFingerprint(c.sql); got != c.want {
+			t.Errorf("SQLFingerprint(%q)\n got  %q\n want %q", c.sql, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package local
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EricJSanchez/gotool/sys"
+	"gorm.io/gorm/logger"
+)
+
+func init() {
+	addConfig("app", `
+[remote]
+defaultDataId = "common.toml"
+snapshot_dir  = "{dir}/snapshot"`)
+	addConfig("db", `
+[db-lvl-local]
+driver    = "sqlite"
+database  = "{dir}/lvl.db"
+log_level = "error"
+
+[db-lvl-default]
+driver    = "sqlite"
+database  = "{dir}/lvl.db"
+
+[db-lvl-named]
+driver    = "sqlite"
+database  = "{dir}/lvl.db"
+log_level = "error"`)
+}
+
+// 内存中的配置中心，push 模拟配置推送
+type memProvider struct {
+	data     map[string]string
+	onChange map[string]func(string)
+}
+
+func (p *memProvider) Fetch(item sys.ConfigItem) (string, error) {
+	return p.data[item.DataId], nil
+}
+
+func (p *memProvider) Watch(item sys.ConfigItem, onChange func(data string)) error {
+	p.onChange[item.DataId] = onChange
+	return nil
+}
+
+func (p *memProvider) Close() error {
+	return nil
+}
+
+func (p *memProvider) push(dataId, data string) {
+	p.data[dataId] = data
+	p.onChange[dataId](data)
+}
+
+func TestGormLogLevel(t *testing.T) {
+	names := []string{"db-lvl-local", "db-lvl-default", "db-lvl-named"}
+	check := func(stage string, want ...logger.LogLevel) {
+		t.Helper()
+		levels := sys.GormLogLevels()
+		for i, name := range names {
+			if levels[name] != want[i] {
+				t.Errorf("%s: %s level %d, want %d", stage, name, levels[name], want[i])
+			}
+		}
+	}
+	// 数据源先于远程配置创建
+	for _, name := range names {
+		if _, err := sys.GormE(context.Background(), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("before remote", logger.Error, logger.Info, logger.Error)
+
+	p := &memProvider{
+		data: map[string]string{"common.toml": `
+MysqlDebugLevel = "warn"
+[MysqlDebugLevels]
+db-lvl-named = "info"`},
+		onChange: make(map[string]func(string)),
+	}
+	if err := sys.LoadRemoteConfig(p, []sys.ConfigItem{{DataId: "common.toml", Group: "DEFAULT_GROUP"}}); err != nil {
+		t.Fatal(err)
+	}
+	defer sys.CloseRemoteConfig()
+	// MysqlDebugLevels > log_level > MysqlDebugLevel > DebugLevel
+	check("remote loaded", logger.Error, logger.Warn, logger.Info)
+
+	p.push("common.toml", `MysqlDebugLevel = "silent"`)
+	check("remote pushed", logger.Error, logger.Silent, logger.Error)
+
+	h := sys.GormLogLevelHandler(sys.BearerTokenAuth("secret"))
+	for _, c := range []struct {
+		auth string
+		code int
+	}{
+		{"", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Basic secret", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/?datasource=db-lvl-local&level=info", nil)
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != c.code {
+			t.Errorf("Authorization %q: status %d, want %d", c.auth, w.Code, c.code)
+		}
+	}
+	check("handler", logger.Info, logger.Silent, logger.Error)
+
+	w := httptest.NewRecorder()
+	sys.GormLogLevelHandler(nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("nil authorize: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,63 @@
+// Package local 不依赖外部服务的测试：配置写入临时目录，数据库使用 sqlite，需 cgo（CGO_ENABLED=1）
+package local
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/EricJSanchez/gotool/environment"
+	"github.com/EricJSanchez/gotool/sys"
+)
+
+// 各测试文件在 init 中登记的配置文件内容，{dir} 替换为临时目录
+var configFiles = map[string]string{}
+
+func addConfig(file, content string) {
+	configFiles[file] += content + "\n"
+}
+
+var dataDir string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "gotool-test")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	dataDir = dir
+	envDir := filepath.Join(dir, string(environment.Development))
+	if err = os.MkdirAll(envDir, 0755); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for name, content := range configFiles {
+		content = strings.ReplaceAll(content, "{dir}", dir)
+		if err = os.WriteFile(filepath.Join(envDir, name+".toml"), []byte(content), 0644); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	_ = sys.InitEnv(environment.Development)
+	sys.InitConfig(dir)
+
+	code := m.Run()
+	_ = sys.CloseAll(context.Background())
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// 在测试中写入配置文件，path 相对于配置根目录，如 common/app.toml
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	file := filepath.Join(dataDir, path)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,115 @@
+package local
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/EricJSanchez/gotool/sys"
+	"gorm.io/gorm"
+)
+
+func init() {
+	addConfig("db", `
+[db-mig]
+driver    = "sqlite"
+database  = "{dir}/mig.db"
+log_level = 1`)
+	sys.RegisterMigration("db-mig", sys.Migration{
+		Version: 3,
+		Name:    "seed_tags",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("INSERT INTO tags (name) VALUES ('go'), ('sql')").Error
+		},
+	})
+}
+
+func writeMigrations(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	path := filepath.Join(dir, "db-mig")
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(path, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func pendingMigrations(t *testing.T, dir string) (pending []string) {
+	t.Helper()
+	states, err := sys.MigrationStatus(context.Background(), "db-mig", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range states {
+		if !s.Applied {
+			pending = append(pending, s.Name)
+		}
+	}
+	return
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(dataDir, "migrations")
+	writeMigrations(t, dir, map[string]string{
+		"1_create_tags.up.sql":   "CREATE TABLE tags (id INTEGER PRIMARY KEY, name TEXT); -- 注释中的 ; 不拆分\nCREATE INDEX idx_tags_name ON tags (name);",
+		"1_create_tags.down.sql": "DROP TABLE tags;",
+		"2_add_color.up.sql":     "ALTER TABLE tags ADD COLUMN color TEXT DEFAULT 'red;blue';",
+		"2_add_color.down.sql":   "ALTER TABLE tags DROP COLUMN color;",
+	})
+	db, err := sys.GormE(ctx, "db-mig")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// dry-run 不执行
+	var out strings.Builder
+	if err = sys.Migrate(ctx, "db-mig", sys.MigrateOptions{Dir: dir, DryRun: true, Out: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "CREATE INDEX idx_tags_name ON tags (name);") || db.Migrator().HasTable("tags") {
+		t.Fatalf("dry run output:\n%s", out.String())
+	}
+
+	if err = sys.Migrate(ctx, "db-mig", sys.MigrateOptions{Dir: dir, Steps: 2, Out: io.Discard}); err != nil {
+		t.Fatal(err)
+	}
+	if got := pendingMigrations(t, dir); len(got) != 1 || got[0] != "seed_tags" {
+		t.Fatalf("pending after 2 steps: %v", got)
+	}
+	if err = sys.Migrate(ctx, "db-mig", sys.MigrateOptions{Dir: dir, Out: io.Discard}); err != nil {
+		t.Fatal(err)
+	}
+	var color string
+	if err = db.Raw("SELECT color FROM tags WHERE name = ?", "go").Row().Scan(&color); err != nil || color != "red;blue" {
+		t.Fatalf("color = %q, err %v", color, err)
+	}
+
+	// Go 迁移没有 Down，不能回滚
+	if err = sys.Migrate(ctx, "db-mig", sys.MigrateOptions{Dir: dir, Down: true, Out: io.Discard}); err == nil {
+		t.Fatal("rolled back a migration without down")
+	}
+
+	// 失败的迁移整体回滚且不记录（sqlite 的 DDL 可在事务中回滚）
+	writeMigrations(t, dir, map[string]string{
+		"4_broken.up.sql": "CREATE TABLE notes (id INTEGER PRIMARY KEY);\nINSERT INTO missing VALUES (1);",
+	})
+	if err = sys.Migrate(ctx, "db-mig", sys.MigrateOptions{Dir: dir, Out: io.Discard}); err == nil {
+		t.Fatal("broken migration succeeded")
+	}
+	if db.Migrator().HasTable("notes") {
+		t.Fatal("broken migration was partly applied")
+	}
+	if got := pendingMigrations(t, dir); len(got) != 1 || got[0] != "broken" {
+		t.Fatalf("pending after failure: %v", got)
+	}
+	if err = os.Remove(filepath.Join(dir, "db-mig", "4_broken.up.sql")); err != nil {
+		t.Fatal(err)
+	}
+}
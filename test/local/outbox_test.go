@@ -0,0 +1,183 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EricJSanchez/gotool/sys"
+	"gorm.io/gorm"
+)
+
+func init() {
+	addConfig("db", `
+[db-outbox]
+driver    = "sqlite"
+database  = "{dir}/outbox.db"
+log_level = 1
+[db-outbox.outbox]
+sink      = "test"
+retention = "-1s"`)
+	sys.RegisterMigration("db-outbox", sys.OutboxMigration(1))
+	sys.RegisterOutboxSink("test", func(map[string]interface{}) (sys.OutboxSink, error) {
+		return testSink, nil
+	})
+}
+
+var testSink = &recordSink{fail: make(map[string]bool)}
+
+// 记录投递的消息，fail 中的 payload 投递失败
+type recordSink struct {
+	mu   sync.Mutex
+	sent []sys.OutboxMessage
+	fail map[string]bool
+}
+
+func (s *recordSink) Send(_ context.Context, msg sys.OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail[payloadString(msg)] {
+		return errors.New("sink down")
+	}
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+func (s *recordSink) setFail(payload string, fail bool) {
+	s.mu.Lock()
+	s.fail[payload] = fail
+	s.mu.Unlock()
+}
+
+// 按聚合键分组的已投递 payload
+func (s *recordSink) byKey() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make(map[string][]string)
+	for _, msg := range s.sent {
+		keys[msg.Key] = append(keys[msg.Key], payloadString(msg))
+	}
+	return keys
+}
+
+func payloadString(msg sys.OutboxMessage) string {
+	var s string
+	_ = json.Unmarshal(msg.Payload, &s)
+	return s
+}
+
+func TestOutboxRelay(t *testing.T) {
+	ctx := context.Background()
+	db, err := sys.GormE(ctx, "db-outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 未迁移时不自动建表
+	if _, err = sys.StartOutboxRelay(ctx, "db-outbox"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("start before migrate: %v", err)
+	}
+	if err = sys.Migrate(ctx, "db-outbox", sys.MigrateOptions{Dir: filepath.Join(dataDir, "outbox-migrations"), Out: io.Discard}); err != nil {
+		t.Fatal(err)
+	}
+
+	publish := func(ctx context.Context, key, payload string) {
+		t.Helper()
+		if err := sys.PublishOutbox(ctx, "db-outbox", "test.event", key, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 没有聚合键的事件不接受
+	if err = sys.PublishOutbox(ctx, "db-outbox", "test.event", "", "none"); err == nil || !strings.Contains(err.Error(), "empty key") {
+		t.Fatalf("empty key: err = %v", err)
+	}
+	publish(ctx, "a", "a1")
+	publish(ctx, "b", "b1")
+	err = sys.Tx(ctx, "db-outbox", func(tx *gorm.DB) error {
+		publish(tx.Statement.Context, "a", "a2")
+		return sys.PublishOutboxTx(tx, "test.event", "b", "b2")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 回滚的事件不投递，也不占用序号
+	errRollback := errors.New("rollback")
+	err = sys.Tx(ctx, "db-outbox", func(tx *gorm.DB) error {
+		publish(tx.Statement.Context, "a", "rolled-back")
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("tx err: %v", err)
+	}
+	publish(ctx, "a", "a3")
+	// 序号小的事件 ID 反而更大时仍按序号投递
+	for _, ev := range []sys.OutboxEvent{{Seq: 2, Payload: `"c2"`}, {Seq: 1, Payload: `"c1"`}} {
+		ev.Topic, ev.AggregateKey, ev.NextAt = "test.event", "c", time.Now()
+		if err = db.Create(&ev).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var seqs []int64
+	if err = db.Model(&sys.OutboxEvent{}).Where("aggregate_key = ?", "a").Order("id").Pluck("seq", &seqs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(seqs, []int64{1, 2, 3}) {
+		t.Fatalf("seq of a = %v", seqs)
+	}
+
+	testSink.setFail("b1", true)
+	relay := sys.NewOutboxRelay("db-outbox", testSink, sys.OutboxOptions{MaxAttempts: 2, Backoff: 300 * time.Millisecond, Retention: -1})
+	runOnce := func(want int) {
+		t.Helper()
+		n, err := relay.RunOnce(ctx)
+		if err != nil || n != want {
+			t.Fatalf("RunOnce = %d, %v, want %d", n, err, want)
+		}
+	}
+
+	runOnce(5)
+	want := map[string][]string{"a": {"a1", "a2", "a3"}, "c": {"c1", "c2"}}
+	if got := testSink.byKey(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("sent %v, want %v", got, want)
+	}
+	// b1 等待重试期间 b2 不投递
+	runOnce(0)
+	time.Sleep(350 * time.Millisecond)
+	// 第二次失败后进入死信，b2 在下一轮投递
+	runOnce(0)
+	runOnce(1)
+	if got := testSink.byKey()["b"]; !reflect.DeepEqual(got, []string{"b2"}) {
+		t.Fatalf("sent b %v", got)
+	}
+
+	dead, err := sys.OutboxDeadLetters(ctx, "db-outbox", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].Payload != `"b1"` || dead[0].Attempts != 2 || dead[0].LastError != "sink down" {
+		t.Fatalf("dead letters %+v", dead)
+	}
+	testSink.setFail("b1", false)
+	if n, err := sys.RetryOutbox(ctx, "db-outbox", dead[0].ID); err != nil || n != 1 {
+		t.Fatalf("RetryOutbox = %d, %v", n, err)
+	}
+	runOnce(1)
+	if got := testSink.byKey()["b"]; !reflect.DeepEqual(got, []string{"b2", "b1"}) {
+		t.Fatalf("sent b %v", got)
+	}
+
+	// 迁移后可按配置启动
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if _, err = sys.StartOutboxRelay(cctx, "db-outbox"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,142 @@
+package local
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 内存中的 Redis，只实现测试用到的命令，过期时间被忽略
+type fakeRedis struct {
+	mu    sync.Mutex
+	data  map[string]string
+	ln    net.Listener
+	locks bool // 为 true 时 SET NX 写入 :lock 结尾的键总是失败，模拟其他进程持有锁
+}
+
+func newFakeRedis() *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	r := &fakeRedis{data: make(map[string]string), ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) port() int {
+	return r.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (r *fakeRedis) holdLocks(hold bool) {
+	r.mu.Lock()
+	r.locks = hold
+	r.mu.Unlock()
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		args, err := readCommand(rd)
+		if err != nil {
+			return
+		}
+		r.exec(w, args)
+		if rd.Buffered() == 0 {
+			if err = w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || line[0] != '*' {
+		return nil, fmt.Errorf("bad command %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = rd.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (r *fakeRedis) exec(w *bufio.Writer, args []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	bulk := func(v string, ok bool) {
+		if !ok {
+			w.WriteString("$-1\r\n")
+			return
+		}
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	}
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		w.WriteString("+PONG\r\n")
+	case "GET":
+		v, ok := r.data[args[1]]
+		bulk(v, ok)
+	case "SET":
+		nx := false
+		for _, a := range args[3:] {
+			nx = nx || strings.EqualFold(a, "NX")
+		}
+		if _, ok := r.data[args[1]]; (ok || r.locks && strings.HasSuffix(args[1], ":lock")) && nx {
+			bulk("", false)
+			return
+		}
+		r.data[args[1]] = args[2]
+		w.WriteString("+OK\r\n")
+	case "MGET":
+		fmt.Fprintf(w, "*%d\r\n", len(args)-1)
+		for _, k := range args[1:] {
+			v, ok := r.data[k]
+			bulk(v, ok)
+		}
+	case "INCR":
+		n, _ := strconv.ParseInt(r.data[args[1]], 10, 64)
+		n++
+		r.data[args[1]] = strconv.FormatInt(n, 10)
+		fmt.Fprintf(w, ":%d\r\n", n)
+	case "DEL":
+		n := 0
+		for _, k := range args[1:] {
+			if _, ok := r.data[k]; ok {
+				delete(r.data, k)
+				n++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", n)
+	default:
+		// HELLO 等未实现的命令，go-redis 会退回 RESP2
+		fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", args[0])
+	}
+}
@@ -0,0 +1,183 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/EricJSanchez/gotool/sys"
+	"gorm.io/gorm"
+)
+
+func init() {
+	addConfig("db", `
+[db-repo]
+driver    = "sqlite"
+database  = "{dir}/repo.db"
+log_level = 1`)
+}
+
+type post struct {
+	ID        int64
+	Author    string
+	Score     int
+	CreatedAt time.Time
+}
+
+func TestRepoSeek(t *testing.T) {
+	ctx := context.Background()
+	db, err := sys.GormE(ctx, "db-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&post{}); err != nil {
+		t.Fatal(err)
+	}
+	posts := sys.NewRepo[post]("db-repo")
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var list []post
+	for i := 0; i < 23; i++ {
+		// score 与 created_at 大量重复，需靠追加的主键区分
+		list = append(list, post{Author: []string{"a", "b"}[i%2], Score: i % 4, CreatedAt: base.Add(time.Duration(i%5) * time.Hour)})
+	}
+	if err = posts.CreateInBatches(ctx, list, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		sort   []sys.SortField
+		scopes []sys.Scope
+		order  string
+	}{
+		{name: "primary key", order: "id"},
+		{name: "score desc", sort: []sys.SortField{{Column: "score", Desc: true}}, order: "score DESC, id DESC"},
+		{name: "multi column", sort: []sys.SortField{{Column: "created_at", Desc: true}, {Column: "score"}}, order: "created_at DESC, score, id"},
+		{name: "filtered", sort: []sys.SortField{{Column: "score"}, {Column: "id", Desc: true}}, scopes: []sys.Scope{sys.Where("author = ?", "b")}, order: "score, id DESC"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var want []int64
+			q := db.Model(&post{})
+			for _, s := range c.scopes {
+				q = s(q)
+			}
+			if err := q.Order(c.order).Pluck("id", &want).Error; err != nil {
+				t.Fatal(err)
+			}
+			var got []int64
+			cursor, pages := "", 0
+			for {
+				page, err := posts.Seek(ctx, cursor, 5, c.sort, c.scopes...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, p := range page.Items {
+					got = append(got, p.ID)
+				}
+				if pages++; page.Next == "" || pages > 10 {
+					break
+				}
+				cursor = page.Next
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v\nwant %v", got, want)
+			}
+		})
+	}
+
+	first, err := posts.Seek(ctx, "", 5, []sys.SortField{{Column: "score"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 游标与排序条件绑定
+	if _, err = posts.Seek(ctx, first.Next, 5, []sys.SortField{{Column: "score", Desc: true}}); !errors.Is(err, sys.ErrInvalidCursor) {
+		t.Fatalf("changed sort: err = %v, want ErrInvalidCursor", err)
+	}
+	if _, err = posts.Seek(ctx, "not-a-cursor", 5, nil); !errors.Is(err, sys.ErrInvalidCursor) {
+		t.Fatalf("bad cursor: err = %v, want ErrInvalidCursor", err)
+	}
+	if _, err = posts.Seek(ctx, "", 5, []sys.SortField{{Column: "missing"}}); err == nil {
+		t.Fatal("unknown sort column accepted")
+	}
+
+	var seen, batches int
+	err = posts.Each(ctx, 10, func(batch []post) error {
+		seen += len(batch)
+		batches++
+		return nil
+	})
+	if err != nil || seen != len(list) || batches != 3 {
+		t.Fatalf("Each: seen %d in %d batches, err %v", seen, batches, err)
+	}
+	errStop := fmt.Errorf("stop")
+	if err = posts.Each(ctx, 10, func([]post) error { return errStop }); err != errStop {
+		t.Fatalf("Each err = %v, want %v", err, errStop)
+	}
+}
+
+type note struct {
+	ID    int64
+	Title string
+	Score int
+}
+
+func TestParseQuery(t *testing.T) {
+	ctx := context.Background()
+	db, err := sys.GormE(ctx, "db-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&note{}); err != nil {
+		t.Fatal(err)
+	}
+	notes := sys.NewRepo[note]("db-repo")
+	for i, title := range []string{"a_b", "axb", "50%", "500", `c\d`, "cd"} {
+		if err = notes.Create(ctx, &note{Title: title, Score: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := sys.QueryOptions{
+		Filters: map[string]string{"title": "title", "score": "score"},
+		Sorts:   map[string]string{"id": "id"},
+	}
+
+	// % 与 _ 按字面匹配
+	for value, want := range map[string][]string{"a_b": {"a_b"}, "50%": {"50%"}, `c\d`: {`c\d`}, "b": {"a_b", "axb"}} {
+		q, err := sys.ParseQuery(url.Values{"title__like": {value}, "sort": {"id"}}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, err := notes.Find(ctx, q.Scopes()...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, n := range list {
+			got = append(got, n.Title)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("title__like=%s: %v, want %v", value, got, want)
+		}
+	}
+
+	// 条件顺序与参数在 map 中的顺序无关
+	values := url.Values{"title": {"cd"}, "score__gte": {"1"}, "score__lt": {"9"}, "title__like": {"c"}}
+	var first string
+	for i := 0; i < 20; i++ {
+		q, err := sys.ParseQuery(values, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmt := db.Session(&gorm.Session{DryRun: true}).Scopes(q.Scopes()...).Find(&[]note{}).Statement
+		if sql := stmt.SQL.String(); i == 0 {
+			first = sql
+		} else if sql != first {
+			t.Fatalf("SQL changed between calls:\n%s\n%s", first, sql)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package local
+
+import (
+	"context"
+	"testing"
+
+	"github.com/EricJSanchez/gotool/sys"
+	"gorm.io/gorm"
+)
+
+func init() {
+	addConfig("db", `
+[db-rw]
+driver    = "sqlite"
+database  = "{dir}/primary.db"
+log_level = 1
+[[db-rw.replicas]]
+database  = "{dir}/replica.db"
+
+[db-rw-replica]
+driver    = "sqlite"
+database  = "{dir}/replica.db"
+log_level = 1`)
+}
+
+type node struct {
+	ID   int64
+	Name string
+}
+
+func TestWithPrimary(t *testing.T) {
+	ctx := context.Background()
+	// 先建主库的表：db-rw 的 AutoMigrate 从从库判断表是否存在
+	for _, seed := range [][2]string{{"db-rw", "primary"}, {"db-rw-replica", "replica"}} {
+		name, value := seed[0], seed[1]
+		db, err := sys.GormE(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = db.AutoMigrate(&node{}); err != nil {
+			t.Fatal(err)
+		}
+		if err = db.Create(&node{ID: 1, Name: value}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read := func(ctx context.Context) string {
+		db, err := sys.GormE(ctx, "db-rw")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n node
+		if err = db.First(&n, 1).Error; err != nil {
+			t.Fatal(err)
+		}
+		var name string
+		if err = db.Raw("SELECT name FROM nodes WHERE id = ?", 1).Row().Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		if name != n.Name {
+			t.Fatalf("query read %s, row read %s", n.Name, name)
+		}
+		return n.Name
+	}
+	if got := read(ctx); got != "replica" {
+		t.Fatalf("read without WithPrimary hit %s, want replica", got)
+	}
+	if got := read(sys.WithPrimary(ctx)); got != "primary" {
+		t.Fatalf("read with WithPrimary hit %s, want primary", got)
+	}
+	// 事务始终在主库
+	err := sys.Tx(ctx, "db-rw", func(tx *gorm.DB) error {
+		var n node
+		if err := tx.First(&n, 1).Error; err != nil {
+			return err
+		}
+		if n.Name != "primary" {
+			t.Fatalf("read in tx hit %s, want primary", n.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,173 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/EricJSanchez/gotool/sys"
+	"gorm.io/gorm"
+)
+
+func init() {
+	addConfig("db", `
+[db-tenant]
+driver    = "sqlite"
+database  = "{dir}/tenant.db"
+log_level = 1`)
+}
+
+type ticket struct {
+	ID     int64
+	CorpId string `gorm:"tenant"`
+	Title  string
+}
+
+func TestTenant(t *testing.T) {
+	bg := context.Background()
+	db, err := sys.GormE(bg, "db-tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&ticket{}); err != nil {
+		t.Fatal(err)
+	}
+	ctxA, ctxB := sys.WithTenant(bg, "a"), sys.WithTenant(bg, "b")
+	tickets := sys.NewRepo[ticket]("db-tenant")
+
+	// 创建时填充租户列：结构体、切片、map、[]map
+	if err = tickets.Create(ctxA, &ticket{Title: "struct"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = tickets.CreateInBatches(ctxA, []ticket{{Title: "slice"}, {Title: "slice", CorpId: "a"}}, 10); err != nil {
+		t.Fatal(err)
+	}
+	dbA := func() *gorm.DB {
+		return db.WithContext(ctxA).Model(&ticket{})
+	}
+	if err = dbA().Create(map[string]interface{}{"title": "map"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = dbA().Create(map[string]interface{}{"Title": "map by field", "CorpId": ""}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = dbA().Create([]map[string]interface{}{{"title": "maps"}, {"title": "maps", "corp_id": "a"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = tickets.Create(ctxB, &ticket{Title: "other"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var untagged int64
+	if err = db.Model(&ticket{}).Scopes(sys.SkipTenant).Where("corp_id = '' OR corp_id IS NULL").Count(&untagged).Error; err != nil || untagged != 0 {
+		t.Fatalf("%d rows created without tenant, err %v", untagged, err)
+	}
+	if n, err := tickets.Count(ctxA); err != nil || n != 7 {
+		t.Fatalf("tenant a count %d, err %v", n, err)
+	}
+	if n, err := tickets.Count(ctxB); err != nil || n != 1 {
+		t.Fatalf("tenant b count %d, err %v", n, err)
+	}
+	if n, err := tickets.Count(bg, sys.SkipTenant); err != nil || n != 8 {
+		t.Fatalf("SkipTenant count %d, err %v", n, err)
+	}
+
+	// 写入其他租户
+	mismatch := []func() error{
+		func() error { return tickets.Create(ctxA, &ticket{Title: "x", CorpId: "b"}) },
+		func() error { return dbA().Create(map[string]interface{}{"title": "x", "corp_id": "b"}).Error },
+		func() error {
+			return dbA().Create([]map[string]interface{}{{"title": "x"}, {"title": "x", "CorpId": "b"}}).Error
+		},
+		func() error {
+			_, err := tickets.Update(ctxA, map[string]interface{}{"corp_id": "b"}, sys.Where("title = ?", "struct"))
+			return err
+		},
+	}
+	for i, fn := range mismatch {
+		if err := fn(); !errors.Is(err, sys.ErrTenantMismatch) {
+			t.Errorf("case %d: err = %v, want ErrTenantMismatch", i, err)
+		}
+	}
+
+	// 没有租户
+	required := []func() error{
+		func() error { _, err := tickets.Find(bg); return err },
+		func() error { return tickets.Create(bg, &ticket{Title: "x"}) },
+		func() error {
+			return db.WithContext(bg).Model(&ticket{}).Create(map[string]interface{}{"title": "x"}).Error
+		},
+		func() error { _, err := tickets.Delete(bg, sys.Where("1 = 1")); return err },
+	}
+	for i, fn := range required {
+		if err := fn(); !errors.Is(err, sys.ErrTenantRequired) {
+			t.Errorf("case %d: err = %v, want ErrTenantRequired", i, err)
+		}
+	}
+
+	// 更新、删除只影响本租户
+	if n, err := tickets.Update(ctxB, map[string]interface{}{"title": "renamed"}, sys.Where("1 = 1")); err != nil || n != 1 {
+		t.Fatalf("update rows %d, err %v", n, err)
+	}
+	if n, err := tickets.Delete(ctxB, sys.Where("1 = 1")); err != nil || n != 1 {
+		t.Fatalf("delete rows %d, err %v", n, err)
+	}
+	if n, err := tickets.Count(ctxA, sys.Where("title = ?", "renamed")); err != nil || n != 0 {
+		t.Fatalf("tenant b update leaked into a: %d, err %v", n, err)
+	}
+	err = sys.Tx(ctxA, "db-tenant", func(tx *gorm.DB) error {
+		var list []ticket
+		if err := tx.Find(&list).Error; err != nil {
+			return err
+		}
+		if len(list) != 7 {
+			t.Errorf("tx find %d rows, want 7", len(list))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TenantColumn 写错的模型
+type memo struct {
+	ID     int64
+	CorpId string
+	Text   string
+}
+
+func (memo) TenantColumn() string {
+	return "corp"
+}
+
+func TestTenantUnknownColumn(t *testing.T) {
+	bg := context.Background()
+	db, err := sys.GormE(bg, "db-tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&memo{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Exec("INSERT INTO memos (corp_id, text) VALUES ('b', 'other tenant')").Error; err != nil {
+		t.Fatal(err)
+	}
+	ctx := sys.WithTenant(bg, "a")
+	memos := sys.NewRepo[memo]("db-tenant")
+
+	// 不能退化为不加租户条件
+	if _, err = memos.Find(ctx); !errors.Is(err, sys.ErrUnknownTenantColumn) {
+		t.Fatalf("find: err = %v, want ErrUnknownTenantColumn", err)
+	}
+	if _, err = memos.Count(ctx); !errors.Is(err, sys.ErrUnknownTenantColumn) {
+		t.Fatalf("count: err = %v, want ErrUnknownTenantColumn", err)
+	}
+	if err = memos.Create(ctx, &memo{Text: "x"}); !errors.Is(err, sys.ErrUnknownTenantColumn) {
+		t.Fatalf("create: err = %v, want ErrUnknownTenantColumn", err)
+	}
+	// SkipTenant 显式跨租户时不受影响
+	if n, err := memos.Count(ctx, sys.SkipTenant); err != nil || n != 1 {
+		t.Fatalf("skip tenant: count = %d, err = %v", n, err)
+	}
+}
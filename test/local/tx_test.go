@@ -0,0 +1,172 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/EricJSanchez/gotool/sys"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+func init() {
+	addConfig("db", `
+[db-tx]
+driver    = "sqlite"
+database  = "{dir}/tx.db"
+log_level = 1`)
+}
+
+type account struct {
+	ID      int64
+	Name    string
+	Balance int
+}
+
+func txDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := sys.GormE(context.Background(), "db-tx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Migrator().DropTable(&account{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&account{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func accountNames(t *testing.T, db *gorm.DB) (names []string) {
+	t.Helper()
+	if err := db.Model(&account{}).Order("id").Pluck("name", &names).Error; err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestTxSavepoint(t *testing.T) {
+	db := txDB(t)
+	ctx := context.Background()
+	errInner := errors.New("inner")
+	err := sys.Tx(ctx, "db-tx", func(tx *gorm.DB) error {
+		if err := tx.Create(&account{Name: "outer"}).Error; err != nil {
+			return err
+		}
+		// 以事务的 ctx 获取连接得到同一事务
+		inner, err := sys.GormE(tx.Statement.Context, "db-tx")
+		if err != nil {
+			return err
+		}
+		if inner.Statement.ConnPool != tx.Statement.ConnPool {
+			t.Error("GormE in Tx did not return the transaction")
+		}
+		// 内层出错只回滚到保存点
+		err = sys.Tx(tx.Statement.Context, "db-tx", func(tx *gorm.DB) error {
+			if err := tx.Create(&account{Name: "rolled back"}).Error; err != nil {
+				return err
+			}
+			return errInner
+		})
+		if !errors.Is(err, errInner) {
+			t.Errorf("nested Tx returned %v, want %v", err, errInner)
+		}
+		return sys.Tx(tx.Statement.Context, "db-tx", func(tx *gorm.DB) error {
+			return tx.Create(&account{Name: "nested"}).Error
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := accountNames(t, db); len(got) != 2 || got[0] != "outer" || got[1] != "nested" {
+		t.Fatalf("got %v, want [outer nested]", got)
+	}
+
+	// 外层出错时全部回滚
+	err = sys.Tx(ctx, "db-tx", func(tx *gorm.DB) error {
+		_ = sys.Tx(tx.Statement.Context, "db-tx", func(tx *gorm.DB) error {
+			return tx.Create(&account{Name: "inner"}).Error
+		})
+		return errInner
+	})
+	if !errors.Is(err, errInner) {
+		t.Fatalf("Tx returned %v, want %v", err, errInner)
+	}
+	if got := accountNames(t, db); len(got) != 2 {
+		t.Fatalf("rollback left %v", got)
+	}
+
+	// panic 时回滚并继续向上传递
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic was not propagated")
+			}
+		}()
+		_ = sys.Tx(ctx, "db-tx", func(tx *gorm.DB) error {
+			tx.Create(&account{Name: "panic"})
+			panic("boom")
+		})
+	}()
+	if got := accountNames(t, db); len(got) != 2 {
+		t.Fatalf("panic left %v", got)
+	}
+}
+
+func TestTxRetry(t *testing.T) {
+	db := txDB(t)
+	ctx := context.Background()
+	deadlock := &mysqldriver.MySQLError{Number: 1213, Message: "Deadlock found"}
+	cases := []struct {
+		name     string
+		opts     *sys.TxOptions
+		fail     int   // 前几次执行返回 err
+		err      error // 返回的错误
+		attempts int
+		wantErr  bool
+	}{
+		{name: "deadlock", opts: &sys.TxOptions{Backoff: time.Millisecond}, fail: 2, err: deadlock, attempts: 3},
+		{name: "exhausted", opts: &sys.TxOptions{MaxRetries: 1, Backoff: time.Millisecond}, fail: 5, err: deadlock, attempts: 2, wantErr: true},
+		{name: "no retry", opts: &sys.TxOptions{MaxRetries: -1}, fail: 1, err: deadlock, attempts: 1, wantErr: true},
+		{name: "not retryable", opts: &sys.TxOptions{Backoff: time.Millisecond}, fail: 1, err: errors.New("bad"), attempts: 1, wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			db.Where("1 = 1").Delete(&account{})
+			attempts := 0
+			err := sys.TxWithOptions(ctx, "db-tx", c.opts, func(tx *gorm.DB) error {
+				attempts++
+				if err := tx.Create(&account{Name: c.name}).Error; err != nil {
+					return err
+				}
+				// 内层的死锁交由最外层重试
+				return sys.Tx(tx.Statement.Context, "db-tx", func(tx *gorm.DB) error {
+					if attempts <= c.fail {
+						return c.err
+					}
+					return nil
+				})
+			})
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, c.wantErr)
+			}
+			if attempts != c.attempts {
+				t.Fatalf("attempts = %d, want %d", attempts, c.attempts)
+			}
+			want := 1
+			if c.wantErr {
+				want = 0
+			}
+			// 失败的尝试均已回滚
+			if got := accountNames(t, db); len(got) != want {
+				t.Fatalf("got %v, want %d row(s)", got, want)
+			}
+		})
+	}
+	if !sys.IsRetryableTxError(deadlock) || sys.IsRetryableTxError(errors.New("x")) || sys.IsRetryableTxError(nil) {
+		t.Fatal("IsRetryableTxError")
+	}
+}